@@ -0,0 +1,37 @@
+package commands
+
+import (
+	"github.com/loderunner/apiki/internal/agent"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// AgentSocket is the path to the socket of the agent holding the keys of
+// password-protected files, see `apiki agent`.
+var AgentSocket string
+
+// agentKey returns the key of a password-protected file held by the agent.
+// Keys are identified by the salt of the file, and checked against its
+// verifier.
+func agentKey(file *entries.File) ([]byte, error) {
+	key, err := agent.Get(AgentSocket, file.Encryption.Salt)
+	if err != nil {
+		return nil, err
+	}
+	if err := file.VerifyKey(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// VerifyPassword verifies the password of a password-protected file, and
+// gives the derived key to the agent if it is running. Returns the key.
+func VerifyPassword(file *entries.File, password string) ([]byte, error) {
+	key, err := file.VerifyPassword(password)
+	if err != nil {
+		return nil, err
+	}
+
+	// The agent is optional
+	_ = agent.Put(AgentSocket, file.Encryption.Salt, key)
+	return key, nil
+}
@@ -0,0 +1,138 @@
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	keyagent "github.com/loderunner/apiki/internal/agent"
+)
+
+// DefaultTimeout is the time after which the agent forgets a key that wasn't
+// used.
+const DefaultTimeout = 15 * time.Minute
+
+// startTimeout bounds the time Run waits for a detached agent to listen.
+const startTimeout = 5 * time.Second
+
+// Options configures the agent command.
+type Options struct {
+	// Timeout is the time after which the agent forgets a key that wasn't
+	// used.
+	Timeout time.Duration
+
+	// Foreground runs the agent in the current process instead of detaching
+	// it.
+	Foreground bool
+}
+
+// Run starts an agent listening on the socket at socketPath, holding the keys
+// of password-protected files once unlocked. Unless opts.Foreground is set,
+// the agent is detached from the terminal and Run returns once it listens.
+func Run(socketPath string, opts Options) error {
+	if opts.Timeout <= 0 {
+		return errors.New("timeout must be positive")
+	}
+	if opts.Foreground {
+		return serve(socketPath, opts.Timeout)
+	}
+
+	if err := keyagent.Ping(socketPath); err == nil {
+		fmt.Fprintf(os.Stderr, "✓ Agent already running on %s.\n", socketPath)
+		return nil
+	}
+
+	// Run the agent in another process, so that it outlives the terminal
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find executable: %w", err)
+	}
+	cmd := osexec.Command(
+		exe,
+		"agent",
+		"--foreground",
+		"--timeout",
+		opts.Timeout.String(),
+	)
+	cmd.Env = append(os.Environ(), "APIKI_AGENT_SOCK="+socketPath)
+	cmd.Dir = "/"
+	if err := detach(cmd); err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start agent: %w", err)
+	}
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	// Wait for the agent to listen
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	deadline := time.After(startTimeout)
+	for keyagent.Ping(socketPath) != nil {
+		select {
+		case err := <-exited:
+			return fmt.Errorf(
+				"agent exited: %v, run `apiki agent --foreground` for details",
+				err,
+			)
+		case <-deadline:
+			return errors.New("agent did not start in time")
+		case <-ticker.C:
+		}
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"✓ Started agent on %s, keys are forgotten after %s without use.\n",
+		socketPath,
+		opts.Timeout,
+	)
+	return nil
+}
+
+// serve runs an agent listening on the socket at socketPath until the process
+// is interrupted or terminated.
+func serve(socketPath string, timeout time.Duration) error {
+	listener, err := keyagent.Listen(socketPath)
+	if err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+	go func() {
+		<-signals
+		_ = listener.Close()
+	}()
+
+	fmt.Fprintf(
+		os.Stderr,
+		"Agent listening on %s, keys are forgotten after %s without use.\n",
+		socketPath,
+		timeout,
+	)
+	return keyagent.New(timeout).Serve(listener)
+}
+
+// Lock makes the agent listening on the socket at socketPath forget every
+// key, so that files must be unlocked again.
+func Lock(socketPath string) error {
+	count, err := keyagent.Lock(socketPath)
+	if errors.Is(err, keyagent.ErrNotRunning) {
+		fmt.Fprintf(os.Stderr, "No agent is running.\n")
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock agent: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Agent forgot %d keys.\n", count)
+	return nil
+}
@@ -0,0 +1,67 @@
+package agent
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	keyagent "github.com/loderunner/apiki/internal/agent"
+)
+
+// start runs an agent on a socket in a temporary directory, and returns the
+// path of the socket.
+func start(t *testing.T) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := keyagent.Listen(path)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- keyagent.New(time.Minute).Serve(listener) }()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		require.NoError(t, <-done)
+	})
+	return path
+}
+
+func TestRun(t *testing.T) {
+	t.Run("rejects invalid timeout", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.sock")
+
+		err := Run(path, Options{Timeout: 0})
+		require.EqualError(t, err, "timeout must be positive")
+	})
+
+	t.Run("reuses a running agent", func(t *testing.T) {
+		path := start(t)
+		require.NoError(t, keyagent.Put(path, "salt", []byte("key")))
+
+		require.NoError(t, Run(path, Options{Timeout: time.Minute}))
+
+		key, err := keyagent.Get(path, "salt")
+		require.NoError(t, err)
+		require.Equal(t, []byte("key"), key)
+	})
+}
+
+func TestLock(t *testing.T) {
+	t.Run("forgets every key", func(t *testing.T) {
+		path := start(t)
+		require.NoError(t, keyagent.Put(path, "salt", []byte("key")))
+
+		require.NoError(t, Lock(path))
+
+		_, err := keyagent.Get(path, "salt")
+		require.ErrorIs(t, err, keyagent.ErrNotFound)
+	})
+
+	t.Run("succeeds without agent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.sock")
+
+		require.NoError(t, Lock(path))
+	})
+}
@@ -0,0 +1,14 @@
+//go:build !unix
+
+package agent
+
+import (
+	osexec "os/exec"
+
+	keyagent "github.com/loderunner/apiki/internal/agent"
+)
+
+// detach returns keyagent.ErrUnavailable, no agent runs on this platform.
+func detach(cmd *osexec.Cmd) error {
+	return keyagent.ErrUnavailable
+}
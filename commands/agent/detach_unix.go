@@ -0,0 +1,14 @@
+//go:build unix
+
+package agent
+
+import (
+	osexec "os/exec"
+	"syscall"
+)
+
+// detach makes cmd run in a new session, so that it outlives the terminal.
+func detach(cmd *osexec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	return nil
+}
@@ -0,0 +1,138 @@
+package apiki
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/filelock"
+)
+
+func (m Model) updateConflict(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c", "q":
+		m.cancelled = true
+		return m, tea.Quit
+
+	case "m", "M", "enter":
+		// Merge the changes made in memory since the last save into the
+		// file on disk
+		base := slices.Clone(m.layers[m.conflictLayer].File.Entries)
+		ours := m.layerEntries(m.conflictLayer)
+		if err := m.reload(); err != nil {
+			m.errorMessage = "Failed to reload variables: " + err.Error()
+			m.mode = modeError
+			return m, nil
+		}
+		theirs := m.layers[m.conflictLayer].File.Entries
+		m = m.replaceLayerEntries(
+			m.conflictLayer,
+			entries.Merge(base, ours, theirs),
+		)
+		return m.resolveConflict(), nil
+
+	case "r", "R":
+		// Discard the changes made in memory to the file
+		if err := m.reload(); err != nil {
+			m.errorMessage = "Failed to reload variables: " + err.Error()
+			m.mode = modeError
+			return m, nil
+		}
+		m = m.replaceLayerEntries(
+			m.conflictLayer,
+			m.layers[m.conflictLayer].File.Entries,
+		)
+		return m.resolveConflict(), nil
+	}
+
+	return m, nil
+}
+
+// reload reads the file in conflict from disk again, holding its lock since it
+// may be migrated and saved.
+func (m Model) reload() error {
+	lock, err := filelock.TryAcquire(m.layers[m.conflictLayer].Path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	return m.layers.Reload(m.conflictLayer)
+}
+
+// resolveConflict saves the entries once the file in conflict was reloaded,
+// and returns to the list. Saving may end in another conflict if several
+// files changed.
+func (m Model) resolveConflict() Model {
+	m.mode = modeList
+	m = m.persistEntries()
+	m = m.recomputeFilter()
+	if m.cursor >= len(m.filteredIndices) {
+		m.cursor = max(len(m.filteredIndices)-1, 0)
+	}
+	return m.adjustViewport()
+}
+
+// layerEntries returns the apiki entries of the file at index layer.
+func (m Model) layerEntries(layer int) []entries.Entry {
+	var list []entries.Entry
+	for _, entry := range m.entries {
+		if entry.SourceFile == "" && entry.Layer == layer {
+			list = append(list, entry.Entry)
+		}
+	}
+	return list
+}
+
+// replaceLayerEntries replaces the apiki entries of the file at index layer
+// with list, keeping the selection state of entries by ID.
+func (m Model) replaceLayerEntries(layer int, list []entries.Entry) Model {
+	selected := make(map[string]bool)
+	kept := make([]Entry, 0, len(m.entries))
+	for _, entry := range m.entries {
+		if entry.SourceFile == "" && entry.Layer == layer {
+			selected[entry.ID] = entry.Selected
+			continue
+		}
+		kept = append(kept, entry)
+	}
+
+	for _, entry := range list {
+		kept = append(kept, Entry{
+			Entry:    entry,
+			Selected: selected[entry.ID],
+			Layer:    layer,
+		})
+	}
+
+	SortEntries(kept)
+	m.entries = kept
+	return m
+}
+
+func (m Model) viewConflict() string {
+	var b strings.Builder
+
+	warnStyle := lipgloss.NewStyle().Bold(true).Foreground(ColorBrightYellow)
+	b.WriteString(warnStyle.Render("File Changed"))
+	b.WriteString("\n\n")
+
+	nameStyle := lipgloss.NewStyle().Bold(true)
+	fmt.Fprintf(
+		&b,
+		"  %s was changed by another process.\n\n",
+		nameStyle.Render(m.layers[m.conflictLayer].Path),
+	)
+
+	infoStyle := lipgloss.NewStyle().Foreground(ColorGray)
+	b.WriteString(infoStyle.Render(
+		"  Merge keeps the changes made on both sides, yours win when both\n" +
+			"  changed the same variable. Reload discards your changes.\n",
+	))
+
+	return b.String()
+}
@@ -34,6 +34,12 @@ func (m Model) updateConfirmDelete(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 					return m, nil
 				}
 
+				// On conflict, keep the change until the file is reloaded
+				// or merged
+				if m.mode == modeConflict {
+					return m, nil
+				}
+
 				m = m.recomputeFilter()
 				if m.cursor >= len(m.filteredIndices) && m.cursor > 0 {
 					m.cursor--
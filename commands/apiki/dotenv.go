@@ -1,6 +1,7 @@
 package apiki
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
@@ -51,7 +52,8 @@ func FindDotEnvFiles(startDir string) ([]string, error) {
 }
 
 // ParseDotEnvFile parses a single .env file and converts it to Entry slice.
-// Each entry gets a label of the form "from <dirname>/<filename>".
+// Each entry gets a label of the form "from <dirname>/<filename>". Names are
+// not validated, see entries.ValidateName.
 func ParseDotEnvFile(path string) ([]Entry, error) {
 	envMap, err := godotenv.Read(path)
 	if err != nil {
@@ -80,7 +82,8 @@ func ParseDotEnvFile(path string) ([]Entry, error) {
 }
 
 // LoadDotEnvEntries finds and parses all .env files upward from PWD.
-// Returns all entries from all found .env files.
+// Returns all entries from all found .env files. Entries with an invalid name
+// are skipped and reported on stderr.
 func LoadDotEnvEntries() ([]Entry, error) {
 	pwd, err := os.Getwd()
 	if err != nil {
@@ -94,12 +97,23 @@ func LoadDotEnvEntries() ([]Entry, error) {
 
 	var allEntries []Entry
 	for _, envFile := range envFiles {
-		entries, err := ParseDotEnvFile(envFile)
+		fileEntries, err := ParseDotEnvFile(envFile)
 		if err != nil {
 			// Skip files that can't be parsed, but continue with others
 			continue
 		}
-		allEntries = append(allEntries, entries...)
+		for _, entry := range fileEntries {
+			if err := entries.ValidateName(entry.Name); err != nil {
+				fmt.Fprintf(
+					os.Stderr,
+					"apiki: warning: %s: skipped %s\n",
+					envFile,
+					err,
+				)
+				continue
+			}
+			allEntries = append(allEntries, entry)
+		}
 	}
 
 	return allEntries, nil
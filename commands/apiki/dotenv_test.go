@@ -0,0 +1,27 @@
+package apiki
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadDotEnvEntries(t *testing.T) {
+	t.Run("skips invalid names", func(t *testing.T) {
+		dir := t.TempDir()
+		data := []byte("GOOD=1\n1BAD=2\nALSO_GOOD=3\n")
+		err := os.WriteFile(filepath.Join(dir, ".env"), data, 0o600)
+		require.NoError(t, err)
+		t.Chdir(dir)
+
+		list, err := LoadDotEnvEntries()
+		require.NoError(t, err)
+		names := make([]string, 0, len(list))
+		for _, entry := range list {
+			names = append(names, entry.Name)
+		}
+		require.ElementsMatch(t, []string{"GOOD", "ALSO_GOOD"}, names)
+	})
+}
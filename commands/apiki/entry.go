@@ -3,7 +3,6 @@ package apiki
 import (
 	"path/filepath"
 	"slices"
-	"strings"
 
 	"github.com/loderunner/apiki/internal/entries"
 )
@@ -17,8 +16,12 @@ type Entry struct {
 	Selected bool
 
 	// SourceFile is the path to the .env file this entry came from.
-	// Empty string means the entry came from the apiki file.
+	// Empty string means the entry came from an apiki file.
 	SourceFile string
+
+	// Layer is the index of the apiki file this entry came from, among the
+	// loaded variables files. Zero is the default file.
+	Layer int
 }
 
 // FuzzyTarget returns the string to use for fuzzy matching this entry.
@@ -41,17 +44,12 @@ func (e Entry) FuzzyTarget() string {
 }
 
 // SortEntries sorts entries alphabetically by (Name, Label), case-insensitive.
-func SortEntries(entries []Entry) {
-	slices.SortFunc(entries, func(a, b Entry) int {
-		if c := strings.Compare(
-			strings.ToLower(a.Name),
-			strings.ToLower(b.Name),
-		); c != 0 {
+// Entries that compare equal are ordered by layer.
+func SortEntries(list []Entry) {
+	slices.SortFunc(list, func(a, b Entry) int {
+		if c := entries.Compare(a.Entry, b.Entry); c != 0 {
 			return c
 		}
-		return strings.Compare(
-			strings.ToLower(a.Label),
-			strings.ToLower(b.Label),
-		)
+		return a.Layer - b.Layer
 	})
 }
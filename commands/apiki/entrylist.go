@@ -3,6 +3,7 @@ package apiki
 import (
 	"fmt"
 	"os"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
@@ -65,6 +66,52 @@ func (m Model) nameGroups() map[string][]int {
 	return m.nameGroupsMemo
 }
 
+// untaggedHeading is the heading of entries without tags in the grouped view.
+const untaggedHeading = "untagged"
+
+// groupByTags orders indices under tag headings, sorted by tag,
+// case-insensitive. Entries with several tags appear under each of them,
+// entries without tags come last. Returns the new indices and the heading to
+// show above the first entry of each group, by display index.
+func (m Model) groupByTags(indices []int) ([]int, map[int]string) {
+	groups := make(map[string][]int)
+	headings := make(map[string]string)
+	var untagged []int
+	for _, idx := range indices {
+		tags := m.entries[idx].Tags
+		if len(tags) == 0 {
+			untagged = append(untagged, idx)
+			continue
+		}
+		for _, tag := range tags {
+			key := strings.ToLower(tag)
+			if _, ok := headings[key]; !ok {
+				headings[key] = tag
+			}
+			groups[key] = append(groups[key], idx)
+		}
+	}
+
+	keys := make([]string, 0, len(groups))
+	for key := range groups {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	grouped := make([]int, 0, len(indices))
+	groupHeadings := make(map[int]string)
+	for _, key := range keys {
+		groupHeadings[len(grouped)] = headings[key]
+		grouped = append(grouped, groups[key]...)
+	}
+	if len(untagged) > 0 {
+		groupHeadings[len(grouped)] = untaggedHeading
+		grouped = append(grouped, untagged...)
+	}
+
+	return grouped, groupHeadings
+}
+
 // listHeight calculates how many entries can fit in the visible area.
 func (m Model) listHeight() int {
 	// Fixed overhead: title(1) + top spacer(1) + bottom line(1) + helpbar(1)
@@ -78,6 +125,25 @@ func (m Model) listHeight() int {
 	return visible
 }
 
+// viewportEnd returns the display index after the last entry that fits in the
+// viewport starting at start. Tag headings take a line each. At least one
+// entry is always shown.
+func (m Model) viewportEnd(start int) int {
+	lines := 0
+	end := start
+	for end < len(m.filteredIndices) {
+		lines++
+		if _, ok := m.groupHeadings[end]; ok {
+			lines++
+		}
+		if lines > m.listHeight() && end > start {
+			break
+		}
+		end++
+	}
+	return end
+}
+
 // adjustViewport ensures the cursor stays within the visible viewport.
 // The viewport only scrolls when the cursor would move outside the visible
 // range.
@@ -86,21 +152,21 @@ func (m Model) adjustViewport() Model {
 		m.viewportStart = 0
 		return m
 	}
-	visible := m.listHeight()
 	// Cursor above viewport: scroll up
 	if m.cursor < m.viewportStart {
 		m.viewportStart = m.cursor
 	}
 	// Cursor below viewport: scroll down
-	if m.cursor >= m.viewportStart+visible {
-		m.viewportStart = m.cursor - visible + 1
+	for m.cursor >= m.viewportEnd(m.viewportStart) {
+		m.viewportStart++
 	}
-	// Clamp viewport start
-	maxStart := max(len(m.filteredIndices)-visible, 0)
+	// Clamp viewport start so that the last entry stays at the bottom
 	if m.viewportStart < 0 {
 		m.viewportStart = 0
-	} else if m.viewportStart > maxStart {
-		m.viewportStart = maxStart
+	}
+	for m.viewportStart > 0 &&
+		m.viewportEnd(m.viewportStart-1) == len(m.filteredIndices) {
+		m.viewportStart--
 	}
 	return m
 }
@@ -167,12 +233,16 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			}
 			return m, nil
 		}
-		m = m.persistSelection()
-		if m.mode == modeError {
-			return m, nil
-		}
-		m.quitting = true
-		return m, tea.Quit
+		// Selected secret values must be decrypted to be exported, e.g. when
+		// selected by a profile
+		return m.unlockSelected(func(m Model) (Model, tea.Cmd) {
+			m = m.persistSelection()
+			if m.mode == modeError {
+				return m, nil
+			}
+			m.quitting = true
+			return m, tea.Quit
+		})
 
 	case "/":
 		m.filtering = true
@@ -215,32 +285,44 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			actualIndex := m.filteredIndices[m.cursor]
 			entry := m.entries[actualIndex]
 			if entry.SourceFile != "" {
-				// .env entry: show promote confirmation
-				m.mode = modeConfirmPromote
-			} else {
-				// apiki entry: edit directly
+				// .env entry: show promote confirmation, the new entry goes
+				// to the default file
+				return m.requireUnlock(0, func(m Model) (Model, tea.Cmd) {
+					m.mode = modeConfirmPromote
+					return m, nil
+				})
+			}
+			// apiki entry: edit directly, a secret value must be decrypted
+			if !entry.Secret {
 				m.mode = modeEdit
 				return m.prepareForm(actualIndex, &entry)
 			}
+			return m.requireUnlock(
+				entry.Layer,
+				func(m Model) (Model, tea.Cmd) {
+					entry := m.entries[actualIndex]
+					m.mode = modeEdit
+					return m.prepareForm(actualIndex, &entry)
+				},
+			)
 		}
 		return m, nil
 
 	case " ":
 		if len(m.filteredIndices) > 0 {
 			actualIndex := m.filteredIndices[m.cursor]
-			currentEntry := &m.entries[actualIndex]
-			currentEntry.Selected = !currentEntry.Selected
-
-			// Radio-button behavior: if we selected this entry, deselect others
-			// with the same name (only in list mode, not import mode)
-			if currentEntry.Selected && m.mode != modeImport {
-				groups := m.nameGroups()
-				for _, i := range groups[currentEntry.Name] {
-					if i != actualIndex {
-						m.entries[i].Selected = false
-					}
-				}
+			entry := m.entries[actualIndex]
+
+			// A secret value must be decrypted to be exported
+			if !entry.Selected && entry.Secret && entry.SourceFile == "" {
+				return m.requireUnlock(
+					entry.Layer,
+					func(m Model) (Model, tea.Cmd) {
+						return m.toggle(actualIndex), nil
+					},
+				)
 			}
+			m = m.toggle(actualIndex)
 		}
 
 	case "+":
@@ -248,9 +330,12 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.mode == modeImport {
 			return m, nil
 		}
-		m = m.clearFilter()
-		m.mode = modeAdd
-		return m.prepareForm(-1, nil)
+		// New entries go to the default file
+		return m.requireUnlock(0, func(m Model) (Model, tea.Cmd) {
+			m = m.clearFilter()
+			m.mode = modeAdd
+			return m.prepareForm(-1, nil)
+		})
 
 	case "backspace", "delete", "-":
 		// Don't allow deletion in import mode
@@ -267,20 +352,31 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			// Otherwise ignore the keypress for .env entries
 		}
 
-	case "i":
+	case "s":
 		if m.mode == modeList {
-			// Store current entries
-			m.originalEntries = make([]Entry, len(m.entries))
-			copy(m.originalEntries, m.entries)
-
-			// Load environment variables
-			envEntries := loadEnvironmentEntries()
-			m.entries = envEntries
-			m.mode = modeImport
-			m.cursor = 0
-			m = m.clearFilter()
+			return m.openProfiles(modeSaveProfile)
+		}
+		return m, nil
+
+	case "p":
+		if m.mode == modeList {
+			return m.openProfiles(modeLoadProfile)
+		}
+		return m, nil
+
+	case "g":
+		if m.mode == modeList {
+			m.groupByTag = !m.groupByTag
 			m = m.recomputeFilter()
-			m = m.adjustViewport()
+		}
+		return m, nil
+
+	case "i":
+		if m.mode == modeList {
+			// Imported entries go to the default file
+			return m.requireUnlock(0, func(m Model) (Model, tea.Cmd) {
+				return m.openImport(), nil
+			})
 		}
 		return m, nil
 	}
@@ -288,6 +384,41 @@ func (m Model) updateList(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	return m, nil
 }
 
+// toggle selects or deselects the entry at index. Selecting an entry deselects
+// the others with the same name, except in import mode.
+func (m Model) toggle(index int) Model {
+	currentEntry := &m.entries[index]
+	currentEntry.Selected = !currentEntry.Selected
+
+	// Radio-button behavior: if we selected this entry, deselect others
+	// with the same name (only in list mode, not import mode)
+	if currentEntry.Selected && m.mode != modeImport {
+		groups := m.nameGroups()
+		for _, i := range groups[currentEntry.Name] {
+			if i != index {
+				m.entries[i].Selected = false
+			}
+		}
+	}
+	return m
+}
+
+// openImport switches to import mode, listing the environment variables.
+func (m Model) openImport() Model {
+	// Store current entries
+	m.originalEntries = make([]Entry, len(m.entries))
+	copy(m.originalEntries, m.entries)
+
+	// Load environment variables
+	envEntries := loadEnvironmentEntries()
+	m.entries = envEntries
+	m.mode = modeImport
+	m.cursor = 0
+	m = m.clearFilter()
+	m = m.recomputeFilter()
+	return m.adjustViewport()
+}
+
 func (m Model) viewList() string {
 	var b strings.Builder
 
@@ -332,6 +463,9 @@ func (m Model) viewList() string {
 	groupConnectorStyle := lipgloss.
 		NewStyle().
 		Foreground(ColorGray)
+	tagStyle := lipgloss.NewStyle().Foreground(ColorCyan)
+	layerStyle := lipgloss.NewStyle().Foreground(ColorMagenta)
+	secretStyle := lipgloss.NewStyle().Foreground(ColorYellow)
 
 	groups := m.nameGroups()
 
@@ -352,14 +486,20 @@ func (m Model) viewList() string {
 	}
 
 	// Calculate visible range
-	visibleHeight := m.listHeight()
-	viewportEnd := m.viewportStart + visibleHeight
-	if viewportEnd > len(entriesToShow) {
-		viewportEnd = len(entriesToShow)
-	}
+	viewportEnd := m.viewportEnd(m.viewportStart)
+
+	headingStyle := lipgloss.
+		NewStyle().
+		Bold(true).
+		Foreground(ColorBrightCyan)
 
 	// Render only visible entries
 	for displayIdx := m.viewportStart; displayIdx < viewportEnd; displayIdx++ {
+		if heading, ok := m.groupHeadings[displayIdx]; ok {
+			b.WriteString(headingStyle.Render("# " + heading))
+			b.WriteString("\n")
+		}
+
 		actualIdx := entriesToShow[displayIdx]
 		entry := m.entries[actualIdx]
 		cursor := "  "
@@ -439,14 +579,34 @@ func (m Model) viewList() string {
 			}
 		}
 
+		var tags string
+		if len(entry.Tags) > 0 {
+			tags = " " + tagStyle.Render("["+strings.Join(entry.Tags, ", ")+"]")
+		}
+
+		var secret string
+		if entry.Secret {
+			secret = " " + secretStyle.Render("🔒")
+		}
+
+		// Tell which file the entry comes from when several are loaded
+		var layer string
+		if len(m.layerNames) > 1 && entry.SourceFile == "" &&
+			m.mode != modeImport {
+			layer = " " + layerStyle.Render("@"+m.layerNames[entry.Layer])
+		}
+
 		fmt.Fprintf(
 			&b,
-			"%s%s%s%s%s\n",
+			"%s%s%s%s%s%s%s%s\n",
 			cursor,
 			groupPrefix,
 			checkbox,
 			name,
 			label,
+			tags,
+			secret,
+			layer,
 		)
 	}
 
@@ -458,7 +618,7 @@ func (m Model) hasEntriesBelow() bool {
 	if len(m.filteredIndices) == 0 {
 		return false
 	}
-	return m.viewportStart+m.listHeight() < len(m.filteredIndices)
+	return m.viewportEnd(m.viewportStart) < len(m.filteredIndices)
 }
 
 // loadEnvironmentEntries loads environment variables from os.Environ() and
@@ -499,9 +659,11 @@ func (m Model) confirmImport() (Model, tea.Cmd) {
 			// Create new apiki entry (no SourceFile)
 			selectedEntries = append(selectedEntries, Entry{
 				Entry: entries.Entry{
-					Name:  entry.Name,
-					Value: entry.Value,
-					Label: "imported from environment",
+					ID:     entries.NewID(),
+					Name:   entry.Name,
+					Value:  entry.Value,
+					Label:  "imported from environment",
+					Secret: m.layers[0].File.Encrypted(),
 				},
 				Selected: true,
 			})
@@ -518,8 +680,8 @@ func (m Model) confirmImport() (Model, tea.Cmd) {
 		SortEntries(m.entries)
 		m = m.persistEntries()
 
-		// On persist failure, stay in error mode
-		if m.mode == modeError {
+		// On persist failure, stay in error or conflict mode
+		if m.mode == modeError || m.mode == modeConflict {
 			return m, nil
 		}
 	}
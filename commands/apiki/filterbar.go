@@ -2,6 +2,7 @@ package apiki
 
 import (
 	"fmt"
+	"slices"
 	"strings"
 
 	"github.com/charmbracelet/lipgloss"
@@ -19,6 +20,25 @@ func (s entrySource) String(i int) string {
 	return s[i].FuzzyTarget()
 }
 
+// tagPrefix starts a word of the filter query that matches entries by tag.
+const tagPrefix = "tag:"
+
+// parseFilter splits a filter query into the tags of its "tag:NAME" words and
+// the remaining fuzzy query.
+func parseFilter(query string) ([]string, string) {
+	var tags, words []string
+	for _, word := range strings.Fields(query) {
+		if tag, ok := strings.CutPrefix(word, tagPrefix); ok {
+			if tag != "" {
+				tags = append(tags, tag)
+			}
+			continue
+		}
+		words = append(words, word)
+	}
+	return tags, strings.Join(words, " ")
+}
+
 // recomputeFilter updates filteredIndices based on the current filter query.
 // The cursor persists on the same entry when possible. If the current entry
 // gets filtered out, backtrack through entries to find a visible one.
@@ -29,24 +49,42 @@ func (m Model) recomputeFilter() Model {
 		targetEntryIdx = m.filteredIndices[m.cursor]
 	}
 
+	// Entries must have all the tags of the query
+	tags, query := parseFilter(m.filterInput.Value())
+	candidates := make([]int, 0, len(m.entries))
+	for i, entry := range m.entries {
+		if slices.IndexFunc(tags, func(tag string) bool {
+			return !entry.HasTag(tag)
+		}) < 0 {
+			candidates = append(candidates, i)
+		}
+	}
+
 	// Recompute filtered indices
-	query := strings.TrimSpace(m.filterInput.Value())
 	if query == "" {
-		m.filteredIndices = make([]int, len(m.entries))
-		for i := range m.entries {
-			m.filteredIndices[i] = i
-		}
+		m.filteredIndices = candidates
 		m.fuzzyMatches = nil
 	} else {
-		matches := fuzzy.FindFrom(query, entrySource(m.entries))
+		source := make(entrySource, len(candidates))
+		for i, idx := range candidates {
+			source[i] = m.entries[idx]
+		}
+		matches := fuzzy.FindFrom(query, source)
 		m.filteredIndices = make([]int, len(matches))
 		m.fuzzyMatches = make(map[int][]int)
 		for i, match := range matches {
-			m.filteredIndices[i] = match.Index
-			m.fuzzyMatches[match.Index] = match.MatchedIndexes
+			idx := candidates[match.Index]
+			m.filteredIndices[i] = idx
+			m.fuzzyMatches[idx] = match.MatchedIndexes
 		}
 	}
 
+	m.groupHeadings = nil
+	// Environment variables in import mode have no tags
+	if m.groupByTag && m.mode != modeImport {
+		m.filteredIndices, m.groupHeadings = m.groupByTags(m.filteredIndices)
+	}
+
 	if len(m.filteredIndices) == 0 {
 		m.cursor = 0
 		m = m.adjustViewport()
@@ -89,7 +127,10 @@ func (m Model) viewFilterBar() string {
 	b.WriteString(filterStyle.Render("Filter: "))
 	b.WriteString(m.filterInput.View())
 
-	matchCount := len(m.filteredIndices)
+	// Entries with several tags are listed several times when grouped
+	matchCount := len(
+		slices.Compact(slices.Sorted(slices.Values(m.filteredIndices))),
+	)
 	totalCount := len(m.entries)
 	countText := fmt.Sprintf("(%d/%d entries)", matchCount, totalCount)
 	b.WriteString(" ")
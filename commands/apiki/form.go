@@ -31,7 +31,7 @@ func (m Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.prevField()
 
 	case "enter":
-		if m.currentField == fieldLabel {
+		if m.currentField == fieldTags {
 			return m.saveFormEntry()
 		}
 		return m.nextField()
@@ -54,6 +54,8 @@ func (m Model) updateForm(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		}
 	case fieldLabel:
 		m.labelInput, cmd = m.labelInput.Update(msg)
+	case fieldTags:
+		m.tagsInput, cmd = m.tagsInput.Update(msg)
 	}
 
 	m = m.updateInputWidths()
@@ -64,6 +66,7 @@ func (m Model) nextField() (tea.Model, tea.Cmd) {
 	m.nameInput.Blur()
 	m.valueInput.Blur()
 	m.labelInput.Blur()
+	m.tagsInput.Blur()
 
 	switch m.currentField {
 	case fieldName:
@@ -73,6 +76,9 @@ func (m Model) nextField() (tea.Model, tea.Cmd) {
 		m.currentField = fieldLabel
 		m.labelInput.Focus()
 	case fieldLabel:
+		m.currentField = fieldTags
+		m.tagsInput.Focus()
+	case fieldTags:
 		m.currentField = fieldName
 		m.nameInput.Focus()
 	}
@@ -84,17 +90,21 @@ func (m Model) prevField() (tea.Model, tea.Cmd) {
 	m.nameInput.Blur()
 	m.valueInput.Blur()
 	m.labelInput.Blur()
+	m.tagsInput.Blur()
 
 	switch m.currentField {
 	case fieldName:
-		m.currentField = fieldLabel
-		m.labelInput.Focus()
+		m.currentField = fieldTags
+		m.tagsInput.Focus()
 	case fieldValue:
 		m.currentField = fieldName
 		m.nameInput.Focus()
 	case fieldLabel:
 		m.currentField = fieldValue
 		m.valueInput.Focus()
+	case fieldTags:
+		m.currentField = fieldLabel
+		m.labelInput.Focus()
 	}
 
 	return m, textinput.Blink
@@ -112,6 +122,10 @@ func (m Model) saveFormEntry() (tea.Model, tea.Cmd) {
 	if name == "" {
 		m.nameError = "name cannot be empty"
 		valid = false
+	} else if entries.ValidateName(name) != nil {
+		m.nameError = "name must contain only letters, digits and underscores, " +
+			"and not start with a digit"
+		valid = false
 	}
 
 	if value == "" {
@@ -129,6 +143,7 @@ func (m Model) saveFormEntry() (tea.Model, tea.Cmd) {
 			Name:  name,
 			Value: value,
 			Label: strings.TrimSpace(m.labelInput.Value()),
+			Tags:  entries.ParseTags(m.tagsInput.Value()),
 		},
 		Selected: false,
 	}
@@ -138,11 +153,16 @@ func (m Model) saveFormEntry() (tea.Model, tea.Cmd) {
 
 	if m.editIndex >= 0 {
 		if m.editIndex < len(m.entries) {
-			// Preserve selection state when editing
+			// Preserve ID, selection state and file when editing
+			entry.ID = m.entries[m.editIndex].ID
 			entry.Selected = m.entries[m.editIndex].Selected
+			entry.Layer = m.entries[m.editIndex].Layer
+			entry.Secret = m.entries[m.editIndex].Secret
 			m.entries[m.editIndex] = entry
 		}
 	} else {
+		entry.ID = entries.NewID()
+		entry.Secret = m.layers[0].File.Encrypted()
 		m.entries = append(m.entries, entry)
 	}
 
@@ -155,6 +175,11 @@ func (m Model) saveFormEntry() (tea.Model, tea.Cmd) {
 		return m, nil
 	}
 
+	// On conflict, keep the change until the file is reloaded or merged
+	if m.mode == modeConflict {
+		return m, nil
+	}
+
 	m = m.clearFilter()
 
 	// Move cursor to the saved entry's new position
@@ -222,5 +247,9 @@ func (m Model) viewForm(title string) string {
 	b.WriteString(m.labelInput.View())
 	b.WriteString("\n")
 
+	b.WriteString(labelStyle.Render("Tags:"))
+	b.WriteString(m.tagsInput.View())
+	b.WriteString("\n")
+
 	return b.String()
 }
@@ -72,7 +72,14 @@ func (m Model) viewHelpBar() string {
 					keyStyle.Render("Esc")+labelStyle.Render("Cancel"),
 				)
 			} else {
+				groupLabel := "Group"
+				if m.groupByTag {
+					groupLabel = "Ungroup"
+				}
 				baseItems = append(baseItems,
+					keyStyle.Render("g")+labelStyle.Render(groupLabel),
+					keyStyle.Render("s")+labelStyle.Render("Save profile"),
+					keyStyle.Render("p")+labelStyle.Render("Load profile"),
 					keyStyle.Render("i")+labelStyle.Render("Import"),
 					keyStyle.Render("Enter")+labelStyle.Render("Apply"),
 					keyStyle.Render("q")+labelStyle.Render("Cancel"),
@@ -103,6 +110,28 @@ func (m Model) viewHelpBar() string {
 			keyStyle.Render("y/Enter") + labelStyle.Render("Yes"),
 			keyStyle.Render("n/Esc") + labelStyle.Render("No"),
 		}
+	case modeConflict:
+		items = []string{
+			keyStyle.Render("m/Enter") + labelStyle.Render("Merge"),
+			keyStyle.Render("r") + labelStyle.Render("Reload"),
+			keyStyle.Render("q") + labelStyle.Render("Quit"),
+		}
+	case modeUnlock:
+		items = []string{
+			keyStyle.Render("Enter") + labelStyle.Render("Unlock"),
+			keyStyle.Render("Esc") + labelStyle.Render("Cancel"),
+		}
+	case modeSaveProfile:
+		items = []string{
+			keyStyle.Render("Enter") + labelStyle.Render("Save"),
+			keyStyle.Render("Esc") + labelStyle.Render("Cancel"),
+		}
+	case modeLoadProfile:
+		items = []string{
+			keyStyle.Render("↑↓") + labelStyle.Render("Move"),
+			keyStyle.Render("Enter") + labelStyle.Render("Load"),
+			keyStyle.Render("Esc") + labelStyle.Render("Cancel"),
+		}
 	case modeError:
 		items = []string{
 			keyStyle.Render("Enter") + labelStyle.Render("Continue"),
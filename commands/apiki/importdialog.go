@@ -58,7 +58,7 @@ func (m Model) viewConfirmImport() string {
 		)),
 	)
 	fmt.Fprintf(&b, "  %s\n\n",
-		fileStyle.Render(m.filePath),
+		fileStyle.Render(m.layers[0].Path),
 	)
 
 	return b.String()
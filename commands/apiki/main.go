@@ -9,38 +9,47 @@ import (
 	"github.com/charmbracelet/lipgloss"
 
 	"github.com/loderunner/apiki/commands"
-	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/shell"
 )
 
-// Run executes the apiki root command
-func Run(variablesPath, configPath string) (string, error) {
-	// Load file (may be encrypted)
-	file, err := entries.Load(variablesPath)
+// Run executes the apiki root command. Shell commands are output in the
+// syntax of the given emitter.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	sh shell.Emitter,
+) (string, error) {
+	// Load files (may be encrypted)
+	layers, err := commands.LoadLayers(variablesPaths)
 	if err != nil {
-		return "", fmt.Errorf("could not load variables file: %w", err)
+		return "", err
 	}
 
-	// Unlock if encrypted
-	var encryptionKey []byte
-	if file.Encrypted() {
-		encryptionKey, err = commands.Unlock(file)
-		if err != nil {
-			return "", fmt.Errorf("failed to unlock file: %w", err)
-		}
+	// Migrate positional IDs saved in the config by older versions
+	if _, err := commands.LoadConfig(configPath, layers); err != nil {
+		return "", err
+	}
 
-		// Decrypt values in memory
-		if err := file.DecryptValues(encryptionKey); err != nil {
-			return "", fmt.Errorf("failed to decrypt variables: %w", err)
+	// Secret values set in the environment are compared to it to restore the
+	// selection, other files are unlocked when a secret is first needed
+	list, layerOf := layers.Entries()
+	for i, entry := range list {
+		if entry.Secret && os.Getenv(entry.Name) != "" {
+			if err := layers.Unlock(layerOf[i]); err != nil {
+				return "", err
+			}
 		}
 	}
 
-	// Convert entries.File entries to TUI Entry format
-	apikiEntries := make([]Entry, len(file.Entries))
-	for i, e := range file.Entries {
+	// Convert entries of all files to TUI Entry format
+	list, layerOf = layers.Entries()
+	apikiEntries := make([]Entry, len(list))
+	for i, e := range list {
 		apikiEntries[i] = Entry{
 			Entry:      e,
 			Selected:   false,
 			SourceFile: "",
+			Layer:      layerOf[i],
 		}
 	}
 
@@ -56,7 +65,7 @@ func Run(variablesPath, configPath string) (string, error) {
 	SortEntries(allEntries)
 
 	// Capture the environment state for all entry names at startup
-	envSnapshot := captureEnvironment(allEntries)
+	envSnapshot := CaptureEnvironment(allEntries)
 
 	// Sync selection state with captured environment (for all entries)
 	syncWithEnvironment(allEntries, envSnapshot)
@@ -70,13 +79,7 @@ func Run(variablesPath, configPath string) (string, error) {
 
 	lipgloss.SetDefaultRenderer(lipgloss.NewRenderer(tty))
 
-	model := NewModel(
-		file,
-		variablesPath,
-		configPath,
-		encryptionKey,
-		allEntries,
-	)
+	model := NewModel(layers, configPath, allEntries)
 	p := tea.NewProgram(model, tea.WithInput(tty), tea.WithOutput(tty))
 
 	finalModel, err := p.Run()
@@ -103,16 +106,16 @@ func Run(variablesPath, configPath string) (string, error) {
 	// If quitting normally, save entries and output shell commands
 	if m.Quitting() {
 		// Output export/unset commands to stdout
-		output := generateShellCommands(m.Entries(), envSnapshot)
+		output := GenerateShellCommands(m.Entries(), envSnapshot, sh)
 		return output, nil
 	}
 
 	return "", nil
 }
 
-// captureEnvironment builds a snapshot of environment variable values for all
+// CaptureEnvironment builds a snapshot of environment variable values for all
 // entry names. Returns a map of name -> value (empty string if not set).
-func captureEnvironment(entries []Entry) map[string]string {
+func CaptureEnvironment(entries []Entry) map[string]string {
 	env := make(map[string]string)
 	for _, entry := range entries {
 		if _, ok := env[entry.Name]; !ok {
@@ -157,10 +160,14 @@ func syncWithEnvironment(entries []Entry, env map[string]string) {
 	}
 }
 
-// generateShellCommands produces export and unset statements for the given
-// variables. Only outputs commands when the value has actually changed from the
-// original environment state.
-func generateShellCommands(entries []Entry, env map[string]string) string {
+// GenerateShellCommands produces export and unset statements for the given
+// variables, in the syntax of the given emitter. Only outputs commands when the
+// value has actually changed from the original environment state.
+func GenerateShellCommands(
+	entries []Entry,
+	env map[string]string,
+	sh shell.Emitter,
+) string {
 	// Build a map of name -> selected variable (if any) for radio-group
 	// handling
 	selectedByName := make(map[string]*Entry)
@@ -184,17 +191,16 @@ func generateShellCommands(entries []Entry, env map[string]string) string {
 		if selected, ok := selectedByName[entry.Name]; ok {
 			// Only export if the value differs from the original
 			if selected.Value != originalValue {
-				escaped := strings.ReplaceAll(selected.Value, "'", "'\\''")
 				commands = append(
 					commands,
-					fmt.Sprintf("export %s='%s'", selected.Name, escaped),
+					sh.Export(selected.Name, selected.Value),
 				)
 			}
 		} else if originalValue != "" {
 			// No variable with this name is selected, unset if it was
 			// originally
 			// set
-			commands = append(commands, fmt.Sprintf("unset %s", entry.Name))
+			commands = append(commands, sh.Unset(entry.Name))
 		}
 	}
 
@@ -1,14 +1,17 @@
 package apiki
 
 import (
+	"errors"
 	"strings"
 
 	"github.com/charmbracelet/bubbles/textinput"
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
 
+	"github.com/loderunner/apiki/commands"
 	"github.com/loderunner/apiki/internal/config"
 	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/filelock"
 	"github.com/loderunner/apiki/internal/set"
 )
 
@@ -22,8 +25,12 @@ const (
 	modeConfirmDelete
 	modeConfirmPromote
 	modeConfirmImport
+	modeConflict
+	modeUnlock
 	modeError
 	modeImport
+	modeSaveProfile
+	modeLoadProfile
 )
 
 // inputField identifies which field is being edited in add/edit mode.
@@ -33,21 +40,25 @@ const (
 	fieldName inputField = iota
 	fieldValue
 	fieldLabel
+	fieldTags
 )
 
 // Model is the bubbletea model for the apiki TUI.
 type Model struct {
-	// file holds the apiki entries file (decrypted in memory)
-	file *entries.File
+	// layers holds the apiki entries files, decrypted in memory once unlocked
+	layers commands.Layers
 
-	// filePath is the path to the entries file
-	filePath string
+	// layerNames holds the short name of each file, shown next to entries
+	// when several files are loaded
+	layerNames []string
 
 	// configPath is the path to the config file
 	configPath string
 
-	// encryptionKey is the encryption key (nil if unencrypted)
-	encryptionKey []byte
+	// loadedIDs holds the IDs of the apiki entries loaded at startup, whose
+	// selection is replaced on save. The selection of other entries, e.g. of
+	// variables files that weren't loaded, is kept.
+	loadedIDs set.Set[string]
 
 	// entries holds all entries (apiki + .env) for TUI display
 	entries []Entry
@@ -61,6 +72,7 @@ type Model struct {
 	nameInput  textinput.Model
 	valueInput textinput.Model
 	labelInput textinput.Model
+	tagsInput  textinput.Model
 
 	// editIndex tracks which entry is being edited (-1 for new)
 	editIndex int
@@ -82,6 +94,17 @@ type Model struct {
 	// errorMessage stores an error message to display in error mode
 	errorMessage string
 
+	// conflictLayer is the index of the file changed by another process, in
+	// conflict mode
+	conflictLayer int
+
+	// Unlock dialog state: afterUnlock runs once the file at index
+	// unlockLayer is unlocked
+	passwordInput textinput.Model
+	unlockLayer   int
+	unlockError   string
+	afterUnlock   func(Model) (Model, tea.Cmd)
+
 	// nameGroupsMemo memoizes the name groups for faster lookup
 	nameGroupsMemo map[string][]int
 
@@ -91,20 +114,29 @@ type Model struct {
 	filteredIndices []int
 	fuzzyMatches    map[int][]int
 
+	// Tag grouping state: groupHeadings maps a display index to the tag
+	// heading shown above it
+	groupByTag    bool
+	groupHeadings map[int]string
+
 	// Viewport state for scrolling list
 	viewportStart int // first visible entry index in list mode
 
 	// Import mode state
 	originalEntries []Entry // stored entries when in import mode
+
+	// Profile dialog state
+	profileInput  textinput.Model
+	profiles      map[string]set.Set[string]
+	profileNames  []string
+	profileCursor int
 }
 
-// NewModel creates a new Model with the given file, file path, config path,
-// encryption key, and combined entries (apiki + .env) for TUI display.
+// NewModel creates a new Model with the given files, config path, and
+// combined entries (apiki + .env) for TUI display.
 func NewModel(
-	file *entries.File,
-	filePath string,
+	layers commands.Layers,
 	configPath string,
-	encryptionKey []byte,
 	allEntries []Entry,
 ) Model {
 	nameInput := textinput.New()
@@ -119,24 +151,48 @@ func NewModel(
 	labelInput.Placeholder = "description"
 	labelInput.CharLimit = 256
 
+	tagsInput := textinput.New()
+	tagsInput.Placeholder = "aws, prod"
+	tagsInput.CharLimit = 256
+
 	filterInput := textinput.New()
 	filterInput.Placeholder = "Filter..."
 	filterInput.CharLimit = 256
 
+	profileInput := textinput.New()
+	profileInput.Placeholder = "profile name"
+	profileInput.CharLimit = 256
+
+	passwordInput := textinput.New()
+	passwordInput.EchoMode = textinput.EchoPassword
+	passwordInput.EchoCharacter = '•'
+	passwordInput.CharLimit = 1024
+	passwordInput.Width = 32
+
 	SortEntries(allEntries)
 
+	loadedIDs := set.New[string]()
+	for _, entry := range allEntries {
+		if entry.SourceFile == "" {
+			loadedIDs.Add(entry.ID)
+		}
+	}
+
 	model := Model{
-		file:            file,
-		filePath:        filePath,
+		layers:          layers,
+		layerNames:      layers.Names(),
 		configPath:      configPath,
-		encryptionKey:   encryptionKey,
+		loadedIDs:       loadedIDs,
 		entries:         allEntries,
 		cursor:          0,
 		mode:            modeList,
 		nameInput:       nameInput,
 		valueInput:      valueInput,
 		labelInput:      labelInput,
+		tagsInput:       tagsInput,
 		filterInput:     filterInput,
+		profileInput:    profileInput,
+		passwordInput:   passwordInput,
 		editIndex:       -1,
 		filteredIndices: make([]int, len(allEntries)),
 	}
@@ -176,8 +232,16 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			return m.updateConfirmPromote(msg)
 		case modeConfirmImport:
 			return m.updateConfirmImport(msg)
+		case modeConflict:
+			return m.updateConflict(msg)
+		case modeUnlock:
+			return m.updateUnlock(msg)
 		case modeError:
 			return m.updateError(msg)
+		case modeSaveProfile:
+			return m.updateSaveProfile(msg)
+		case modeLoadProfile:
+			return m.updateLoadProfile(msg)
 		}
 	}
 
@@ -201,8 +265,16 @@ func (m Model) View() string {
 		b.WriteString(m.viewConfirmPromote())
 	case modeConfirmImport:
 		b.WriteString(m.viewConfirmImport())
+	case modeConflict:
+		b.WriteString(m.viewConflict())
+	case modeUnlock:
+		b.WriteString(m.viewUnlock())
 	case modeError:
 		b.WriteString(m.viewError())
+	case modeSaveProfile:
+		b.WriteString(m.viewSaveProfile())
+	case modeLoadProfile:
+		b.WriteString(m.viewLoadProfile())
 	}
 
 	// Render bottom line: may contain ▼ chevron and/or filter bar
@@ -240,7 +312,9 @@ func (m Model) updateInputWidths() Model {
 		&m.nameInput,
 		&m.valueInput,
 		&m.labelInput,
+		&m.tagsInput,
 		&m.filterInput,
+		&m.profileInput,
 	} {
 		width := 2
 		if input.Value() != "" {
@@ -274,10 +348,12 @@ func (m Model) prepareForm(editIndex int, entry *Entry) (Model, tea.Cmd) {
 		m.nameInput.SetValue(entry.Name)
 		m.valueInput.SetValue(entry.Value)
 		m.labelInput.SetValue(entry.Label)
+		m.tagsInput.SetValue(strings.Join(entry.Tags, ", "))
 	} else {
 		m.nameInput.SetValue("")
 		m.valueInput.SetValue("")
 		m.labelInput.SetValue("")
+		m.tagsInput.SetValue("")
 	}
 
 	m = m.updateInputWidths()
@@ -300,77 +376,85 @@ func (m Model) Entries() []Entry {
 	return m.entries
 }
 
-// persistEntries saves the current entries to the configured file path.
-// Only saves apiki entries (those without SourceFile).
-// Re-encrypts values if encryption is enabled.
-// On error, switches to error mode to display the message.
+// persistEntries saves the current entries, each to the file it came from.
+// Only saves apiki entries (those without SourceFile), and only writes the
+// files that changed. Re-encrypts values if encryption is enabled.
+// If a file was changed by another process, switches to conflict mode to
+// offer reloading or merging it. On error, switches to error mode to display
+// the message.
 func (m Model) persistEntries() Model {
-	// Work on a copy to avoid mutating the in-memory state
-	toSave := m.file.Clone()
-
 	// Extract apiki entries from combined entries (those without SourceFile)
 	apikiEntries := make([]entries.Entry, 0)
+	layers := make([]int, 0)
 	for _, entry := range m.entries {
 		if entry.SourceFile == "" {
-			apikiEntries = append(apikiEntries, entries.Entry{
-				Name:  entry.Name,
-				Value: entry.Value,
-				Label: entry.Label,
-			})
+			apikiEntries = append(apikiEntries, entry.Entry)
+			layers = append(layers, entry.Layer)
 		}
 	}
 
-	// Update file entries
-	toSave.Entries = apikiEntries
+	lock, err := filelock.TryAcquire(m.layers.Paths()...)
+	if err != nil {
+		m.errorMessage = "Failed to save variables: " + err.Error()
+		m.mode = modeError
+		return m
+	}
+	defer lock.Release()
 
-	// Re-encrypt if encryption is enabled
-	if toSave.Encrypted() && m.encryptionKey != nil {
-		if err := toSave.EncryptValues(m.encryptionKey); err != nil {
-			m.errorMessage = "Failed to encrypt variables: " + err.Error()
-			m.mode = modeError
+	if err := m.layers.Save(apikiEntries, layers); err != nil {
+		var conflict *commands.ConflictError
+		if errors.As(err, &conflict) {
+			m.conflictLayer = conflict.Index
+			m.mode = modeConflict
 			return m
 		}
-	}
-
-	// Save variables file
-	if err := entries.Save(m.filePath, toSave); err != nil {
 		m.errorMessage = "Failed to save variables: " + err.Error()
 		m.mode = modeError
 		return m
 	}
 
-	// Update in-memory file to match saved state (but keep decrypted)
-	m.file.Entries = apikiEntries
 	return m
 }
 
-// persistSelection saves the current selection state to the config file.
-// On error, switches to error mode to display the message.
-func (m Model) persistSelection() Model {
-	apikiEntries := make([]entries.Entry, 0)
+// selectionIDs returns the IDs of the selected apiki entries (those without
+// SourceFile).
+func (m Model) selectionIDs() set.Set[string] {
+	selected := set.New[string]()
 	for _, entry := range m.entries {
-		if entry.SourceFile == "" {
-			apikiEntries = append(apikiEntries, entries.Entry{
-				Name:  entry.Name,
-				Value: entry.Value,
-				Label: entry.Label,
-			})
+		if entry.SourceFile == "" && entry.Selected {
+			selected.Add(entry.ID)
 		}
 	}
+	return selected
+}
+
+// persistSelection saves the current selection state to the config file,
+// merged into the selection of entries that weren't loaded. On error, switches
+// to error mode to display the message.
+func (m Model) persistSelection() Model {
+	lock, err := filelock.TryAcquire(m.configPath)
+	if err != nil {
+		m.errorMessage = "Failed to save config: " + err.Error()
+		m.mode = modeError
+		return m
+	}
+	defer lock.Release()
 
-	cfg := &config.Config{
-		Selected: set.New[string](),
+	// Load the config to preserve profiles
+	cfg, err := config.Load(m.configPath)
+	if err != nil {
+		m.errorMessage = "Failed to load config: " + err.Error()
+		m.mode = modeError
+		return m
 	}
-	apikiIndex := 0
+
+	selected := make(map[string]string)
 	for _, entry := range m.entries {
-		if entry.SourceFile == "" {
-			if entry.Selected {
-				entryID := config.EntryID(apikiEntries, apikiIndex)
-				cfg.Selected.Add(entryID)
-			}
-			apikiIndex++
+		if entry.SourceFile == "" && entry.Selected {
+			selected[entry.ID] = m.layers[entry.Layer].Path
 		}
 	}
+	cfg.SelectFiles(m.layers.Paths(), m.loadedIDs, selected)
 	if err := config.Save(m.configPath, cfg); err != nil {
 		m.errorMessage = "Failed to save config: " + err.Error()
 		m.mode = modeError
@@ -0,0 +1,40 @@
+package apiki
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+func TestPersistSelection(t *testing.T) {
+	t.Run("keeps the selection of other files", func(t *testing.T) {
+		dir := t.TempDir()
+		configPath := filepath.Join(dir, "config.json")
+		cfg := &config.Config{Selected: set.New("other", "1")}
+		require.NoError(t, config.Save(configPath, cfg))
+
+		path := filepath.Join(dir, "variables.json")
+		layers := commands.Layers{{Path: path}}
+		m := NewModel(layers, configPath, []Entry{
+			{Entry: entries.Entry{ID: "1", Name: "VAR1"}},
+			{Entry: entries.Entry{ID: "2", Name: "VAR2"}, Selected: true},
+			{Entry: entries.Entry{ID: "3", Name: "VAR3"}, Selected: true},
+		})
+		// Deleted entries are deselected
+		m.entries = m.entries[:2]
+
+		m = m.persistSelection()
+		require.NotEqual(t, modeError, m.mode, m.errorMessage)
+
+		cfg, err := config.Load(configPath)
+		require.NoError(t, err)
+		require.Equal(t, set.New("other", "2"), cfg.Selected)
+		require.Equal(t, map[string]string{"2": path}, cfg.Files)
+	})
+}
@@ -0,0 +1,218 @@
+package apiki
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/filelock"
+)
+
+// openProfiles loads the profiles from the config file and switches to the
+// given profile mode.
+func (m Model) openProfiles(mode viewMode) (Model, tea.Cmd) {
+	cfg, err := config.Load(m.configPath)
+	if err != nil {
+		m.errorMessage = "Failed to load config: " + err.Error()
+		m.mode = modeError
+		return m, nil
+	}
+
+	m.profiles = cfg.Profiles
+	m.profileNames = cfg.ProfileNames()
+	m.profileCursor = 0
+	m.mode = mode
+
+	if mode == modeSaveProfile {
+		m.profileInput.SetValue("")
+		m = m.updateInputWidths()
+		m.profileInput.Focus()
+		return m, textinput.Blink
+	}
+	return m, nil
+}
+
+func (m Model) updateSaveProfile(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.cancelled = true
+		return m, tea.Quit
+
+	case "esc":
+		m.profileInput.Blur()
+		m.mode = modeList
+		return m, nil
+
+	case "enter":
+		name := strings.TrimSpace(m.profileInput.Value())
+		if name == "" {
+			return m, nil
+		}
+		m.profileInput.Blur()
+		m = m.saveProfile(name)
+		if m.mode == modeError {
+			return m, nil
+		}
+		m.mode = modeList
+		return m, nil
+	}
+
+	var cmd tea.Cmd
+	m.profileInput, cmd = m.profileInput.Update(msg)
+	m = m.updateInputWidths()
+	return m, cmd
+}
+
+func (m Model) updateLoadProfile(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.cancelled = true
+		return m, tea.Quit
+
+	case "esc", "q":
+		m.mode = modeList
+
+	case "up", "k":
+		if m.profileCursor > 0 {
+			m.profileCursor--
+		} else if len(m.profileNames) > 0 {
+			m.profileCursor = len(m.profileNames) - 1
+		}
+
+	case "down", "j":
+		if m.profileCursor < len(m.profileNames)-1 {
+			m.profileCursor++
+		} else {
+			m.profileCursor = 0
+		}
+
+	case "enter":
+		if len(m.profileNames) > 0 {
+			m = m.loadProfile(m.profileNames[m.profileCursor])
+		}
+		m.mode = modeList
+	}
+
+	return m, nil
+}
+
+// saveProfile stores the current selection as a profile in the config file.
+// On error, switches to error mode to display the message.
+func (m Model) saveProfile(name string) Model {
+	lock, err := filelock.TryAcquire(m.configPath)
+	if err != nil {
+		m.errorMessage = "Failed to save config: " + err.Error()
+		m.mode = modeError
+		return m
+	}
+	defer lock.Release()
+
+	cfg, err := config.Load(m.configPath)
+	if err != nil {
+		m.errorMessage = "Failed to load config: " + err.Error()
+		m.mode = modeError
+		return m
+	}
+
+	cfg.Profiles[name] = m.selectionIDs()
+	if err := config.Save(m.configPath, cfg); err != nil {
+		m.errorMessage = "Failed to save config: " + err.Error()
+		m.mode = modeError
+		return m
+	}
+
+	return m
+}
+
+// loadProfile replaces the selection of apiki entries with the given profile.
+// .env entries are deselected when the profile selects another entry with the
+// same name.
+func (m Model) loadProfile(name string) Model {
+	profile := m.profiles[name]
+
+	selectedNames := make(map[string]struct{})
+	for i := range m.entries {
+		if m.entries[i].SourceFile != "" {
+			continue
+		}
+		m.entries[i].Selected = profile.Has(m.entries[i].ID)
+		if m.entries[i].Selected {
+			selectedNames[m.entries[i].Name] = struct{}{}
+		}
+	}
+
+	for i := range m.entries {
+		if m.entries[i].SourceFile == "" {
+			continue
+		}
+		if _, ok := selectedNames[m.entries[i].Name]; ok {
+			m.entries[i].Selected = false
+		}
+	}
+
+	return m
+}
+
+func (m Model) viewSaveProfile() string {
+	var b strings.Builder
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(ColorBrightBlue)
+	b.WriteString(titleStyle.Render("Save Profile"))
+	b.WriteString("\n\n")
+
+	labelStyle := lipgloss.NewStyle().Width(8)
+	b.WriteString(labelStyle.Render("Name:"))
+	b.WriteString(m.profileInput.View())
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+func (m Model) viewLoadProfile() string {
+	var b strings.Builder
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(ColorBrightBlue)
+	b.WriteString(titleStyle.Render("Load Profile"))
+	b.WriteString("\n\n")
+
+	if len(m.profileNames) == 0 {
+		dimStyle := lipgloss.NewStyle().Foreground(ColorGray)
+		b.WriteString(
+			dimStyle.Render("  No profiles. Press s to save the selection."),
+		)
+		b.WriteString("\n")
+		return b.String()
+	}
+
+	cursorStyle := lipgloss.NewStyle().Bold(true)
+	nameStyle := lipgloss.NewStyle().Bold(true)
+	countStyle := lipgloss.NewStyle().Foreground(ColorGray).Italic(true)
+	for i, name := range m.profileNames {
+		cursor := "  "
+		if i == m.profileCursor {
+			cursor = cursorStyle.Render("> ")
+		}
+		count := len(m.profiles[name])
+		variableWord := "variables"
+		if count == 1 {
+			variableWord = "variable"
+		}
+		fmt.Fprintf(
+			&b,
+			"%s%s %s\n",
+			cursor,
+			nameStyle.Render(name),
+			countStyle.Render(fmt.Sprintf("%d %s", count, variableWord)),
+		)
+	}
+
+	return b.String()
+}
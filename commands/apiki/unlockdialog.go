@@ -0,0 +1,166 @@
+package apiki
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// requireUnlock runs action once the file at index layer is unlocked. The key
+// is retrieved from the keychain or APIKI_PASSWORD if possible, otherwise the
+// password is asked for in unlock mode.
+func (m Model) requireUnlock(
+	layer int,
+	action func(Model) (Model, tea.Cmd),
+) (Model, tea.Cmd) {
+	if !m.layers.Locked(layer) {
+		return action(m)
+	}
+
+	key, err := commands.UnlockWithoutPrompt(m.layers[layer].File)
+	if errors.Is(err, commands.ErrPasswordRequired) {
+		m.unlockLayer = layer
+		m.unlockError = ""
+		m.afterUnlock = action
+		m.passwordInput.SetValue("")
+		m.passwordInput.Focus()
+		m.mode = modeUnlock
+		return m, textinput.Blink
+	}
+	if err != nil {
+		m.errorMessage = "Failed to unlock file: " + err.Error()
+		m.mode = modeError
+		return m, nil
+	}
+
+	m, err = m.unlockWithKey(layer, key)
+	if err != nil {
+		m.errorMessage = err.Error()
+		m.mode = modeError
+		return m, nil
+	}
+	return action(m)
+}
+
+// unlockWithKey decrypts the file at index layer, and replaces the encrypted
+// values of its entries with the decrypted ones.
+func (m Model) unlockWithKey(layer int, key []byte) (Model, error) {
+	if err := m.layers.UnlockWithKey(layer, key); err != nil {
+		return m, err
+	}
+
+	decrypted := m.layers[layer].File.Entries
+	for i, entry := range m.entries {
+		if entry.SourceFile != "" || entry.Layer != layer || !entry.Secret {
+			continue
+		}
+		j := slices.IndexFunc(decrypted, func(e entries.Entry) bool {
+			return e.ID == entry.ID
+		})
+		if j >= 0 {
+			m.entries[i].Value = decrypted[j].Value
+		}
+	}
+	return m, nil
+}
+
+// unlockSelected unlocks one after the other the files holding selected
+// secret values, then runs action.
+func (m Model) unlockSelected(
+	action func(Model) (Model, tea.Cmd),
+) (Model, tea.Cmd) {
+	for _, entry := range m.entries {
+		if entry.SourceFile == "" && entry.Selected && entry.Secret &&
+			m.layers.Locked(entry.Layer) {
+			return m.requireUnlock(entry.Layer, func(m Model) (Model, tea.Cmd) {
+				return m.unlockSelected(action)
+			})
+		}
+	}
+	return action(m)
+}
+
+func (m Model) updateUnlock(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "ctrl+c":
+		m.cancelled = true
+		return m, tea.Quit
+
+	case "esc":
+		m.passwordInput.Blur()
+		m.afterUnlock = nil
+		m.mode = modeList
+		return m, nil
+
+	case "enter":
+		key, err := commands.VerifyPassword(
+			m.layers[m.unlockLayer].File,
+			m.passwordInput.Value(),
+		)
+		if err != nil {
+			m.unlockError = "wrong password"
+			m.passwordInput.SetValue("")
+			return m, nil
+		}
+
+		m.passwordInput.Blur()
+		m.mode = modeList
+		m, err = m.unlockWithKey(m.unlockLayer, key)
+		if err != nil {
+			m.errorMessage = err.Error()
+			m.mode = modeError
+			return m, nil
+		}
+
+		action := m.afterUnlock
+		m.afterUnlock = nil
+		return action(m)
+	}
+
+	var cmd tea.Cmd
+	m.passwordInput, cmd = m.passwordInput.Update(msg)
+	if m.unlockError != "" {
+		m.unlockError = ""
+	}
+	return m, cmd
+}
+
+func (m Model) viewUnlock() string {
+	var b strings.Builder
+
+	titleStyle := lipgloss.NewStyle().
+		Bold(true).
+		Foreground(ColorBrightBlue)
+	b.WriteString(titleStyle.Render("Unlock Variables"))
+	b.WriteString("\n\n")
+
+	nameStyle := lipgloss.NewStyle().Bold(true)
+	fmt.Fprintf(
+		&b,
+		"  %s holds secret values.\n\n",
+		nameStyle.Render(m.layers[m.unlockLayer].Path),
+	)
+
+	labelStyle := lipgloss.NewStyle().Width(11)
+	errorStyle := lipgloss.
+		NewStyle().
+		Foreground(ColorBrightRed).
+		Italic(true)
+	b.WriteString(labelStyle.Render("Password:"))
+	b.WriteString(m.passwordInput.View())
+	if m.unlockError != "" {
+		b.WriteString(" ")
+		b.WriteString(errorStyle.Render(m.unlockError))
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
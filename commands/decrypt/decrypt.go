@@ -5,16 +5,32 @@ import (
 	"fmt"
 	"os"
 
-	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/encrypt"
 	"github.com/loderunner/apiki/internal/entries"
-	"github.com/loderunner/apiki/internal/keychain"
 	"github.com/loderunner/apiki/internal/prompt"
 )
 
 var ErrNoEntries = errors.New("no variables to decrypt")
 
-// Run executes the decrypt command.
-func Run(path string) error {
+// Options configures the decrypt command.
+type Options struct {
+	// FullFile only stops encrypting the file as a whole: names and labels
+	// are stored in plaintext again, and secret values stay encrypted.
+	FullFile bool
+}
+
+// Run executes the decrypt command. Without names, every value is decrypted
+// and encryption is removed from the file. Otherwise, only the variables
+// matching names stop being secret, see encrypt.Match, and the file stays
+// encrypted.
+func Run(path string, names []string, opts Options) error {
+	lock, err := commands.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Load file
 	file, err := entries.Load(path)
 	if err != nil {
@@ -25,39 +41,25 @@ func Run(path string) error {
 		return errors.New("file is not encrypted")
 	}
 
+	if opts.FullFile {
+		if len(names) > 0 {
+			return errors.New("--full-file doesn't take variable names")
+		}
+		return decryptFullFile(path, file)
+	}
+
 	if len(file.Entries) == 0 {
 		return ErrNoEntries
 	}
 
-	var key []byte
-
-	switch file.Encryption.Mode {
-	case "keychain":
-		// Retrieve key from keychain
-		fmt.Fprintf(os.Stderr, "Unlocking variables with keychain...\n")
-		key, err = keychain.Retrieve()
-		if err != nil {
-			return fmt.Errorf("failed to retrieve key from keychain: %w", err)
-		}
-
-	case "password":
-		// Prompt for password until correct
-		for {
-			password, err := prompt.ReadPassword("Enter password: ")
-			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
-			}
-
-			key, err = file.VerifyPassword(password)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Wrong password.\n")
-				continue
-			}
-			break
-		}
+	indices, err := encrypt.Match(file.Entries, names)
+	if err != nil {
+		return err
+	}
 
-	default:
-		return fmt.Errorf("unknown encryption mode: %q", file.Encryption.Mode)
+	key, err := commands.Unlock(file)
+	if err != nil {
+		return fmt.Errorf("failed to unlock file: %w", err)
 	}
 
 	// Ask for confirmation
@@ -77,21 +79,25 @@ func Run(path string) error {
 		return nil
 	}
 
-	// Decrypt all entries
-	for i := range file.Entries {
-		decrypted, err := crypto.Decrypt(key, file.Entries[i].Value)
-		if err != nil {
-			return fmt.Errorf(
-				"error decrypting variable %q: %w",
-				file.Entries[i].Name,
-				err,
-			)
+	if err := file.DecryptValues(key); err != nil {
+		return fmt.Errorf("failed to decrypt variables: %w", err)
+	}
+
+	count := 0
+	for _, i := range indices {
+		if file.Entries[i].Secret {
+			file.Entries[i].Secret = false
+			count++
 		}
-		file.Entries[i].Value = decrypted
 	}
 
-	// Clear encryption header
-	file.ClearEncryption()
+	if len(names) == 0 {
+		// Clear encryption header
+		file.ClearEncryption()
+	} else if err := file.EncryptValues(key); err != nil {
+		// Other secrets stay encrypted
+		return fmt.Errorf("failed to encrypt variables: %w", err)
+	}
 
 	// Save file
 	if err := entries.Save(path, file); err != nil {
@@ -101,8 +107,43 @@ func Run(path string) error {
 	fmt.Fprintf(
 		os.Stderr,
 		"✓ Decrypted %d variables. Values are now stored in plaintext.\n",
-		len(file.Entries),
+		count,
+	)
+
+	return nil
+}
+
+// decryptFullFile stops encrypting file as a whole, and saves it to path.
+func decryptFullFile(path string, file *entries.File) error {
+	if !file.Encryption.FullFile {
+		return errors.New("file is not encrypted as a whole")
+	}
+
+	// Ask for confirmation
+	confirm, err := prompt.ReadChoiceWithDefault(
+		"Names and labels will be stored in plaintext. Continue? [Y/n] ",
+		map[rune]string{
+			'y': "yes",
+			'n': "no",
+		},
+		"yes",
 	)
+	if err != nil {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
 
+	if confirm == "no" {
+		return nil
+	}
+
+	file.Encryption.FullFile = false
+	if err := entries.Save(path, file); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"✓ Decrypted names and labels. Secret values stay encrypted.\n",
+	)
 	return nil
 }
@@ -0,0 +1,124 @@
+package decrypt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setStdin replaces the standard input with input until the end of the test.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+// setUp writes a variables file with a secret, encrypted with a key in the
+// keychain, as a whole if fullFile is set. Returns its path.
+func setUp(t *testing.T, fullFile bool) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	commands.KeychainIndexPath = filepath.Join(dir, "keychain.json")
+	entries.Unlocker = commands.UnlockOnLoad
+	t.Cleanup(func() { entries.Unlocker = nil })
+
+	path := filepath.Join(dir, "variables.json")
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	account, err := commands.StoreKeychainKey(path, key)
+	require.NoError(t, err)
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "HOST", Value: "localhost"},
+			{ID: "2", Name: "TOKEN", Value: "s3cr3t", Secret: true},
+		},
+	}
+	file.SetKeychainMode(account)
+	file.Encryption.FullFile = fullFile
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(path, file))
+	return path
+}
+
+func TestRun(t *testing.T) {
+	t.Run("shows names and keeps values encrypted", func(t *testing.T) {
+		path := setUp(t, true)
+		setStdin(t, "\n")
+
+		require.NoError(t, Run(path, nil, Options{FullFile: true}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Contains(t, string(data), "TOKEN")
+		require.NotContains(t, string(data), "s3cr3t")
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.False(t, file.Encryption.FullFile)
+		require.True(t, file.Entries[1].Encrypted())
+	})
+
+	t.Run("keeps the file without confirmation", func(t *testing.T) {
+		path := setUp(t, true)
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		setStdin(t, "n")
+
+		require.NoError(t, Run(path, nil, Options{FullFile: true}))
+
+		saved, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, data, saved)
+	})
+
+	t.Run("decrypts every value", func(t *testing.T) {
+		path := setUp(t, true)
+		setStdin(t, "y")
+
+		require.NoError(t, Run(path, nil, Options{}))
+
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.False(t, file.Encrypted())
+		require.Equal(t, "s3cr3t", file.Entries[1].Value)
+	})
+
+	t.Run("rejects files not encrypted as a whole", func(t *testing.T) {
+		path := setUp(t, false)
+
+		err := Run(path, nil, Options{FullFile: true})
+		require.ErrorContains(t, err, "not encrypted as a whole")
+	})
+
+	t.Run("rejects names with full file", func(t *testing.T) {
+		path := setUp(t, true)
+
+		err := Run(path, []string{"TOKEN"}, Options{FullFile: true})
+		require.ErrorContains(t, err, "doesn't take variable names")
+	})
+}
@@ -4,116 +4,259 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
 	"github.com/loderunner/apiki/internal/crypto"
 	"github.com/loderunner/apiki/internal/entries"
-	"github.com/loderunner/apiki/internal/keychain"
 	"github.com/loderunner/apiki/internal/prompt"
 )
 
 var ErrNoEntries = errors.New("no variables to encrypt")
 
-// Run executes the encrypt command.
-func Run(path string) error {
+// Options configures the encrypt command.
+type Options struct {
+	// Calibrate is the unlock time targeted by the key derivation of a new
+	// password-protected file. Zero uses the default parameters.
+	Calibrate time.Duration
+
+	// FullFile encrypts the whole file, hiding the names and labels of
+	// variables.
+	FullFile bool
+}
+
+// Run executes the encrypt command. Without names, every variable is made
+// secret and encrypted. Otherwise, only the variables matching names are, see
+// Match. Encryption is set up first if the file isn't encrypted yet.
+func Run(path string, names []string, opts Options) error {
+	lock, err := commands.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Load file
 	file, err := entries.Load(path)
 	if err != nil {
 		return fmt.Errorf("failed to load file: %w", err)
 	}
 
+	if len(file.Entries) == 0 {
+		return ErrNoEntries
+	}
+
+	indices, err := Match(file.Entries, names)
+	if err != nil {
+		return err
+	}
+
+	fullFile := opts.FullFile && !file.Encryption.FullFile
+
+	var key []byte
 	if file.Encrypted() {
-		return errors.New(
-			"file is already encrypted, " +
-				"use `apiki rotate` to rotate the encryption key",
+		if !fullFile && !slices.ContainsFunc(indices, func(i int) bool {
+			return !file.Entries[i].Secret
+		}) {
+			return errors.New(
+				"variables are already encrypted, " +
+					"use `apiki rotate` to rotate the encryption key",
+			)
+		}
+		if opts.Calibrate > 0 {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: warning: file is already encrypted, "+
+					"use `apiki rotate --kdf-iterations` "+
+					"to change the key derivation\n",
+			)
+		}
+		key, err = commands.Unlock(file)
+		if err != nil {
+			return fmt.Errorf("failed to unlock file: %w", err)
+		}
+	} else {
+		key, err = setUp(path, file, opts)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Encrypt the values of the new secrets
+	count := 0
+	for _, i := range indices {
+		if !file.Entries[i].Secret {
+			file.Entries[i].Secret = true
+			count++
+		}
+	}
+	if err := file.EncryptValues(key); err != nil {
+		return fmt.Errorf("failed to encrypt variables: %w", err)
+	}
+	if fullFile {
+		file.Encryption.FullFile = true
+	}
+
+	// Save file
+	if err := entries.Save(path, file); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	if count > 0 || !fullFile {
+		fmt.Fprintf(os.Stderr, "✓ Encrypted %d variables.\n", count)
+	}
+	if fullFile {
+		fmt.Fprintf(
+			os.Stderr,
+			"✓ Encrypted the whole file, names and labels are hidden.\n",
 		)
 	}
 
-	if len(file.Entries) == 0 {
-		return ErrNoEntries
+	return nil
+}
+
+// Match returns the indices of the entries matching names, or of all entries
+// if names is empty. A name matches the entries of that name, or the entry
+// with that ID. "NAME=label" matches the entry of that name and label.
+// Returns a *commands.ExitError wrapping get.ErrNotFound if a name matches no
+// entry.
+func Match(list []entries.Entry, names []string) ([]int, error) {
+	if len(names) == 0 {
+		indices := make([]int, len(list))
+		for i := range list {
+			indices[i] = i
+		}
+		return indices, nil
 	}
 
+	var indices []int
+	for _, arg := range names {
+		name, label, hasLabel := strings.Cut(arg, "=")
+		found := false
+		for i, entry := range list {
+			if entry.Name != name && entry.ID != name {
+				continue
+			}
+			if hasLabel && entry.Label != label {
+				continue
+			}
+			found = true
+			if !slices.Contains(indices, i) {
+				indices = append(indices, i)
+			}
+		}
+		if !found {
+			return nil, &commands.ExitError{
+				Code: get.ExitNotFound,
+				Err:  fmt.Errorf("%w: %q", get.ErrNotFound, arg),
+			}
+		}
+	}
+	return indices, nil
+}
+
+// setUp asks for an encryption mode and configures file, loaded from path, to
+// use it. Returns the encryption key.
+func setUp(path string, file *entries.File, opts Options) ([]byte, error) {
 	// Ask for encryption mode
 	mode, err := prompt.ReadChoice(
-		"Lock variables with [p]assword or [k]eychain? ",
+		"Lock variables with [p]assword, [k]eychain or [r]ecipients? ",
 		map[rune]string{
 			'p': "password",
 			'k': "keychain",
+			'r': "recipients",
 		},
 	)
 	if err != nil {
-		return fmt.Errorf("failed to read choice: %w", err)
+		return nil, fmt.Errorf("failed to read choice: %w", err)
 	}
 
-	var key []byte
+	if opts.Calibrate > 0 && mode != "password" {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: warning: --calibrate only applies to password mode\n",
+		)
+	}
 
 	switch mode {
 	case "password":
 		// Get password
 		password, err := prompt.ReadPassword("Enter password: ")
 		if err != nil {
-			return fmt.Errorf("failed to read password: %w", err)
+			return nil, fmt.Errorf("failed to read password: %w", err)
 		}
 
 		// Confirm password
 		passwordConfirm, err := prompt.ReadPassword("Confirm password: ")
 		if err != nil {
-			return fmt.Errorf("failed to read password confirmation: %w", err)
+			return nil, fmt.Errorf(
+				"failed to read password confirmation: %w",
+				err,
+			)
 		}
 
 		if password != passwordConfirm {
-			return errors.New("passwords do not match")
+			return nil, errors.New("passwords do not match")
+		}
+
+		// Pick the key derivation parameters
+		params := crypto.DefaultKDFParams
+		if opts.Calibrate > 0 {
+			fmt.Fprintf(os.Stderr, "Calibrating key derivation...\n")
+			params = crypto.Calibrate(params, opts.Calibrate)
+			fmt.Fprintf(
+				os.Stderr,
+				"✓ Calibrated key derivation: %s.\n",
+				params,
+			)
 		}
 
 		// Configure password mode and get the derived key
-		key, err = file.SetPasswordMode(password)
+		key, err := file.SetPasswordMode(password, params)
 		if err != nil {
-			return fmt.Errorf(
+			return nil, fmt.Errorf(
 				"failed to configure variables file "+
 					"for password encryption: %w",
 				err,
 			)
 		}
+		return key, nil
 
 	case "keychain":
 		// Generate key and store in keychain
-		key, err = crypto.GenerateKey()
+		key, err := crypto.GenerateKey()
 		if err != nil {
-			return fmt.Errorf("failed to generate key: %w", err)
+			return nil, fmt.Errorf("failed to generate key: %w", err)
 		}
 
-		if err := keychain.Store(key); err != nil {
-			return fmt.Errorf("failed to store key in keychain: %w", err)
+		account, err := commands.StoreKeychainKey(path, key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to store key in keychain: %w", err)
 		}
 
-		file.SetKeychainMode()
+		file.SetKeychainMode(account)
+		return key, nil
 
-	default:
-		return fmt.Errorf("invalid unlock method: %q", mode)
-	}
+	case "recipients":
+		// Generate a data key and wrap it for the user, more recipients are
+		// added with `apiki recipients add`
+		own, err := commands.OwnRecipient()
+		if err != nil {
+			return nil, err
+		}
 
-	// Encrypt all entries
-	for i := range file.Entries {
-		encrypted, err := crypto.Encrypt(key, file.Entries[i].Value)
+		key, err := crypto.GenerateKey()
 		if err != nil {
-			return fmt.Errorf(
-				"error encrypting variable %q: %w",
-				file.Entries[i].Name,
-				err,
-			)
+			return nil, fmt.Errorf("failed to generate key: %w", err)
 		}
-		file.Entries[i].Value = encrypted
-	}
 
-	// Save file
-	if err := entries.Save(path, file); err != nil {
-		return fmt.Errorf("failed to save file: %w", err)
+		if err := file.SetRecipientsMode(key, []string{own}); err != nil {
+			return nil, err
+		}
+		return key, nil
 	}
 
-	fmt.Fprintf(
-		os.Stderr,
-		"✓ Encrypted %d variables.\n",
-		len(file.Entries),
-	)
-
-	return nil
+	return nil, fmt.Errorf("invalid unlock method: %q", mode)
 }
@@ -0,0 +1,148 @@
+package encrypt
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setStdin replaces the standard input with input until the end of the test.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+// write writes a plaintext variables file with list, and returns its path.
+// Files encrypted as a whole are unlocked on load.
+func write(t *testing.T, list []entries.Entry) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	commands.KeychainIndexPath = filepath.Join(dir, "keychain.json")
+	entries.Unlocker = commands.UnlockOnLoad
+	t.Cleanup(func() { entries.Unlocker = nil })
+
+	path := filepath.Join(dir, "variables.json")
+	file := &entries.File{ID: entries.NewID(), Entries: list}
+	require.NoError(t, entries.Save(path, file))
+	return path
+}
+
+// reveal unlocks the variables file at path and returns its values, by name.
+func reveal(t *testing.T, path string) map[string]string {
+	t.Helper()
+
+	file, err := entries.Load(path)
+	require.NoError(t, err)
+	key, err := commands.Unlock(file)
+	require.NoError(t, err)
+	require.NoError(t, file.DecryptValues(key))
+	values := make(map[string]string)
+	for _, entry := range file.Entries {
+		values[entry.Name] = entry.Value
+	}
+	return values
+}
+
+func TestRun(t *testing.T) {
+	list := []entries.Entry{
+		{ID: "1", Name: "HOST", Value: "localhost"},
+		{ID: "2", Name: "STRIPE_KEY", Value: "secret", Label: "client X"},
+	}
+
+	t.Run("encrypts the values of variables", func(t *testing.T) {
+		path := write(t, list)
+		setStdin(t, "k")
+
+		require.NoError(t, Run(path, []string{"STRIPE_KEY"}, Options{}))
+
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.False(t, file.Entries[0].Secret)
+		require.True(t, file.Entries[1].Encrypted())
+		require.Equal(
+			t,
+			map[string]string{"HOST": "localhost", "STRIPE_KEY": "secret"},
+			reveal(t, path),
+		)
+	})
+
+	t.Run("hides names and labels with full file", func(t *testing.T) {
+		path := write(t, list)
+		setStdin(t, "k")
+
+		require.NoError(t, Run(path, []string{"STRIPE_KEY"}, Options{
+			FullFile: true,
+		}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "STRIPE_KEY")
+		require.NotContains(t, string(data), "client X")
+		require.NotContains(t, string(data), "localhost")
+		require.Equal(
+			t,
+			map[string]string{"HOST": "localhost", "STRIPE_KEY": "secret"},
+			reveal(t, path),
+		)
+	})
+
+	t.Run("encrypts an encrypted file as a whole", func(t *testing.T) {
+		path := write(t, list)
+		setStdin(t, "k")
+		require.NoError(t, Run(path, nil, Options{}))
+
+		require.NoError(t, Run(path, nil, Options{FullFile: true}))
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "STRIPE_KEY")
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.True(t, file.Encryption.FullFile)
+
+		err = Run(path, nil, Options{FullFile: true})
+		require.ErrorContains(t, err, "variables are already encrypted")
+	})
+
+	t.Run("rejects unknown variables", func(t *testing.T) {
+		path := write(t, list)
+
+		err := Run(path, []string{"MISSING"}, Options{})
+		var exitErr *commands.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		require.Equal(t, get.ExitNotFound, exitErr.Code)
+	})
+
+	t.Run("rejects empty files", func(t *testing.T) {
+		path := write(t, nil)
+
+		err := Run(path, nil, Options{FullFile: true})
+		require.ErrorIs(t, err, ErrNoEntries)
+	})
+}
@@ -0,0 +1,155 @@
+package exec
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	osexec "os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+
+	"golang.org/x/term"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/commands/restore"
+)
+
+// Exit codes returned when the command cannot be started, following shell
+// conventions.
+const (
+	ExitCannotExecute = 126
+	ExitNotFound      = 127
+)
+
+// ErrCommandFailed is wrapped in the *commands.ExitError returned when the
+// command exits with a non-zero status.
+var ErrCommandFailed = errors.New("command failed")
+
+// Options holds the flags of the exec command.
+type Options struct {
+	// With lists "NAME" or "NAME=label" variables that replace the selected
+	// variable of the same name.
+	With []string
+}
+
+// Run executes argv with the selected variables added to its environment.
+// Signals received while the command runs are forwarded to it, except the
+// ones a terminal already sent to it, see terminalSignals. Returns a
+// *commands.ExitError carrying the command's exit code if it fails.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	argv []string,
+	opts Options,
+) error {
+	resolved, err := restore.Resolve(variablesPaths, configPath)
+	if err != nil {
+		return err
+	}
+	if err := resolved.Reveal(resolved.Selected...); err != nil {
+		return err
+	}
+	list := resolved.Entries
+
+	// Later variables override earlier ones with the same name
+	values := make(map[string]string)
+	var names []string
+	setValue := func(name, value string) {
+		if _, ok := values[name]; !ok {
+			names = append(names, name)
+		}
+		values[name] = value
+	}
+
+	for _, i := range resolved.Selected {
+		setValue(list[i].Name, list[i].Value)
+	}
+
+	for _, with := range opts.With {
+		name, label, _ := strings.Cut(with, "=")
+		index, err := get.Find(list, name, label)
+		if err != nil {
+			return err
+		}
+		if err := resolved.Reveal(index); err != nil {
+			return err
+		}
+		setValue(list[index].Name, list[index].Value)
+	}
+
+	env := make([]string, 0, len(os.Environ())+len(names))
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if _, ok := values[name]; !ok {
+			env = append(env, kv)
+		}
+	}
+	for _, name := range names {
+		env = append(env, name+"="+values[name])
+	}
+
+	path, err := osexec.LookPath(argv[0])
+	if err != nil {
+		// A path to a file that isn't executable is found, but can't run
+		code := ExitNotFound
+		if errors.Is(err, fs.ErrPermission) {
+			code = ExitCannotExecute
+		}
+		return &commands.ExitError{Code: code, Err: err}
+	}
+
+	cmd := osexec.Command(path, argv[1:]...)
+	cmd.Args[0] = argv[0]
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, forwardedSignals...)
+	defer signal.Stop(signals)
+
+	if err := cmd.Start(); err != nil {
+		return &commands.ExitError{
+			Code: ExitCannotExecute,
+			Err:  fmt.Errorf("failed to start %q: %w", argv[0], err),
+		}
+	}
+
+	// Signals typed in a terminal already reach the command through its
+	// process group, relaying them would deliver them twice
+	tty := term.IsTerminal(int(os.Stdin.Fd()))
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			select {
+			case sig := <-signals:
+				if tty && slices.Contains(terminalSignals, sig) {
+					continue
+				}
+				_ = cmd.Process.Signal(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	err = cmd.Wait()
+	if err == nil {
+		return nil
+	}
+
+	var exitErr *osexec.ExitError
+	if !errors.As(err, &exitErr) {
+		return fmt.Errorf("failed to wait for %q: %w", argv[0], err)
+	}
+
+	return &commands.ExitError{
+		Code: exitCode(exitErr),
+		Err:  fmt.Errorf("%w: %w", ErrCommandFailed, err),
+	}
+}
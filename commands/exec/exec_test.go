@@ -0,0 +1,171 @@
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+// setUp writes a file with HOST and two variants of URL, and a config
+// selecting HOST and the prod URL. OUT is set to the path of a file for the
+// command to write to. Returns the paths of the file and of the config, and
+// of the output file.
+func setUp(t *testing.T) ([]string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "variables.json")}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "HOST", Value: "localhost"},
+			{ID: "2", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "3", Name: "URL", Value: "prod", Label: "prod"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{Selected: set.New("1", "3")}
+	require.NoError(t, config.Save(configPath, cfg))
+
+	out := filepath.Join(dir, "out")
+	t.Setenv("OUT", out)
+	t.Setenv("HOST", "example.com")
+	t.Setenv("URL", "")
+	return paths, configPath, out
+}
+
+// read returns the content of the file at path.
+func read(t *testing.T, path string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRun(t *testing.T) {
+	t.Run("sets the selected variables", func(t *testing.T) {
+		for _, tt := range []struct {
+			name string
+			opts Options
+			want string
+		}{
+			{name: "selection", want: "localhost prod"},
+			{
+				name: "with a label",
+				opts: Options{With: []string{"URL=dev"}},
+				want: "localhost dev",
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				paths, configPath, out := setUp(t)
+
+				argv := []string{
+					"sh",
+					"-c",
+					`printf '%s %s' "$HOST" "$URL" > "$OUT"`,
+				}
+				require.NoError(t, Run(paths, configPath, argv, tt.opts))
+				require.Equal(t, tt.want, read(t, out))
+			})
+		}
+	})
+
+	t.Run("returns exit codes", func(t *testing.T) {
+		dir := t.TempDir()
+		notExecutable := filepath.Join(dir, "not-executable")
+		require.NoError(
+			t,
+			os.WriteFile(notExecutable, []byte("#!/bin/sh\n"), 0o600),
+		)
+		badFormat := filepath.Join(dir, "bad-format")
+		require.NoError(t, os.WriteFile(badFormat, []byte{0, 1, 2, 3}, 0o700))
+
+		for _, tt := range []struct {
+			name string
+			argv []string
+			opts Options
+			code int
+		}{
+			{
+				name: "command status",
+				argv: []string{"sh", "-c", "exit 3"},
+				code: 3,
+			},
+			{
+				name: "command not found",
+				argv: []string{"apiki-command-not-found"},
+				code: ExitNotFound,
+			},
+			{
+				name: "file not executable",
+				argv: []string{notExecutable},
+				code: ExitCannotExecute,
+			},
+			{
+				name: "invalid executable",
+				argv: []string{badFormat},
+				code: ExitCannotExecute,
+			},
+			{
+				name: "killed by a signal",
+				argv: []string{"sh", "-c", "kill -TERM $$"},
+				code: 128 + int(syscall.SIGTERM),
+			},
+			{
+				name: "variable not found",
+				argv: []string{"true"},
+				opts: Options{With: []string{"URL=staging"}},
+				code: get.ExitNotFound,
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				paths, configPath, _ := setUp(t)
+
+				err := Run(paths, configPath, tt.argv, tt.opts)
+				var exitErr *commands.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				require.Equal(t, tt.code, exitErr.Code)
+			})
+		}
+	})
+
+	t.Run("forwards signals", func(t *testing.T) {
+		paths, configPath, out := setUp(t)
+		ready := out + ".ready"
+
+		go func() {
+			for {
+				if _, err := os.Stat(ready); err == nil {
+					break
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+			_ = syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		}()
+
+		argv := []string{
+			"sh",
+			"-c",
+			`trap 'echo USR1 > "$OUT"; exit 0' USR1
+			touch "$OUT.ready"
+			while :; do sleep 0.01; done`,
+		}
+		require.NoError(t, Run(paths, configPath, argv, Options{}))
+		require.Equal(t, "USR1\n", read(t, out))
+	})
+}
@@ -0,0 +1,20 @@
+//go:build !unix
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+)
+
+// forwardedSignals lists the signals relayed to the child process.
+var forwardedSignals = []os.Signal{os.Interrupt}
+
+// terminalSignals lists the signals a console sends to every attached
+// process, which are not relayed when stdin is a terminal.
+var terminalSignals = []os.Signal{os.Interrupt}
+
+// exitCode returns the exit code of a failed command.
+func exitCode(exitErr *osexec.ExitError) int {
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,37 @@
+//go:build unix
+
+package exec
+
+import (
+	"os"
+	osexec "os/exec"
+	"syscall"
+)
+
+// forwardedSignals lists the signals relayed to the child process.
+var forwardedSignals = []os.Signal{
+	syscall.SIGHUP,
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+	syscall.SIGTERM,
+	syscall.SIGUSR1,
+	syscall.SIGUSR2,
+	syscall.SIGWINCH,
+}
+
+// terminalSignals lists the signals a terminal sends to the whole foreground
+// process group, which are not relayed when stdin is a terminal.
+var terminalSignals = []os.Signal{
+	syscall.SIGINT,
+	syscall.SIGQUIT,
+}
+
+// exitCode returns the exit code of a failed command, mirroring the shell
+// convention for commands killed by a signal.
+func exitCode(exitErr *osexec.ExitError) int {
+	if status, ok := exitErr.Sys().(syscall.WaitStatus); ok &&
+		status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return exitErr.ExitCode()
+}
@@ -0,0 +1,287 @@
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"slices"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/commands/restore"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+// Output formats supported by the export command.
+const (
+	FormatDotEnv = "dotenv"
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+	FormatShell  = "shell"
+	FormatDocker = "docker"
+)
+
+// Options holds the flags of the export command.
+type Options struct {
+	// Format is one of FormatDotEnv, FormatJSON, FormatYAML, FormatShell or
+	// FormatDocker.
+	Format string
+
+	// All exports all variables instead of the selected ones.
+	All bool
+
+	// Tags restricts the export to variables having all of these tags.
+	Tags []string
+}
+
+// variable is a name and value pair to export.
+type variable struct {
+	Name  string
+	Value string
+}
+
+// Run formats variables for use by other tools. By default, the selected
+// variables are exported. With opts.All, or when name patterns or tags are
+// given, all variables are considered, filtered by the patterns and tags.
+// Patterns use shell glob syntax, e.g. "AWS_*". Only the secret values
+// exported are decrypted.
+//
+// Among variables sharing a name, the selected one is exported. If none is
+// selected, the name is skipped with a warning with opts.All, and is an error
+// otherwise.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	patterns []string,
+	opts Options,
+) (string, error) {
+	if !slices.Contains(
+		[]string{
+			FormatDotEnv,
+			FormatJSON,
+			FormatYAML,
+			FormatShell,
+			FormatDocker,
+		},
+		opts.Format,
+	) {
+		return "", fmt.Errorf("invalid format: %q", opts.Format)
+	}
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return "", fmt.Errorf("invalid pattern %q: %w", pattern, err)
+		}
+	}
+
+	resolved, err := restore.Resolve(variablesPaths, configPath)
+	if err != nil {
+		return "", err
+	}
+	list, selected := resolved.Entries, resolved.Selected
+
+	candidates := selected
+	if opts.All || len(patterns) > 0 || len(opts.Tags) > 0 {
+		candidates = make([]int, len(list))
+		for i := range list {
+			candidates[i] = i
+		}
+	}
+
+	// Group candidates by name, keeping the order of the file
+	var names []string
+	groups := make(map[string][]int)
+	for _, i := range candidates {
+		name := list[i].Name
+		if len(patterns) > 0 && !matchAny(patterns, name) {
+			continue
+		}
+		if !hasAllTags(list[i], opts.Tags) {
+			continue
+		}
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], i)
+	}
+
+	indices := make([]int, 0, len(names))
+	for _, name := range names {
+		group := groups[name]
+		index := group[0]
+		if len(group) > 1 {
+			// The selected variable takes precedence over the others
+			j := slices.IndexFunc(group, func(i int) bool {
+				return slices.Contains(selected, i)
+			})
+			if j < 0 && opts.All {
+				fmt.Fprintf(
+					os.Stderr,
+					"apiki: warning: skipped %s, several variables have "+
+						"this name and none is selected\n",
+					name,
+				)
+				continue
+			}
+			if j < 0 {
+				return "", &commands.ExitError{
+					Code: get.ExitAmbiguous,
+					Err: fmt.Errorf(
+						"%w: several variables named %q, select one first",
+						get.ErrAmbiguous,
+						name,
+					),
+				}
+			}
+			index = group[j]
+		}
+		indices = append(indices, index)
+	}
+
+	if err := resolved.Reveal(indices...); err != nil {
+		return "", err
+	}
+	variables := make([]variable, len(indices))
+	for i, index := range indices {
+		variables[i] = variable{
+			Name:  list[index].Name,
+			Value: list[index].Value,
+		}
+	}
+
+	switch opts.Format {
+	case FormatJSON:
+		return formatJSON(variables)
+	case FormatYAML:
+		return formatYAML(variables)
+	case FormatShell:
+		return formatShell(variables), nil
+	case FormatDocker:
+		return formatDocker(variables)
+	default:
+		return formatDotEnv(variables), nil
+	}
+}
+
+// WriteFile writes the output to path, creating the file readable only by
+// the current user.
+func WriteFile(path string, output string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	// Restrict permissions of a pre-existing file too
+	if err := f.Chmod(0o600); err != nil {
+		return fmt.Errorf("failed to set file permissions: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(f, "%s\n", output); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return f.Close()
+}
+
+// matchAny returns true if name matches any of the glob patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// formatDotEnv formats variables as a .env file. Values are single-quoted
+// when possible, so that they are read literally, and double-quoted with
+// escapes otherwise.
+func formatDotEnv(variables []variable) string {
+	lines := make([]string, len(variables))
+	for i, v := range variables {
+		if !strings.ContainsAny(v.Value, "'\n\r") {
+			lines[i] = fmt.Sprintf("%s='%s'", v.Name, v.Value)
+			continue
+		}
+		escaped := strings.NewReplacer(
+			`\`, `\\`,
+			`"`, `\"`,
+			`$`, `\$`,
+			"`", "\\`",
+			"\n", `\n`,
+			"\r", `\r`,
+		).Replace(v.Value)
+		lines[i] = fmt.Sprintf(`%s="%s"`, v.Name, escaped)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatJSON formats variables as a JSON object.
+func formatJSON(variables []variable) (string, error) {
+	m := make(map[string]string, len(variables))
+	for _, v := range variables {
+		m[v.Name] = v.Value
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// formatYAML formats variables as a YAML map of strings.
+func formatYAML(variables []variable) (string, error) {
+	if len(variables) == 0 {
+		return "{}", nil
+	}
+	m := make(map[string]string, len(variables))
+	for _, v := range variables {
+		m[v.Name] = v.Value
+	}
+	data, err := yaml.Marshal(m)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal YAML: %w", err)
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// formatShell formats variables as POSIX shell export commands.
+func formatShell(variables []variable) string {
+	lines := make([]string, len(variables))
+	for i, v := range variables {
+		lines[i] = shell.PosixEmitter{}.Export(v.Name, v.Value)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// formatDocker formats variables as a Docker env-file. Docker reads values
+// verbatim, without quotes or escapes, so values can't span several lines.
+func formatDocker(variables []variable) (string, error) {
+	lines := make([]string, len(variables))
+	for i, v := range variables {
+		if strings.ContainsAny(v.Value, "\n\r") {
+			return "", fmt.Errorf(
+				"variable %q contains a newline, "+
+					"which Docker env-files can't represent",
+				v.Name,
+			)
+		}
+		lines[i] = v.Name + "=" + v.Value
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// hasAllTags returns true if entry has all the given tags.
+func hasAllTags(entry entries.Entry, tags []string) bool {
+	for _, tag := range tags {
+		if !entry.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
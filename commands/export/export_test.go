@@ -0,0 +1,138 @@
+package export
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp writes a plaintext file and a keychain file whose key is missing from
+// the keychain, so that it can't be unlocked, and a config selecting every
+// entry listed in selected. Returns the paths of the files and of the config.
+func setUp(
+	t *testing.T,
+	personal, team []entries.Entry,
+	selected ...string,
+) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{ID: entries.NewID(), Entries: personal}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	file = &entries.File{ID: entries.NewID(), Entries: team}
+	file.SetKeychainMode("encryption-key-missing")
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{Selected: set.New(selected...)}
+	require.NoError(t, config.Save(configPath, cfg))
+	return paths, configPath
+}
+
+func TestRun(t *testing.T) {
+	t.Run("only reveals the exported values", func(t *testing.T) {
+		paths, configPath := setUp(
+			t,
+			[]entries.Entry{{ID: "1", Name: "HOST", Value: "localhost"}},
+			[]entries.Entry{
+				{ID: "2", Name: "TOKEN", Value: "secret", Secret: true},
+			},
+			"1", "2",
+		)
+
+		output, err := Run(
+			paths,
+			configPath,
+			[]string{"HOST"},
+			Options{Format: FormatDotEnv},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "HOST='localhost'", output)
+
+		// The team file is locked
+		_, err = Run(paths, configPath, nil, Options{Format: FormatDotEnv})
+		require.Error(t, err)
+	})
+
+	t.Run("skips unselected variants with all", func(t *testing.T) {
+		paths, configPath := setUp(
+			t,
+			[]entries.Entry{
+				{ID: "1", Name: "HOST", Value: "localhost"},
+				{ID: "2", Name: "URL", Value: "dev", Label: "dev"},
+				{ID: "3", Name: "URL", Value: "prod", Label: "prod"},
+			},
+			nil,
+		)
+
+		output, err := Run(
+			paths,
+			configPath,
+			nil,
+			Options{Format: FormatJSON, All: true},
+		)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"HOST": "localhost"}`, output)
+
+		_, err = Run(
+			paths,
+			configPath,
+			[]string{"URL"},
+			Options{Format: FormatJSON},
+		)
+		var exitErr *commands.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		require.Equal(t, get.ExitAmbiguous, exitErr.Code)
+	})
+
+	t.Run("exports the selected variant", func(t *testing.T) {
+		paths, configPath := setUp(
+			t,
+			[]entries.Entry{
+				{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+				{ID: "2", Name: "URL", Value: "prod", Label: "prod"},
+			},
+			nil,
+			"2",
+		)
+
+		output, err := Run(
+			paths,
+			configPath,
+			nil,
+			Options{Format: FormatShell, All: true},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "export URL='prod'", output)
+	})
+
+	t.Run("rejects invalid format", func(t *testing.T) {
+		_, err := Run(nil, "", nil, Options{Format: "xml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid format")
+	})
+}
@@ -0,0 +1,114 @@
+package get
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// Exit codes returned by the get command.
+const (
+	ExitNotFound     = 2
+	ExitAmbiguous    = 3
+	ExitUnlockFailed = 4
+)
+
+var (
+	ErrNotFound     = errors.New("variable not found")
+	ErrAmbiguous    = errors.New("variable is ambiguous")
+	ErrUnlockFailed = errors.New("failed to unlock file")
+)
+
+// Options holds the flags of the get command.
+type Options struct {
+	// Label selects a variable within a radio group by its label.
+	Label string
+}
+
+// Run finds a single variable by name or entry ID and returns its value,
+// decrypted if needed. The name may be an entry ID, or a positional ID of the
+// form "name[index]", to select a variable within a radio group.
+func Run(variablesPaths []string, name string, opts Options) (string, error) {
+	layers, err := commands.LoadLayers(variablesPaths)
+	if err != nil {
+		return "", err
+	}
+
+	list, layerOf := layers.Entries()
+	index, err := Find(list, name, opts.Label)
+	if err != nil {
+		return "", err
+	}
+
+	// Only the file holding the variable is unlocked, for a secret value
+	if !list[index].Secret || !layers.Locked(layerOf[index]) {
+		return list[index].Value, nil
+	}
+	if err := layers.Unlock(layerOf[index]); err != nil {
+		return "", &commands.ExitError{
+			Code: ExitUnlockFailed,
+			Err:  fmt.Errorf("%w: %w", ErrUnlockFailed, err),
+		}
+	}
+
+	// Unlocking doesn't change the order of entries
+	list, _ = layers.Entries()
+	return list[index].Value, nil
+}
+
+// Find returns the index of the single entry matching name and label. The
+// name may also be an entry ID, or a positional ID as computed by
+// config.PositionalID. An empty label matches any label. Returns a
+// *commands.ExitError wrapping ErrNotFound or
+// ErrAmbiguous when there isn't exactly one match.
+func Find(list []entries.Entry, name string, label string) (int, error) {
+	var matches []int
+	for i, entry := range list {
+		if entry.Name != name && entry.ID != name &&
+			config.PositionalID(list, i) != name {
+			continue
+		}
+		if label != "" && entry.Label != label {
+			continue
+		}
+		matches = append(matches, i)
+	}
+
+	switch len(matches) {
+	case 0:
+		err := fmt.Errorf("%w: %q", ErrNotFound, name)
+		if label != "" {
+			err = fmt.Errorf(
+				"%w: %q with label %q",
+				ErrNotFound,
+				name,
+				label,
+			)
+		}
+		return -1, &commands.ExitError{Code: ExitNotFound, Err: err}
+	case 1:
+		return matches[0], nil
+	}
+
+	candidates := make([]string, len(matches))
+	for i, index := range matches {
+		candidates[i] = fmt.Sprintf(
+			"%s (%q)",
+			config.PositionalID(list, index),
+			list[index].Label,
+		)
+	}
+	return -1, &commands.ExitError{
+		Code: ExitAmbiguous,
+		Err: fmt.Errorf(
+			"%w: %q matches %s, specify a label or an ID",
+			ErrAmbiguous,
+			name,
+			strings.Join(candidates, ", "),
+		),
+	}
+}
@@ -0,0 +1,141 @@
+package get
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp writes a plaintext file with two variants of URL, a file encrypted
+// with the password "password" and a keychain file whose key is missing from
+// the keychain, so that it can't be unlocked. Returns the paths of the files.
+func setUp(t *testing.T) []string {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "vault.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "2", Name: "URL", Value: "prod", Label: "prod"},
+			{ID: "3", Name: "HOST", Value: "localhost"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "4", Name: "PASSWORD", Value: "s3cr3t", Secret: true},
+		},
+	}
+	params := crypto.KDFParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	key, err := file.SetPasswordMode("password", params)
+	require.NoError(t, err)
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	key, err = crypto.GenerateKey()
+	require.NoError(t, err)
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "5", Name: "TOKEN", Value: "secret", Secret: true},
+			{ID: "6", Name: "REGION", Value: "eu"},
+		},
+	}
+	file.SetKeychainMode("encryption-key-missing")
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[2], file))
+
+	t.Setenv("APIKI_PASSWORD", "password")
+	return paths
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		variable string
+		opts     Options
+		want     string
+		code     int
+		err      error
+	}{
+		{name: "by name", variable: "HOST", want: "localhost"},
+		{name: "by entry ID", variable: "3", want: "localhost"},
+		{name: "by positional ID", variable: "URL[1]", want: "prod"},
+		{
+			name:     "by label",
+			variable: "URL",
+			opts:     Options{Label: "dev"},
+			want:     "dev",
+		},
+		{name: "secret value", variable: "PASSWORD", want: "s3cr3t"},
+		{name: "plain value of a locked file", variable: "REGION", want: "eu"},
+		{
+			name:     "not found",
+			variable: "MISSING",
+			code:     ExitNotFound,
+			err:      ErrNotFound,
+		},
+		{
+			name:     "label not found",
+			variable: "URL",
+			opts:     Options{Label: "staging"},
+			code:     ExitNotFound,
+			err:      ErrNotFound,
+		},
+		{
+			name:     "ambiguous",
+			variable: "URL",
+			code:     ExitAmbiguous,
+			err:      ErrAmbiguous,
+		},
+		{
+			name:     "unlock failed",
+			variable: "TOKEN",
+			code:     ExitUnlockFailed,
+			err:      ErrUnlockFailed,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths := setUp(t)
+
+			value, err := Run(paths, tt.variable, tt.opts)
+			if tt.err == nil {
+				require.NoError(t, err)
+				require.Equal(t, tt.want, value)
+				return
+			}
+			require.ErrorIs(t, err, tt.err)
+			var exitErr *commands.ExitError
+			require.ErrorAs(t, err, &exitErr)
+			require.Equal(t, tt.code, exitErr.Code)
+		})
+	}
+
+	t.Run("lists the candidates of an ambiguous name", func(t *testing.T) {
+		paths := setUp(t)
+
+		_, err := Run(paths, "URL", Options{})
+		require.ErrorContains(t, err, `URL[0] ("dev"), URL[1] ("prod")`)
+	})
+}
@@ -0,0 +1,389 @@
+package hook
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/filelock"
+	"github.com/loderunner/apiki/internal/shell"
+	"github.com/loderunner/apiki/internal/trust"
+)
+
+// ProjectFileName is the name of the file that lists the variables to
+// activate in a directory and its subdirectories.
+const ProjectFileName = ".apiki.json"
+
+// StateVar is the environment variable holding the hook state between runs.
+const StateVar = "APIKI_HOOK_STATE"
+
+// ErrNoProjectFile is returned when no project file is found.
+var ErrNoProjectFile = errors.New("no " + ProjectFileName + " found")
+
+// ProjectFile is the content of a project file.
+type ProjectFile struct {
+	// Use lists variables as "NAME" or "NAME=label", like the arguments of
+	// the use command, or by entry ID. Positional IDs such as "NAME[1]"
+	// change when variables are added or removed, and must not be used.
+	Use []string `json:"use,omitempty"`
+
+	// Profiles lists profiles whose variables are activated. Variables from
+	// Use take precedence.
+	Profiles []string `json:"profiles,omitempty"`
+}
+
+// state is remembered between runs of the hook.
+type state struct {
+	// Dir is the working directory of the last run.
+	Dir string `json:"dir,omitempty"`
+
+	// File and Hash identify the project file found by the last run, and
+	// Status is its trust status at the time.
+	File   string       `json:"file,omitempty"`
+	Hash   string       `json:"hash,omitempty"`
+	Status trust.Status `json:"status,omitempty"`
+
+	// Active is true when the variables of File are set.
+	Active bool `json:"active,omitempty"`
+
+	// Restore holds the values the activated variables had before
+	// activation. A nil value means the variable was not set. The values are
+	// kept in plaintext in StateVar, which is exported to the programs run
+	// from the shell like the variables themselves.
+	Restore map[string]*string `json:"restore,omitempty"`
+}
+
+// Run is called by the shell integration before each prompt. When the
+// working directory enters the scope of an allowed project file, the returned
+// shell commands set its variables. When it leaves, they restore the
+// previous values. Problems with the project file are reported on stderr
+// rather than returned, so that they don't break the prompt.
+//
+// The hook never waits or prompts, see commands.NonInteractive: if another
+// apiki process holds the variables files, activation is tried again at the
+// next prompt, and variables of files that need a password are skipped.
+func Run(
+	variablesPaths []string,
+	configPath, trustPath string,
+	sh shell.Emitter,
+) (string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+
+	st := decodeState(os.Getenv(StateVar))
+
+	var (
+		file   string
+		hash   string
+		status trust.Status
+		data   []byte
+	)
+	file, err = FindProjectFile(cwd)
+	if err != nil && !errors.Is(err, ErrNoProjectFile) {
+		return "", err
+	}
+	if file != "" {
+		data, err = os.ReadFile(file)
+		if err != nil {
+			return "", fmt.Errorf("could not read %s: %w", file, err)
+		}
+		hash = trust.Hash(data)
+
+		db, err := trust.Load(trustPath)
+		if err != nil {
+			return "", fmt.Errorf("could not load trust database: %w", err)
+		}
+		status = db.Status(file, hash)
+	}
+
+	if st.Dir == cwd && st.File == file && st.Hash == hash &&
+		st.Status == status {
+		return "", nil
+	}
+
+	var lines []string
+	changed := st.File != file || st.Hash != hash
+
+	// Values set by the commands emitted so far, on top of the environment
+	overlay := make(map[string]*string)
+	lookup := func(name string) *string {
+		if value, ok := overlay[name]; ok {
+			return value
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return &value
+		}
+		return nil
+	}
+
+	if st.Active && (changed || status != trust.StatusAllowed) {
+		for _, name := range sortedKeys(st.Restore) {
+			value := st.Restore[name]
+			if value == nil {
+				lines = append(lines, sh.Unset(name))
+			} else {
+				lines = append(lines, sh.Export(name, *value))
+			}
+			overlay[name] = value
+		}
+		st.Active = false
+		st.Restore = nil
+	}
+
+	retry := false
+	if !st.Active && status == trust.StatusAllowed {
+		values, err := resolve(variablesPaths, configPath, data)
+		if errors.Is(err, filelock.ErrLocked) {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: warning: variables files are in use by another apiki "+
+					"process, %s is activated at the next prompt\n",
+				file,
+			)
+			retry = true
+		} else if err != nil {
+			fmt.Fprintf(os.Stderr, "apiki: %s: %s\n", file, err)
+		} else {
+			st.Restore = make(map[string]*string, len(values))
+			for _, name := range sortedKeys(values) {
+				st.Restore[name] = lookup(name)
+				lines = append(lines, sh.Export(name, values[name]))
+			}
+			st.Active = true
+		}
+	} else if changed && file != "" && status == trust.StatusUnknown {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: %s is not allowed. Run `apiki allow` to activate it.\n",
+			file,
+		)
+	}
+
+	st.Dir = cwd
+	if retry {
+		st.Dir = ""
+	}
+	st.File = file
+	st.Hash = hash
+	st.Status = status
+	encoded, err := encodeState(st)
+	if err != nil {
+		return "", err
+	}
+	lines = append(lines, sh.Export(StateVar, encoded))
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// Allow records the project file at path as allowed to activate its
+// variables. If path is empty, the nearest project file from the working
+// directory is used.
+func Allow(trustPath, path string) error {
+	return record(trustPath, path, (*trust.DB).Allow, "Allowed")
+}
+
+// Deny records the project file at path as never activated. If path is
+// empty, the nearest project file from the working directory is used.
+func Deny(trustPath, path string) error {
+	return record(trustPath, path, (*trust.DB).Deny, "Denied")
+}
+
+// record applies update to the trust database for the project file at path.
+func record(
+	trustPath, path string,
+	update func(db *trust.DB, path, hash string),
+	verb string,
+) error {
+	file, err := resolveProjectFile(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", file, err)
+	}
+	var project ProjectFile
+	if err := json.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("could not parse %s: %w", file, err)
+	}
+
+	lock, err := commands.Lock(trustPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	db, err := trust.Load(trustPath)
+	if err != nil {
+		return fmt.Errorf("could not load trust database: %w", err)
+	}
+	update(db, file, trust.Hash(data))
+	if err := trust.Save(trustPath, db); err != nil {
+		return fmt.Errorf("failed to save trust database: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ %s %s.\n", verb, file)
+	return nil
+}
+
+// FindProjectFile walks upward from startDir and returns the path of the
+// nearest project file.
+func FindProjectFile(startDir string) (string, error) {
+	dir := startDir
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path, nil
+		}
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return "", err
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", ErrNoProjectFile
+		}
+		dir = parent
+	}
+}
+
+// resolveProjectFile returns the absolute path of the project file at path,
+// or of the nearest project file from the working directory if path is
+// empty. If path is a directory, its project file is used.
+func resolveProjectFile(path string) (string, error) {
+	if path == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", err
+		}
+		return FindProjectFile(cwd)
+	}
+
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(abs)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		abs = filepath.Join(abs, ProjectFileName)
+	}
+	return abs, nil
+}
+
+// resolve returns the values of the variables listed in the project file
+// data, by name. Variables of files that need a password are skipped with a
+// warning.
+func resolve(
+	variablesPaths []string,
+	configPath string,
+	data []byte,
+) (map[string]string, error) {
+	var project ProjectFile
+	if err := json.Unmarshal(data, &project); err != nil {
+		return nil, fmt.Errorf("invalid project file: %w", err)
+	}
+
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer store.Close()
+	list := store.Entries
+
+	values := make(map[string]string)
+	for _, name := range project.Profiles {
+		profile, ok := store.Config.Profiles[name]
+		if !ok {
+			return nil, fmt.Errorf("profile not found: %q", name)
+		}
+		for i, entry := range list {
+			if !profile.Has(entry.ID) {
+				continue
+			}
+			if err := reveal(store, i); err != nil {
+				return nil, err
+			}
+			if !list[i].Encrypted() {
+				values[entry.Name] = list[i].Value
+			}
+		}
+	}
+
+	for _, arg := range project.Use {
+		name, label, _ := strings.Cut(arg, "=")
+		index, err := get.Find(list, name, label)
+		if err != nil {
+			return nil, err
+		}
+		if err := reveal(store, index); err != nil {
+			return nil, err
+		}
+		if !list[index].Encrypted() {
+			values[list[index].Name] = list[index].Value
+		}
+	}
+
+	return values, nil
+}
+
+// reveal decrypts the value of the entry of store at index, leaving it
+// encrypted with a warning if its file needs a password.
+func reveal(store *commands.Store, index int) error {
+	err := store.Reveal(index)
+	if errors.Is(err, commands.ErrPasswordRequired) {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: warning: skipped %s, its variables file needs a password\n",
+			store.Entries[index].Name,
+		)
+		return nil
+	}
+	return err
+}
+
+// decodeState decodes the hook state from its environment variable. Returns
+// an empty state if value is empty or invalid.
+func decodeState(value string) state {
+	var st state
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return state{}
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return state{}
+	}
+	return st
+}
+
+// encodeState encodes the hook state for its environment variable.
+func encodeState(st state) (string, error) {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal hook state: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,119 @@
+package hook
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/filelock"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+// setUp writes a plaintext file, a file encrypted with a password and an
+// allowed project file using a variable of each, and changes to the project
+// directory. Returns the paths of the files, of the config and of the trust
+// database.
+func setUp(t *testing.T) ([]string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID:      entries.NewID(),
+		Entries: []entries.Entry{{ID: "1", Name: "HOST", Value: "localhost"}},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "2", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	params := crypto.KDFParams{Memory: 8 * 1024, Iterations: 1, Parallelism: 1}
+	key, err := file.SetPasswordMode("password", params)
+	require.NoError(t, err)
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, config.Save(configPath, &config.Config{}))
+
+	project := filepath.Join(dir, "project")
+	require.NoError(t, os.Mkdir(project, 0o700))
+	data := []byte(`{"use": ["HOST", "TOKEN"]}`)
+	path := filepath.Join(project, ProjectFileName)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+	trustPath := filepath.Join(dir, "trust.json")
+	require.NoError(t, Allow(trustPath, path))
+	t.Chdir(project)
+
+	commands.NonInteractive = true
+	t.Cleanup(func() { commands.NonInteractive = false })
+	t.Setenv("APIKI_PASSWORD", "")
+	t.Setenv(StateVar, "")
+	return paths, configPath, trustPath
+}
+
+func TestRun(t *testing.T) {
+	t.Run("skips variables that need a password", func(t *testing.T) {
+		paths, configPath, trustPath := setUp(t)
+
+		output, err := Run(paths, configPath, trustPath, shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Contains(t, output, "export HOST='localhost'")
+		require.NotContains(t, output, "TOKEN")
+	})
+
+	t.Run("activates with the password", func(t *testing.T) {
+		paths, configPath, trustPath := setUp(t)
+		t.Setenv("APIKI_PASSWORD", "password")
+
+		output, err := Run(paths, configPath, trustPath, shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Contains(t, output, "export TOKEN='secret'")
+	})
+
+	t.Run("retries while files are locked", func(t *testing.T) {
+		paths, configPath, trustPath := setUp(t)
+		lock, err := filelock.TryAcquire(paths[0])
+		require.NoError(t, err)
+
+		output, err := Run(paths, configPath, trustPath, shell.PosixEmitter{})
+		lock.Release()
+		require.NoError(t, err)
+		require.NotContains(t, output, "HOST")
+		st := decodeState(stateValue(t, output))
+		require.False(t, st.Active)
+
+		// The next prompt activates the project file
+		t.Setenv(StateVar, stateValue(t, output))
+		output, err = Run(paths, configPath, trustPath, shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Contains(t, output, "export HOST='localhost'")
+	})
+}
+
+// stateValue returns the value of the hook state exported by output.
+func stateValue(t *testing.T, output string) string {
+	t.Helper()
+
+	prefix := "export " + StateVar + "="
+	for _, line := range strings.Split(output, "\n") {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			return strings.Trim(value, "'")
+		}
+	}
+	t.Fatalf("no hook state in %q", output)
+	return ""
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/loderunner/apiki/internal/crypto"
+)
+
+// IdentityPath is the path to the identity file, holding the private key that
+// unlocks variables files encrypted for recipients.
+var IdentityPath string
+
+// ErrNoIdentity is returned by ReadIdentity when the identity file doesn't
+// exist.
+var ErrNoIdentity = errors.New("no identity, run `apiki keygen` to create one")
+
+// ReadIdentity reads the identity from the file at IdentityPath. Empty lines
+// and lines starting with "#" are ignored. An identity file that other users
+// can access is reported, or refused if StrictPermissions is set.
+func ReadIdentity() (string, error) {
+	if err := checkPermissions(IdentityPath); err != nil {
+		return "", err
+	}
+
+	data, err := os.ReadFile(IdentityPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNoIdentity
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read identity: %w", err)
+	}
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if _, err := crypto.RecipientOf(line); err != nil {
+			return "", fmt.Errorf("%s: %w", IdentityPath, err)
+		}
+		return line, nil
+	}
+	return "", fmt.Errorf("%s: no identity found", IdentityPath)
+}
+
+// OwnRecipient returns the recipient matching the identity of the user, that
+// variables files are encrypted for.
+func OwnRecipient() (string, error) {
+	identity, err := ReadIdentity()
+	if err != nil {
+		return "", err
+	}
+	return crypto.RecipientOf(identity)
+}
@@ -0,0 +1,292 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"go.yaml.in/yaml/v3"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/apiki"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// Input formats supported by the import command.
+const (
+	FormatDotEnv = "dotenv"
+	FormatJSON   = "json"
+	FormatYAML   = "yaml"
+)
+
+// Conflict strategies, applied when a variable with the same name already
+// exists.
+const (
+	// ConflictSkip leaves the existing variable untouched.
+	ConflictSkip = "skip"
+	// ConflictOverwrite replaces the value of the existing variable.
+	ConflictOverwrite = "overwrite"
+	// ConflictAddVariant adds the imported variable next to the existing
+	// ones, as a new member of their radio group.
+	ConflictAddVariant = "add-variant"
+)
+
+// Options holds the flags of the import command.
+type Options struct {
+	// Format is one of FormatDotEnv, FormatJSON or FormatYAML. Detected from
+	// the file extension if empty.
+	Format string
+
+	// Label is the label of imported variables. Defaults to
+	// "imported from <file>".
+	Label string
+
+	// OnConflict is one of ConflictSkip, ConflictOverwrite or
+	// ConflictAddVariant.
+	OnConflict string
+}
+
+// Run imports the variables defined in the file at path into the variables
+// file. Variables with an empty value are skipped with a warning.
+func Run(
+	variablesPaths []string,
+	configPath, path string,
+	opts Options,
+) error {
+	if !slices.Contains(
+		[]string{ConflictSkip, ConflictOverwrite, ConflictAddVariant},
+		opts.OnConflict,
+	) {
+		return fmt.Errorf("invalid conflict strategy: %q", opts.OnConflict)
+	}
+
+	format := opts.Format
+	if format == "" {
+		format = DetectFormat(path)
+	}
+
+	var (
+		values map[string]string
+		err    error
+	)
+	switch format {
+	case FormatDotEnv:
+		values, err = parseDotEnv(path)
+	case FormatJSON:
+		values, err = parseJSON(path)
+	case FormatYAML:
+		values, err = parseYAML(path)
+	default:
+		return fmt.Errorf("invalid format: %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("could not read %s: %w", path, err)
+	}
+
+	// Empty values are refused by set and the interface alike
+	var names, empty []string
+	for name, value := range values {
+		if err := entries.ValidateName(name); err != nil {
+			return fmt.Errorf("could not import %s: %w", path, err)
+		}
+		if value == "" {
+			empty = append(empty, name)
+		} else {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+	slices.Sort(empty)
+	for _, name := range empty {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: warning: %s: skipped %s, its value is empty\n",
+			path,
+			name,
+		)
+	}
+
+	label := strings.TrimSpace(opts.Label)
+	if label == "" {
+		label = "imported from " + filepath.Base(path)
+	}
+
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	imported, skipped := 0, 0
+	for _, name := range names {
+		value := values[name]
+
+		var existing []int
+		for i, entry := range store.Entries {
+			if entry.Name == name {
+				existing = append(existing, i)
+			}
+		}
+
+		// An existing variable with the same label is always updated, so
+		// that importing the same file twice doesn't duplicate variables
+		sameLabel := slices.IndexFunc(existing, func(i int) bool {
+			return store.Entries[i].Label == label
+		})
+
+		switch {
+		case len(existing) == 0:
+			store.Add(entries.Entry{
+				Name:  name,
+				Value: value,
+				Label: label,
+			}, false)
+		case opts.OnConflict == ConflictSkip:
+			skipped++
+			continue
+		case sameLabel >= 0:
+			store.Entries[existing[sameLabel]].Value = value
+		case opts.OnConflict == ConflictAddVariant:
+			store.Add(entries.Entry{
+				Name:  name,
+				Value: value,
+				Label: label,
+			}, false)
+		case len(existing) == 1:
+			store.Entries[existing[0]].Value = value
+		default:
+			return fmt.Errorf(
+				"cannot overwrite %q: several variables have this name, "+
+					"use --on-conflict %s or --label",
+				name,
+				ConflictAddVariant,
+			)
+		}
+		imported++
+	}
+
+	if imported > 0 {
+		if err := store.Save(); err != nil {
+			return err
+		}
+	}
+
+	variableWord := "variables"
+	if imported == 1 {
+		variableWord = "variable"
+	}
+	if skipped > 0 {
+		fmt.Fprintf(
+			os.Stderr,
+			"✓ Imported %d %s, skipped %d existing.\n",
+			imported,
+			variableWord,
+			skipped,
+		)
+	} else {
+		fmt.Fprintf(os.Stderr, "✓ Imported %d %s.\n", imported, variableWord)
+	}
+
+	return nil
+}
+
+// DetectFormat guesses the format of the file at path from its extension.
+// Defaults to FormatDotEnv.
+func DetectFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return FormatJSON
+	case ".yaml", ".yml":
+		return FormatYAML
+	default:
+		return FormatDotEnv
+	}
+}
+
+// parseDotEnv reads a .env file.
+func parseDotEnv(path string) (map[string]string, error) {
+	dotEnvEntries, err := apiki.ParseDotEnvFile(path)
+	if err != nil {
+		return nil, err
+	}
+	values := make(map[string]string, len(dotEnvEntries))
+	for _, entry := range dotEnvEntries {
+		values[entry.Name] = entry.Value
+	}
+	return values, nil
+}
+
+// parseJSON reads a JSON object of strings, numbers and booleans.
+func parseJSON(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	values := make(map[string]string, len(raw))
+	for name, value := range raw {
+		switch v := value.(type) {
+		case string:
+			values[name] = v
+		case json.Number:
+			values[name] = v.String()
+		case bool:
+			values[name] = strconv.FormatBool(v)
+		default:
+			return nil, fmt.Errorf(
+				"variable %q: value must be a string, number or boolean",
+				name,
+			)
+		}
+	}
+	return values, nil
+}
+
+// parseYAML reads a YAML map of scalars. Scalars are imported as written, so
+// that e.g. "007" isn't turned into "7".
+func parseYAML(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("failed to parse YAML: %w", err)
+	}
+
+	values := make(map[string]string)
+	if len(doc.Content) == 0 {
+		return values, nil
+	}
+
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return nil, errors.New("failed to parse YAML: expected a map")
+	}
+
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		key, value := mapping.Content[i], mapping.Content[i+1]
+		if value.Kind != yaml.ScalarNode || value.Tag == "!!null" {
+			return nil, fmt.Errorf(
+				"variable %q: value must be a string, number or boolean",
+				key.Value,
+			)
+		}
+		values[key.Value] = value.Value
+	}
+	return values, nil
+}
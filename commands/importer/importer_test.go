@@ -0,0 +1,226 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// setUp writes a variables file with list and a file to import with data,
+// named name. Returns the paths of the variables file, of the config and of
+// the file to import.
+func setUp(
+	t *testing.T,
+	list []entries.Entry,
+	name, data string,
+) ([]string, string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "variables.json")
+	file := &entries.File{ID: entries.NewID(), Entries: list}
+	require.NoError(t, entries.Save(path, file))
+
+	input := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(input, []byte(data), 0o600))
+	return []string{path}, filepath.Join(dir, "config.json"), input
+}
+
+// values returns the values of the variables file at path, as
+// "NAME=label=value".
+func values(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := entries.Load(path)
+	require.NoError(t, err)
+	values := make([]string, 0, len(file.Entries))
+	for _, entry := range file.Entries {
+		values = append(
+			values,
+			entry.Name+"="+entry.Label+"="+entry.Value,
+		)
+	}
+	return values
+}
+
+func TestRun(t *testing.T) {
+	existing := []entries.Entry{
+		{ID: "1", Name: "HOST", Value: "old", Label: "mine"},
+	}
+
+	for _, tt := range []struct {
+		name   string
+		list   []entries.Entry
+		file   string
+		data   string
+		opts   Options
+		values []string
+	}{
+		{
+			name: "imports dotenv files",
+			file: ".env",
+			data: "HOST=localhost\nPORT=8080\n",
+			opts: Options{OnConflict: ConflictSkip},
+			values: []string{
+				"HOST=imported from .env=localhost",
+				"PORT=imported from .env=8080",
+			},
+		},
+		{
+			name: "imports JSON scalars",
+			file: "vars.json",
+			data: `{"PORT": 8080, "DEBUG": true, "HOST": "localhost"}`,
+			opts: Options{OnConflict: ConflictSkip, Label: "json"},
+			values: []string{
+				"DEBUG=json=true",
+				"HOST=json=localhost",
+				"PORT=json=8080",
+			},
+		},
+		{
+			name:   "imports YAML scalars as written",
+			file:   "vars.yaml",
+			data:   "PIN: 007\n",
+			opts:   Options{OnConflict: ConflictSkip, Label: "yaml"},
+			values: []string{"PIN=yaml=007"},
+		},
+		{
+			name: "skips existing variables",
+			list: existing,
+			file: ".env",
+			data: "HOST=new\nPORT=8080\n",
+			opts: Options{OnConflict: ConflictSkip, Label: "env"},
+			values: []string{
+				"HOST=mine=old",
+				"PORT=env=8080",
+			},
+		},
+		{
+			name:   "overwrites existing variables",
+			list:   existing,
+			file:   ".env",
+			data:   "HOST=new\n",
+			opts:   Options{OnConflict: ConflictOverwrite, Label: "env"},
+			values: []string{"HOST=mine=new"},
+		},
+		{
+			name: "adds variants",
+			list: existing,
+			file: ".env",
+			data: "HOST=new\n",
+			opts: Options{OnConflict: ConflictAddVariant, Label: "env"},
+			values: []string{
+				"HOST=mine=old",
+				"HOST=env=new",
+			},
+		},
+		{
+			name: "updates the variant with the same label",
+			list: []entries.Entry{
+				{ID: "1", Name: "HOST", Value: "old", Label: "mine"},
+				{ID: "2", Name: "HOST", Value: "old", Label: "env"},
+			},
+			file: ".env",
+			data: "HOST=new\n",
+			opts: Options{OnConflict: ConflictOverwrite, Label: "env"},
+			values: []string{
+				"HOST=mine=old",
+				"HOST=env=new",
+			},
+		},
+		{
+			name:   "skips empty dotenv values",
+			file:   ".env",
+			data:   "EMPTY=\nHOST=localhost\n",
+			opts:   Options{OnConflict: ConflictSkip, Label: "env"},
+			values: []string{"HOST=env=localhost"},
+		},
+		{
+			name:   "skips empty YAML values",
+			file:   "vars.yaml",
+			data:   "EMPTY: \"\"\nHOST: localhost\n",
+			opts:   Options{OnConflict: ConflictSkip, Label: "yaml"},
+			values: []string{"HOST=yaml=localhost"},
+		},
+		{
+			name: "skips empty JSON values",
+			file: "vars.json",
+			data: `{"EMPTY": "", "HOST": "localhost"}`,
+			opts: Options{OnConflict: ConflictOverwrite, Label: "json"},
+			values: []string{
+				"HOST=json=localhost",
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, configPath, input := setUp(t, tt.list, tt.file, tt.data)
+
+			require.NoError(t, Run(paths, configPath, input, tt.opts))
+			require.ElementsMatch(t, tt.values, values(t, paths[0]))
+		})
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		list []entries.Entry
+		file string
+		data string
+		opts Options
+		err  string
+	}{
+		{
+			name: "rejects invalid strategies",
+			file: ".env",
+			data: "HOST=localhost\n",
+			opts: Options{OnConflict: "merge"},
+			err:  "invalid conflict strategy",
+		},
+		{
+			name: "rejects invalid formats",
+			file: ".env",
+			data: "HOST=localhost\n",
+			opts: Options{OnConflict: ConflictSkip, Format: "toml"},
+			err:  "invalid format",
+		},
+		{
+			name: "rejects invalid names",
+			file: "vars.json",
+			data: `{"1HOST": "localhost"}`,
+			opts: Options{OnConflict: ConflictSkip},
+			err:  "could not import",
+		},
+		{
+			name: "rejects nested values",
+			file: "vars.yaml",
+			data: "HOST:\n  name: localhost\n",
+			opts: Options{OnConflict: ConflictSkip},
+			err:  "value must be a string, number or boolean",
+		},
+		{
+			name: "rejects overwriting ambiguous variables",
+			list: []entries.Entry{
+				{ID: "1", Name: "HOST", Value: "dev", Label: "dev"},
+				{ID: "2", Name: "HOST", Value: "prod", Label: "prod"},
+			},
+			file: ".env",
+			data: "HOST=new\n",
+			opts: Options{OnConflict: ConflictOverwrite},
+			err:  "several variables have this name",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, configPath, input := setUp(t, tt.list, tt.file, tt.data)
+			before := values(t, paths[0])
+
+			err := Run(paths, configPath, input, tt.opts)
+			require.ErrorContains(t, err, tt.err)
+			require.Equal(t, before, values(t, paths[0]))
+		})
+	}
+}
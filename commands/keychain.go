@@ -0,0 +1,90 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/loderunner/apiki/internal/keychain"
+)
+
+// KeychainIndexPath is the path to the index of the keychain items created by
+// apiki, see `apiki keychain list`.
+var KeychainIndexPath string
+
+// StoreKeychainKey stores key in a new keychain item for the variables file at
+// path, and records it in the index. Returns the account of the item.
+func StoreKeychainKey(path string, key []byte) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	lock, err := Lock(KeychainIndexPath)
+	if err != nil {
+		return "", err
+	}
+	defer lock.Release()
+
+	// Record the item first, so that it can be pruned if saving the file
+	// fails
+	index, err := keychain.LoadIndex(KeychainIndexPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to load keychain index: %w", err)
+	}
+	account := keychain.NewAccount()
+	index.Items[account] = abs
+	if err := keychain.SaveIndex(KeychainIndexPath, index); err != nil {
+		return "", fmt.Errorf("failed to save keychain index: %w", err)
+	}
+
+	if err := keychain.Store(account, key); err != nil {
+		delete(index.Items, account)
+		_ = keychain.SaveIndex(KeychainIndexPath, index)
+		return "", err
+	}
+	return account, nil
+}
+
+// CopyKeychainKey copies the key of the keychain item of account to a new item
+// for the variables file at path, see entries.CopyKeychainKey. Returns the
+// account of the new item.
+func CopyKeychainKey(path, account string) (string, error) {
+	key, err := keychain.Retrieve(account)
+	if err != nil {
+		return "", err
+	}
+	return StoreKeychainKey(path, key)
+}
+
+// DeleteKeychainKey removes the keychain item of account, and its record in
+// the index. The legacy item shared by files from older versions is refused,
+// only `apiki keychain prune` deletes it.
+func DeleteKeychainKey(account string) error {
+	if account == keychain.LegacyAccount {
+		return errors.New("refusing to delete the shared legacy keychain item")
+	}
+
+	lock, err := Lock(KeychainIndexPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if err := keychain.Delete(account); err != nil {
+		return err
+	}
+
+	index, err := keychain.LoadIndex(KeychainIndexPath)
+	if err != nil {
+		return fmt.Errorf("failed to load keychain index: %w", err)
+	}
+	if _, ok := index.Items[account]; !ok {
+		return nil
+	}
+	delete(index.Items, account)
+	if err := keychain.SaveIndex(KeychainIndexPath, index); err != nil {
+		return fmt.Errorf("failed to save keychain index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package keychain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/entries"
+	oskeychain "github.com/loderunner/apiki/internal/keychain"
+	"github.com/loderunner/apiki/internal/prompt"
+)
+
+// item is a keychain item recorded in the index.
+type item struct {
+	account string
+	path    string
+
+	// orphaned is true if the file was deleted or doesn't use the item
+	// anymore
+	orphaned bool
+	status   string
+}
+
+// List returns the keychain items created by apiki, one per line, with the
+// variables file each was created for and whether it still uses it.
+func List() (string, error) {
+	items, err := load()
+	if err != nil {
+		return "", err
+	}
+
+	lines := make([]string, 0, len(items))
+	for _, item := range items {
+		lines = append(
+			lines,
+			fmt.Sprintf("%s %s (%s)", item.account, item.path, item.status),
+		)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Prune deletes the keychain items of variables files that were deleted or
+// don't use them anymore, after asking for confirmation.
+func Prune() error {
+	items, err := load()
+	if err != nil {
+		return err
+	}
+
+	items = slices.DeleteFunc(items, func(item item) bool {
+		return !item.orphaned
+	})
+	if len(items) == 0 {
+		fmt.Fprintf(os.Stderr, "✓ No orphaned keychain items.\n")
+		return nil
+	}
+
+	for _, item := range items {
+		fmt.Fprintf(
+			os.Stderr,
+			"%s %s (%s)\n",
+			item.account,
+			item.path,
+			item.status,
+		)
+	}
+
+	if slices.ContainsFunc(items, func(item item) bool {
+		return item.account == oskeychain.LegacyAccount
+	}) {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: warning: keychain files of older versions that weren't "+
+				"opened since upgrading still use %s\n",
+			oskeychain.LegacyAccount,
+		)
+	}
+
+	// Ask for confirmation, a file that was moved can't be unlocked without
+	// its item
+	confirm, err := prompt.ReadChoiceWithDefault(
+		fmt.Sprintf(
+			"Delete %d keychain items? Moved files will not unlock. [y/N] ",
+			len(items),
+		),
+		map[rune]string{
+			'y': "yes",
+			'n': "no",
+		},
+		"no",
+	)
+	if err != nil {
+		return fmt.Errorf("failed to read confirmation: %w", err)
+	}
+
+	if confirm == "no" {
+		return nil
+	}
+
+	for _, item := range items {
+		// The legacy item isn't recorded in the index
+		if item.account == oskeychain.LegacyAccount {
+			err = oskeychain.Delete(item.account)
+		} else {
+			err = commands.DeleteKeychainKey(item.account)
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Deleted %d keychain items.\n", len(items))
+	return nil
+}
+
+// load returns the keychain items recorded in the index, sorted by path, with
+// the status of their file, and the legacy item shared by files of older
+// versions if the keychain holds it.
+func load() ([]item, error) {
+	index, err := oskeychain.LoadIndex(commands.KeychainIndexPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load keychain index: %w", err)
+	}
+
+	items := make([]item, 0, len(index.Items))
+	for account, path := range index.Items {
+		item := item{account: account, path: path}
+
+		header, err := entries.LoadHeader(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			item.orphaned = true
+			item.status = "file not found"
+		case err != nil:
+			item.status = err.Error()
+		case header.Mode == "keychain" && header.KeychainAccount == account:
+			item.status = "in use"
+		default:
+			item.orphaned = true
+			item.status = "not used by file"
+		}
+
+		items = append(items, item)
+	}
+
+	slices.SortFunc(items, func(a, b item) int {
+		if c := strings.Compare(a.path, b.path); c != 0 {
+			return c
+		}
+		return strings.Compare(a.account, b.account)
+	})
+
+	// The keychain can't be read when it is unavailable, only list the items
+	// of the index then
+	exists, err := oskeychain.Exists(oskeychain.LegacyAccount)
+	if err == nil && exists {
+		items = append(items, legacyItem(index))
+	}
+	return items, nil
+}
+
+// legacyItem returns the item shared by the keychain files of older versions.
+// It is orphaned once no file of the index, nor any of their backups, uses it.
+// Files of older versions that weren't loaded since can't be known.
+func legacyItem(index *oskeychain.Index) item {
+	var paths []string
+	for _, path := range index.Items {
+		backups, _ := filepath.Glob(path + ".v*.bak")
+		paths = append(paths, path)
+		paths = append(paths, backups...)
+	}
+	slices.Sort(paths)
+	paths = slices.Compact(paths)
+
+	users := 0
+	for _, path := range paths {
+		header, err := entries.LoadHeader(path)
+		if err == nil &&
+			header.Mode == "keychain" &&
+			header.KeychainAccount == oskeychain.LegacyAccount {
+			users++
+		}
+	}
+
+	item := item{
+		account: oskeychain.LegacyAccount,
+		path:    "(shared by files of older versions)",
+	}
+	if users > 0 {
+		item.status = fmt.Sprintf("in use by %d files", users)
+	} else {
+		item.orphaned = true
+		item.status = "not used by known files"
+	}
+	return item
+}
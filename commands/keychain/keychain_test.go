@@ -0,0 +1,186 @@
+package keychain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/entries"
+	oskeychain "github.com/loderunner/apiki/internal/keychain"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp records keychain items in a new index: an item used by its file, an
+// item of a deleted file and an item its file doesn't use anymore. Returns the
+// directory of the files.
+func setUp(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	commands.KeychainIndexPath = filepath.Join(dir, "keychain.json")
+
+	key := make([]byte, 32)
+	for _, name := range []string{"used", "deleted", "unused"} {
+		path := filepath.Join(dir, name+".json")
+		account, err := commands.StoreKeychainKey(path, key)
+		require.NoError(t, err)
+
+		file := &entries.File{ID: entries.NewID()}
+		switch name {
+		case "used":
+			file.SetKeychainMode(account)
+		case "deleted":
+			continue
+		}
+		require.NoError(t, entries.Save(path, file))
+	}
+	return dir
+}
+
+// setStdin replaces the standard input with input until the end of the test.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+// accounts returns the accounts recorded in the index, by file name.
+func accounts(t *testing.T) map[string]string {
+	t.Helper()
+
+	index, err := oskeychain.LoadIndex(commands.KeychainIndexPath)
+	require.NoError(t, err)
+	names := make(map[string]string)
+	for account, path := range index.Items {
+		names[filepath.Base(path)] = account
+	}
+	return names
+}
+
+func TestList(t *testing.T) {
+	t.Run("shows the status of each item", func(t *testing.T) {
+		dir := setUp(t)
+		names := accounts(t)
+
+		output, err := List()
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			names["deleted.json"]+" "+filepath.Join(dir, "deleted.json")+
+				" (file not found)\n"+
+				names["unused.json"]+" "+filepath.Join(dir, "unused.json")+
+				" (not used by file)\n"+
+				names["used.json"]+" "+filepath.Join(dir, "used.json")+
+				" (in use)",
+			output,
+		)
+	})
+
+	t.Run("shows the legacy item", func(t *testing.T) {
+		dir := setUp(t)
+		require.NoError(
+			t,
+			oskeychain.Store(oskeychain.LegacyAccount, make([]byte, 32)),
+		)
+		t.Cleanup(func() { _ = oskeychain.Delete(oskeychain.LegacyAccount) })
+
+		// The backup of a migrated file still uses the legacy item
+		backup := filepath.Join(dir, "used.json.v5.bak")
+		data := []byte(`{"version": 5, "encryption": {"mode": "keychain"}}`)
+		require.NoError(t, os.WriteFile(backup, data, 0o600))
+
+		output, err := List()
+		require.NoError(t, err)
+		require.Contains(
+			t,
+			output,
+			"encryption-key (shared by files of older versions) "+
+				"(in use by 1 files)",
+		)
+	})
+}
+
+func TestPrune(t *testing.T) {
+	t.Run("deletes orphaned items", func(t *testing.T) {
+		setUp(t)
+		names := accounts(t)
+		setStdin(t, "y\n")
+
+		require.NoError(t, Prune())
+
+		require.Equal(
+			t,
+			map[string]string{"used.json": names["used.json"]},
+			accounts(t),
+		)
+		exists, err := oskeychain.Exists(names["used.json"])
+		require.NoError(t, err)
+		require.True(t, exists)
+		exists, err = oskeychain.Exists(names["unused.json"])
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("keeps items without confirmation", func(t *testing.T) {
+		setUp(t)
+		names := accounts(t)
+		setStdin(t, "\n")
+
+		require.NoError(t, Prune())
+
+		require.Equal(t, names, accounts(t))
+		exists, err := oskeychain.Exists(names["unused.json"])
+		require.NoError(t, err)
+		require.True(t, exists)
+	})
+
+	t.Run("keeps the legacy item while a file uses it", func(t *testing.T) {
+		dir := setUp(t)
+		require.NoError(
+			t,
+			oskeychain.Store(oskeychain.LegacyAccount, make([]byte, 32)),
+		)
+		t.Cleanup(func() { _ = oskeychain.Delete(oskeychain.LegacyAccount) })
+
+		backup := filepath.Join(dir, "used.json.v5.bak")
+		data := []byte(`{"version": 5, "encryption": {"mode": "keychain"}}`)
+		require.NoError(t, os.WriteFile(backup, data, 0o600))
+		setStdin(t, "y\n")
+
+		require.NoError(t, Prune())
+
+		exists, err := oskeychain.Exists(oskeychain.LegacyAccount)
+		require.NoError(t, err)
+		require.True(t, exists)
+
+		// Once the backup is gone, nothing uses it
+		require.NoError(t, os.Remove(backup))
+		setStdin(t, "y\n")
+
+		require.NoError(t, Prune())
+
+		exists, err = oskeychain.Exists(oskeychain.LegacyAccount)
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+}
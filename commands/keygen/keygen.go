@@ -0,0 +1,59 @@
+package keygen
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/crypto"
+)
+
+// Run creates the identity of the user at commands.IdentityPath, readable
+// only by them, and returns the matching recipient to share with teammates.
+// An existing identity is kept, and its recipient returned.
+func Run() (string, error) {
+	recipient, err := commands.OwnRecipient()
+	if err == nil {
+		fmt.Fprintf(
+			os.Stderr,
+			"✓ Using existing identity %s.\n",
+			commands.IdentityPath,
+		)
+		return recipient, nil
+	}
+	if !errors.Is(err, commands.ErrNoIdentity) {
+		return "", err
+	}
+
+	identity, recipient, err := crypto.GenerateIdentity()
+	if err != nil {
+		return "", err
+	}
+
+	path := commands.IdentityPath
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return "", fmt.Errorf("failed to create directory: %w", err)
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", fmt.Errorf("failed to create identity: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := fmt.Fprintf(
+		f,
+		"# apiki identity, keep it private\n# recipient: %s\n%s\n",
+		recipient,
+		identity,
+	); err != nil {
+		return "", fmt.Errorf("failed to write identity: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("failed to write identity: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Created identity %s.\n", path)
+	return recipient, nil
+}
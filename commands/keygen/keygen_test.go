@@ -0,0 +1,57 @@
+package keygen
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/crypto"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("creates a private identity", func(t *testing.T) {
+		commands.IdentityPath = filepath.Join(t.TempDir(), "keys", "identity")
+
+		recipient, err := Run()
+		require.NoError(t, err)
+
+		info, err := os.Stat(commands.IdentityPath)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+		identity, err := commands.ReadIdentity()
+		require.NoError(t, err)
+		own, err := crypto.RecipientOf(identity)
+		require.NoError(t, err)
+		require.Equal(t, own, recipient)
+	})
+
+	t.Run("keeps an existing identity", func(t *testing.T) {
+		commands.IdentityPath = filepath.Join(t.TempDir(), "identity")
+		first, err := Run()
+		require.NoError(t, err)
+		data, err := os.ReadFile(commands.IdentityPath)
+		require.NoError(t, err)
+
+		second, err := Run()
+		require.NoError(t, err)
+		require.Equal(t, first, second)
+		saved, err := os.ReadFile(commands.IdentityPath)
+		require.NoError(t, err)
+		require.Equal(t, data, saved)
+	})
+
+	t.Run("refuses an invalid identity", func(t *testing.T) {
+		commands.IdentityPath = filepath.Join(t.TempDir(), "identity")
+		data := []byte("not-an-identity\n")
+		require.NoError(t, os.WriteFile(commands.IdentityPath, data, 0o600))
+
+		_, err := Run()
+		require.Error(t, err)
+		saved, err := os.ReadFile(commands.IdentityPath)
+		require.NoError(t, err)
+		require.Equal(t, data, saved)
+	})
+}
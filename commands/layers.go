@@ -0,0 +1,447 @@
+package commands
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// StrictPermissions makes loading a variables file that other users can access
+// an error instead of a warning.
+var StrictPermissions bool
+
+// Layer is one of several variables files loaded together, e.g. a personal
+// file and a shared team file.
+type Layer struct {
+	// Path is the path to the variables file.
+	Path string
+
+	// File holds the variables file, decrypted in memory once unlocked.
+	File *entries.File
+
+	encryptionKey []byte
+
+	// checksum is the checksum of the file as last loaded or saved, to detect
+	// changes made by other processes
+	checksum string
+}
+
+// ConflictError is returned by Save when a variables file was changed on disk
+// by another process since it was loaded.
+type ConflictError struct {
+	// Index is the index of the layer of the file.
+	Index int
+
+	// Path is the path to the file.
+	Path string
+}
+
+func (e *ConflictError) Error() string {
+	return e.Path + " was changed by another process"
+}
+
+// Layers is a stack of variables files shown as a single list. The first
+// layer is the default layer: new variables are added to it, and the config
+// file lives next to it.
+type Layers []*Layer
+
+// LoadLayers loads the variables files at paths, without unlocking them.
+// Files that other users can access are reported, or refused if
+// StrictPermissions is set.
+// Entries without an ID, e.g. added by hand, are given one, and their file is
+// saved. Files of older versions are migrated and saved too, the files are
+// locked while loading: the caller must not hold their lock, see LoadStore.
+//
+// If NonInteractive is set, files encrypted as a whole that need a password
+// are skipped with a warning.
+func LoadLayers(paths []string) (Layers, error) {
+	lock, err := Lock(paths...)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	return loadLayers(paths)
+}
+
+// loadLayers is like LoadLayers, for callers holding the lock of the files.
+func loadLayers(paths []string) (Layers, error) {
+	layers := make(Layers, 0, len(paths))
+	for _, path := range paths {
+		if err := checkPermissions(path); err != nil {
+			return nil, err
+		}
+
+		file, err := entries.Load(path)
+		if NonInteractive && errors.Is(err, ErrPasswordRequired) {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: warning: skipped %s, it needs a password\n",
+				path,
+			)
+			continue
+		}
+		if err != nil {
+			if len(paths) > 1 {
+				err = fmt.Errorf("%s: %w", path, err)
+			}
+			return nil, fmt.Errorf("could not load variables file: %w", err)
+		}
+
+		// IDs are not encrypted, the file can be saved while locked
+		if file.AssignIDs() {
+			if err := entries.Save(path, file); err != nil {
+				return nil, fmt.Errorf("failed to save variables: %w", err)
+			}
+		}
+
+		sum, err := checksum(path)
+		if err != nil {
+			return nil, fmt.Errorf("could not load variables file: %w", err)
+		}
+
+		layers = append(layers, &Layer{Path: path, File: file, checksum: sum})
+	}
+	return layers, nil
+}
+
+// DefaultVariablesPaths holds the paths of the variables files loaded by
+// default, without --variables-file flags.
+var DefaultVariablesPaths []string
+
+// LoadConfig loads the config file. Config files of older versions are
+// migrated once, replacing the positional IDs they saved with the IDs of the
+// entries of layers, and saved. Positional IDs are computed from the entries
+// of the default variables files: if other files are loaded, they are kept
+// and a warning tells which files to load. The file is locked while loading:
+// the caller must not hold its lock, see LoadStore.
+func LoadConfig(configPath string, layers Layers) (*config.Config, error) {
+	lock, err := Lock(configPath)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release()
+
+	return loadConfig(configPath, layers)
+}
+
+// loadConfig is like LoadConfig, for callers holding the lock of the file.
+func loadConfig(configPath string, layers Layers) (*config.Config, error) {
+	if !sameFiles(layers.Paths(), DefaultVariablesPaths) {
+		cfg, err := config.Load(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not load config file: %w", err)
+		}
+		if cfg.HasPositionalIDs() {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: warning: %s holds selections of an older version, "+
+					"load %s alone to migrate them\n",
+				configPath,
+				strings.Join(DefaultVariablesPaths, ", "),
+			)
+		}
+		return cfg, nil
+	}
+
+	list, _ := layers.Entries()
+	cfg, err := config.LoadWithEntries(configPath, list)
+	if err != nil {
+		return nil, fmt.Errorf("could not load config file: %w", err)
+	}
+	return cfg, nil
+}
+
+// sameFiles returns true if paths and other are the paths of the same files,
+// in the same order.
+func sameFiles(paths []string, other []string) bool {
+	return slices.EqualFunc(paths, other, func(a, b string) bool {
+		absA, errA := filepath.Abs(a)
+		absB, errB := filepath.Abs(b)
+		if errA != nil || errB != nil {
+			return a == b
+		}
+		return absA == absB
+	})
+}
+
+// Unlock unlocks and decrypts the layer at index if it is encrypted. When
+// several layers are loaded, each is unlocked separately.
+func (ls Layers) Unlock(index int) error {
+	if !ls.Locked(index) {
+		return nil
+	}
+
+	layer := ls[index]
+	if len(ls) > 1 && layer.File.Key() == nil {
+		fmt.Fprintf(os.Stderr, "Unlocking %s...\n", layer.Path)
+	}
+	key, err := Unlock(layer.File)
+	if err != nil {
+		return fmt.Errorf("failed to unlock file: %w", err)
+	}
+	return ls.UnlockWithKey(index, key)
+}
+
+// UnlockWithKey decrypts the layer at index with key.
+func (ls Layers) UnlockWithKey(index int, key []byte) error {
+	layer := ls[index]
+	if err := layer.File.DecryptValues(key); err != nil {
+		return fmt.Errorf("failed to decrypt variables: %w", err)
+	}
+	layer.encryptionKey = key
+	return nil
+}
+
+// Locked returns true if the layer at index is encrypted and was not
+// unlocked yet. The secret values of a locked layer are encrypted in memory.
+func (ls Layers) Locked(index int) bool {
+	return ls[index].File.Encrypted() && ls[index].encryptionKey == nil
+}
+
+// Reload reads the layer at index from disk again, discarding the entries in
+// memory. An unlocked layer is decrypted with the key it was unlocked with,
+// and a file encrypted as a whole with the key it was loaded with.
+//
+// The file may be migrated and saved: the caller should hold its lock.
+func (ls Layers) Reload(index int) error {
+	layer := ls[index]
+	file, err := entries.LoadWithKey(layer.Path, layer.File.Key())
+	if err != nil {
+		return fmt.Errorf("could not load variables file: %w", err)
+	}
+	if file.AssignIDs() {
+		if err := entries.Save(layer.Path, file); err != nil {
+			return fmt.Errorf("failed to save variables: %w", err)
+		}
+	}
+	sum, err := checksum(layer.Path)
+	if err != nil {
+		return fmt.Errorf("could not load variables file: %w", err)
+	}
+
+	if file.Encrypted() && layer.encryptionKey != nil {
+		if err := file.DecryptValues(layer.encryptionKey); err != nil {
+			return fmt.Errorf("failed to decrypt variables: %w", err)
+		}
+	}
+
+	layer.File = file
+	layer.checksum = sum
+	return nil
+}
+
+// Entries returns the entries of all layers, sorted, along with the index of
+// the layer of each entry. Entries that compare equal are ordered by layer,
+// so that entry IDs don't depend on the sort algorithm.
+func (ls Layers) Entries() ([]entries.Entry, []int) {
+	var (
+		list   []entries.Entry
+		layers []int
+	)
+	for i, layer := range ls {
+		for _, entry := range layer.File.Entries {
+			list = append(list, entry)
+			layers = append(layers, i)
+		}
+	}
+
+	order := sortOrder(list, layers)
+	sorted := make([]entries.Entry, len(order))
+	sortedLayers := make([]int, len(order))
+	for i, j := range order {
+		sorted[i] = list[j]
+		sortedLayers[i] = layers[j]
+	}
+	return sorted, sortedLayers
+}
+
+// Reveal decrypts in place the values of the entries of list at indices, where
+// layerOf holds the index of the layer of each entry. The layers holding
+// secret values among them are unlocked.
+func (ls Layers) Reveal(
+	list []entries.Entry,
+	layerOf []int,
+	indices ...int,
+) error {
+	for _, i := range indices {
+		if !list[i].Secret {
+			continue
+		}
+		if err := ls.Unlock(layerOf[i]); err != nil {
+			return err
+		}
+
+		layer := ls[layerOf[i]]
+		j := slices.IndexFunc(
+			layer.File.Entries,
+			func(entry entries.Entry) bool {
+				return entry.ID == list[i].ID
+			},
+		)
+		if j >= 0 {
+			list[i].Value = layer.File.Entries[j].Value
+		}
+	}
+	return nil
+}
+
+// Save writes back the layers whose entries changed, encrypting secret values
+// if encryption is enabled. list holds the entries of all layers, and layers
+// the index of the layer of each entry. Layers left untouched are not written,
+// so that shared files don't change needlessly. A locked layer can be written
+// as long as no secret value needs encrypting.
+//
+// The caller should hold the lock of the files. If a file to write was changed
+// by another process since it was loaded, nothing is written and a
+// *ConflictError is returned.
+func (ls Layers) Save(list []entries.Entry, layers []int) error {
+	changed := make([]*entries.File, len(ls))
+	for i, layer := range ls {
+		var layerEntries []entries.Entry
+		for j, entry := range list {
+			if layers[j] == i {
+				layerEntries = append(layerEntries, entry)
+			}
+		}
+		slices.SortStableFunc(layerEntries, entries.Compare)
+
+		if slices.EqualFunc(
+			layerEntries,
+			layer.File.Entries,
+			entries.Entry.Equal,
+		) {
+			continue
+		}
+
+		// Work on a copy to avoid mutating the in-memory state
+		toSave := layer.File.Clone()
+		toSave.Entries = append([]entries.Entry{}, layerEntries...)
+		if ls.Locked(i) && toSave.NeedsEncryption() {
+			return fmt.Errorf("%s is locked", layer.Path)
+		}
+
+		sum, err := checksum(layer.Path)
+		if err != nil {
+			return fmt.Errorf("failed to save variables: %w", err)
+		}
+		if sum != layer.checksum {
+			return &ConflictError{Index: i, Path: layer.Path}
+		}
+		changed[i] = toSave
+	}
+
+	for i, layer := range ls {
+		toSave := changed[i]
+		if toSave == nil {
+			continue
+		}
+
+		// Keep the in-memory state decrypted
+		saved := slices.Clone(toSave.Entries)
+		if toSave.Encrypted() && !ls.Locked(i) {
+			if err := toSave.EncryptValues(layer.encryptionKey); err != nil {
+				return fmt.Errorf("failed to encrypt variables: %w", err)
+			}
+		}
+
+		if err := entries.Save(layer.Path, toSave); err != nil {
+			return fmt.Errorf("failed to save variables: %w", err)
+		}
+
+		layer.File.Entries = saved
+		sum, err := checksum(layer.Path)
+		if err != nil {
+			return fmt.Errorf("failed to save variables: %w", err)
+		}
+		layer.checksum = sum
+	}
+	return nil
+}
+
+// Paths returns the paths of the variables files.
+func (ls Layers) Paths() []string {
+	paths := make([]string, len(ls))
+	for i, layer := range ls {
+		paths[i] = layer.Path
+	}
+	return paths
+}
+
+// Names returns a short name for each layer, to tell where an entry comes
+// from: the file name without extension, prefixed by the directory name if
+// several layers share a file name.
+func (ls Layers) Names() []string {
+	names := make([]string, len(ls))
+	count := make(map[string]int)
+	for i, layer := range ls {
+		base := filepath.Base(layer.Path)
+		names[i] = strings.TrimSuffix(base, filepath.Ext(base))
+		count[names[i]]++
+	}
+
+	for i, layer := range ls {
+		if count[names[i]] > 1 {
+			dir := filepath.Base(filepath.Dir(layer.Path))
+			names[i] = dir + "/" + names[i]
+		}
+	}
+	return names
+}
+
+// checkPermissions warns about a variables file that other users can access,
+// or returns an error if StrictPermissions is set.
+func checkPermissions(path string) error {
+	err := entries.CheckPermissions(path)
+	if !errors.Is(err, entries.ErrInsecurePermissions) {
+		return err
+	}
+	if StrictPermissions {
+		return fmt.Errorf("%w, run `apiki fix-permissions`", err)
+	}
+	fmt.Fprintf(
+		os.Stderr,
+		"apiki: warning: %s, run `apiki fix-permissions`\n",
+		err,
+	)
+	return nil
+}
+
+// checksum returns the checksum of the content of the file at path, or an
+// empty string if it doesn't exist.
+func checksum(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// sortOrder returns the positions of the entries of list in the order of the
+// interface. Entries that compare equal are ordered by layer, so that entry
+// IDs don't depend on the sort algorithm.
+func sortOrder(list []entries.Entry, layers []int) []int {
+	order := make([]int, len(list))
+	for i := range order {
+		order[i] = i
+	}
+	slices.SortStableFunc(order, func(a, b int) int {
+		if c := entries.Compare(list[a], list[b]); c != 0 {
+			return c
+		}
+		return layers[a] - layers[b]
+	})
+	return order
+}
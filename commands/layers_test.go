@@ -0,0 +1,109 @@
+package commands
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/filelock"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+func TestLoadLayers(t *testing.T) {
+	t.Run("migrates files holding their lock", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "variables.json")
+		data := []byte(`{"entries": [{"name": "VAR1", "value": "v"}]}`)
+		require.NoError(t, os.WriteFile(path, data, 0o600))
+
+		lock, err := filelock.TryAcquire(path)
+		require.NoError(t, err)
+
+		loaded := make(chan error)
+		go func() {
+			_, err := LoadLayers([]string{path})
+			loaded <- err
+		}()
+
+		// The file is left untouched while another process holds the lock
+		select {
+		case err := <-loaded:
+			t.Fatalf("loaded while locked: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+		saved, err := os.ReadFile(path)
+		require.NoError(t, err)
+		require.Equal(t, data, saved)
+
+		lock.Release()
+		require.NoError(t, <-loaded)
+
+		saved, err = os.ReadFile(path)
+		require.NoError(t, err)
+		require.NotEqual(t, data, saved)
+		_, err = os.Stat(path + ".v0.bak")
+		require.NoError(t, err)
+
+		// The lock is released once loaded
+		lock, err = filelock.TryAcquire(path)
+		require.NoError(t, err)
+		lock.Release()
+	})
+}
+
+func TestLoadConfig(t *testing.T) {
+	// setUp writes a personal and a team file, each with a VAR1 variable,
+	// and a config of version 1 selecting VAR1[1]. Returns the layers of both
+	// files and the path of the config.
+	setUp := func(t *testing.T) (Layers, string) {
+		t.Helper()
+
+		dir := t.TempDir()
+		paths := []string{
+			filepath.Join(dir, "personal.json"),
+			filepath.Join(dir, "team.json"),
+		}
+		for i, id := range []string{"1", "2"} {
+			file := &entries.File{
+				ID:      entries.NewID(),
+				Entries: []entries.Entry{{ID: id, Name: "VAR1", Value: "v"}},
+			}
+			require.NoError(t, entries.Save(paths[i], file))
+		}
+		configPath := filepath.Join(dir, "config.json")
+		data := []byte(`{"version": 1, "selected": ["VAR1[1]"]}`)
+		require.NoError(t, os.WriteFile(configPath, data, 0o600))
+
+		layers, err := LoadLayers(paths)
+		require.NoError(t, err)
+		DefaultVariablesPaths = paths
+		t.Cleanup(func() { DefaultVariablesPaths = nil })
+		return layers, configPath
+	}
+
+	t.Run("migrates with the default files", func(t *testing.T) {
+		layers, configPath := setUp(t)
+
+		cfg, err := LoadConfig(configPath, layers)
+		require.NoError(t, err)
+		require.False(t, cfg.HasPositionalIDs())
+		require.Equal(t, set.New("2"), cfg.Selected)
+	})
+
+	t.Run("keeps positional IDs with other files", func(t *testing.T) {
+		layers, configPath := setUp(t)
+
+		cfg, err := LoadConfig(configPath, layers[1:])
+		require.NoError(t, err)
+		require.True(t, cfg.HasPositionalIDs())
+		require.Equal(t, set.New("VAR1[1]"), cfg.Selected)
+
+		// The next load with the default files migrates
+		cfg, err = LoadConfig(configPath, layers)
+		require.NoError(t, err)
+		require.Equal(t, set.New("2"), cfg.Selected)
+	})
+}
@@ -0,0 +1,196 @@
+package list
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/apiki"
+)
+
+// Output formats supported by the list command.
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+	FormatNames = "names"
+)
+
+// Options holds the flags of the list command.
+type Options struct {
+	// Format is one of FormatTable, FormatJSON or FormatNames.
+	Format string
+
+	// ShowValues includes variable values in the output. Unlocks the
+	// variables files that are encrypted.
+	ShowValues bool
+
+	// Tags restricts the output to variables having all of these tags.
+	// Variables from .env files have no tags.
+	Tags []string
+}
+
+// item is a single row of the list output.
+type item struct {
+	ID       string   `json:"id,omitempty"`
+	Name     string   `json:"name"`
+	Label    string   `json:"label"`
+	Tags     []string `json:"tags,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	Secret   bool     `json:"secret"`
+	Selected bool     `json:"selected"`
+	Source   string   `json:"source"`
+}
+
+// Run loads the variables files, the config file and the .env files found
+// upward from the working directory, and formats all entries for output.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	opts Options,
+) (string, error) {
+	if !slices.Contains(
+		[]string{FormatTable, FormatJSON, FormatNames},
+		opts.Format,
+	) {
+		return "", fmt.Errorf("invalid format: %q", opts.Format)
+	}
+
+	layers, err := commands.LoadLayers(variablesPaths)
+	if err != nil {
+		return "", err
+	}
+
+	list, layerOf := layers.Entries()
+	cfg, err := commands.LoadConfig(configPath, layers)
+	if err != nil {
+		return "", err
+	}
+
+	var indices []int
+	for i, entry := range list {
+		if !slices.ContainsFunc(opts.Tags, func(tag string) bool {
+			return !entry.HasTag(tag)
+		}) {
+			indices = append(indices, i)
+		}
+	}
+
+	// Values are only needed when displayed, don't prompt otherwise
+	if opts.ShowValues {
+		if err := layers.Reveal(list, layerOf, indices...); err != nil {
+			return "", err
+		}
+	}
+
+	items := make([]item, 0, len(list))
+	for _, i := range indices {
+		entry := list[i]
+		items = append(items, item{
+			ID:       entry.ID,
+			Name:     entry.Name,
+			Label:    entry.Label,
+			Tags:     entry.Tags,
+			Value:    entry.Value,
+			Secret:   entry.Secret,
+			Selected: cfg.Selected.Has(entry.ID),
+			Source:   layers[layerOf[i]].Path,
+		})
+	}
+
+	// .env variables have no tags
+	var dotEnvEntries []apiki.Entry
+	if len(opts.Tags) == 0 {
+		dotEnvEntries, err = apiki.LoadDotEnvEntries()
+		if err != nil {
+			return "", fmt.Errorf("could not load .env variables: %w", err)
+		}
+	}
+	apiki.SortEntries(dotEnvEntries)
+	for _, entry := range dotEnvEntries {
+		items = append(items, item{
+			Name:   entry.Name,
+			Label:  entry.Label,
+			Value:  entry.Value,
+			Source: entry.SourceFile,
+		})
+	}
+
+	if !opts.ShowValues {
+		for i := range items {
+			items[i].Value = ""
+		}
+	}
+
+	switch opts.Format {
+	case FormatJSON:
+		return formatJSON(items)
+	case FormatNames:
+		return formatNames(items), nil
+	default:
+		return formatTable(items, opts.ShowValues), nil
+	}
+}
+
+// formatJSON formats items as an indented JSON array.
+func formatJSON(items []item) (string, error) {
+	data, err := json.MarshalIndent(items, "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return string(data), nil
+}
+
+// formatNames returns the distinct variable names, one per line.
+func formatNames(items []item) string {
+	names := make([]string, 0, len(items))
+	for _, it := range items {
+		names = append(names, it.Name)
+	}
+	slices.Sort(names)
+	return strings.Join(slices.Compact(names), "\n")
+}
+
+// formatTable formats items as an aligned table with a header row.
+func formatTable(items []item, showValues bool) string {
+	if len(items) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	w := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+
+	header := []string{"NAME", "LABEL", "TAGS", "SECRET", "SELECTED", "SOURCE"}
+	if showValues {
+		header = append(header, "VALUE")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	for _, it := range items {
+		row := []string{
+			it.Name,
+			it.Label,
+			strings.Join(it.Tags, ","),
+			yesNo(it.Secret),
+			yesNo(it.Selected),
+			it.Source,
+		}
+		if showValues {
+			row = append(row, it.Value)
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	_ = w.Flush()
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// yesNo formats b for a table cell.
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
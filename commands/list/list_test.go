@@ -0,0 +1,167 @@
+package list
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp writes a plaintext file with a tagged HOST and two variants of URL, a
+// keychain file whose key is missing from the keychain, so that it can't be
+// unlocked, and a config selecting the prod URL. A .env file defining DEBUG
+// is written in the working directory. Returns the paths of the files and of
+// the config.
+func setUp(t *testing.T) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "HOST", Value: "localhost", Tags: []string{"db"}},
+			{ID: "2", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "3", Name: "URL", Value: "prod", Label: "prod"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "4", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	file.SetKeychainMode("encryption-key-missing")
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{Selected: set.New("3")}
+	require.NoError(t, config.Save(configPath, cfg))
+
+	project := filepath.Join(dir, "project")
+	require.NoError(t, os.Mkdir(project, 0o700))
+	data := []byte("DEBUG=1\n")
+	require.NoError(
+		t,
+		os.WriteFile(filepath.Join(project, ".env"), data, 0o600),
+	)
+	t.Chdir(project)
+	return paths, configPath
+}
+
+func TestRun(t *testing.T) {
+	t.Run("formats the variables", func(t *testing.T) {
+		for _, tt := range []struct {
+			name     string
+			opts     Options
+			contains []string
+			excludes []string
+		}{
+			{
+				name:     "names",
+				opts:     Options{Format: FormatNames},
+				contains: []string{"DEBUG\nHOST\nTOKEN\nURL"},
+			},
+			{
+				name: "table",
+				opts: Options{Format: FormatTable},
+				contains: []string{
+					"NAME", "SELECTED", "db", "prod", "personal.json",
+					"team.json", ".env",
+				},
+				excludes: []string{"VALUE", "localhost"},
+			},
+			{
+				name:     "names with tag",
+				opts:     Options{Format: FormatNames, Tags: []string{"db"}},
+				contains: []string{"HOST"},
+				excludes: []string{"URL", "TOKEN", "DEBUG"},
+			},
+			{
+				name: "values of the tagged variables",
+				opts: Options{
+					Format:     FormatTable,
+					ShowValues: true,
+					Tags:       []string{"db"},
+				},
+				contains: []string{"VALUE", "localhost"},
+				excludes: []string{"TOKEN"},
+			},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				paths, configPath := setUp(t)
+
+				output, err := Run(paths, configPath, tt.opts)
+				require.NoError(t, err)
+				for _, s := range tt.contains {
+					require.Contains(t, output, s)
+				}
+				for _, s := range tt.excludes {
+					require.NotContains(t, output, s)
+				}
+			})
+		}
+	})
+
+	t.Run("formats JSON with the selection", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		output, err := Run(paths, configPath, Options{Format: FormatJSON})
+		require.NoError(t, err)
+		var items []item
+		require.NoError(t, json.Unmarshal([]byte(output), &items))
+
+		selected := make(map[string]bool)
+		for _, it := range items {
+			require.Empty(t, it.Value)
+			selected[it.ID] = it.Selected
+		}
+		require.Equal(
+			t,
+			map[string]bool{
+				"1": false, "2": false, "3": true, "4": false, "": false,
+			},
+			selected,
+		)
+	})
+
+	t.Run("unlocks files to show values", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		_, err := Run(
+			paths,
+			configPath,
+			Options{Format: FormatTable, ShowValues: true},
+		)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to unlock file")
+	})
+
+	t.Run("rejects invalid format", func(t *testing.T) {
+		_, err := Run(nil, "", Options{Format: "xml"})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid format")
+	})
+}
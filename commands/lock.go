@@ -0,0 +1,30 @@
+package commands
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/loderunner/apiki/internal/filelock"
+)
+
+// NonInteractive makes commands fail rather than wait for other apiki
+// processes or prompt for a password, for the prompt hook: Lock returns
+// filelock.ErrLocked, Unlock returns ErrPasswordRequired, and LoadLayers skips
+// with a warning the files encrypted as a whole that need a password.
+var NonInteractive bool
+
+// Lock locks the files at paths against other apiki processes for the time of
+// a load-modify-save, waiting for them to be released if needed, unless
+// NonInteractive is set.
+func Lock(paths ...string) (*filelock.Lock, error) {
+	lock, err := filelock.TryAcquire(paths...)
+	if errors.Is(err, filelock.ErrLocked) && !NonInteractive {
+		fmt.Fprintf(os.Stderr, "Waiting for another apiki process...\n")
+		lock, err = filelock.Acquire(paths...)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return lock, nil
+}
@@ -0,0 +1,58 @@
+package permissions
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// Fix restricts the variables files to their owner, along with the config
+// file, the trust database, the identity file and the backups written when
+// upgrading them. Files that don't exist are skipped.
+func Fix(
+	variablesPaths []string,
+	configPath, trustPath, identityPath string,
+) error {
+	var paths []string
+	for _, path := range append(
+		slices.Clone(variablesPaths),
+		configPath,
+		trustPath,
+		identityPath,
+	) {
+		backups, err := filepath.Glob(path + ".v*.bak")
+		if err != nil {
+			return err
+		}
+		paths = append(paths, path)
+		paths = append(paths, backups...)
+	}
+
+	fixed := 0
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		mode := info.Mode().Perm()
+		if mode&0o077 == 0 {
+			continue
+		}
+		if err := os.Chmod(path, mode&0o700); err != nil {
+			return fmt.Errorf("failed to change permissions: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "✓ Restricted %s to its owner.\n", path)
+		fixed++
+	}
+
+	if fixed == 0 {
+		fmt.Fprintf(os.Stderr, "✓ Permissions are already restricted.\n")
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+//go:build unix
+
+package permissions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFix(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		mode os.FileMode
+		want os.FileMode
+	}{
+		{name: "readable by others", mode: 0o644, want: 0o600},
+		{name: "writable by group", mode: 0o660, want: 0o600},
+		{name: "executable by all", mode: 0o755, want: 0o700},
+		{name: "already restricted", mode: 0o600, want: 0o600},
+		{name: "read only", mode: 0o400, want: 0o400},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			paths := []string{
+				filepath.Join(dir, "personal.json"),
+				filepath.Join(dir, "team.json"),
+				filepath.Join(dir, "personal.json.v1.bak"),
+				filepath.Join(dir, "config.json"),
+				filepath.Join(dir, "trust.json"),
+				filepath.Join(dir, "identity.txt"),
+			}
+			for _, path := range paths {
+				require.NoError(t, os.WriteFile(path, nil, 0o600))
+				require.NoError(t, os.Chmod(path, tt.mode))
+			}
+
+			err := Fix(
+				paths[:2],
+				paths[3],
+				paths[4],
+				paths[5],
+			)
+			require.NoError(t, err)
+			for _, path := range paths {
+				info, err := os.Stat(path)
+				require.NoError(t, err)
+				require.Equal(t, tt.want, info.Mode().Perm(), path)
+			}
+		})
+	}
+
+	t.Run("skips missing files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "variables.json")
+		require.NoError(t, os.WriteFile(path, nil, 0o600))
+		require.NoError(t, os.Chmod(path, 0o644))
+
+		err := Fix(
+			[]string{path},
+			filepath.Join(dir, "config.json"),
+			filepath.Join(dir, "trust.json"),
+			"",
+		)
+		require.NoError(t, err)
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("leaves other files untouched", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "variables.json")
+		other := filepath.Join(dir, "other.json")
+		for _, p := range []string{path, other} {
+			require.NoError(t, os.WriteFile(p, nil, 0o600))
+			require.NoError(t, os.Chmod(p, 0o644))
+		}
+
+		err := Fix([]string{path}, "", "", "")
+		require.NoError(t, err)
+		info, err := os.Stat(other)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o644), info.Mode().Perm())
+	})
+}
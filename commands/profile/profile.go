@@ -0,0 +1,140 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/apiki"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/set"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+// ErrNotFound is returned when no profile has the given name.
+var ErrNotFound = errors.New("profile not found")
+
+// List returns the names of all profiles, one per line.
+func List(configPath string) (string, error) {
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return "", fmt.Errorf("could not load config file: %w", err)
+	}
+	return strings.Join(cfg.ProfileNames(), "\n"), nil
+}
+
+// Save stores the current selection as a profile named name, replacing any
+// existing profile with that name.
+func Save(configPath, name string) error {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return errors.New("profile name cannot be empty")
+	}
+
+	lock, err := commands.Lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("could not load config file: %w", err)
+	}
+
+	cfg.Profiles[name] = set.New(cfg.Selected.Members()...)
+	if err := config.Save(configPath, cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	variableWord := "variables"
+	if len(cfg.Selected) == 1 {
+		variableWord = "variable"
+	}
+	fmt.Fprintf(
+		os.Stderr,
+		"✓ Saved profile %s with %d selected %s.\n",
+		name,
+		len(cfg.Selected),
+		variableWord,
+	)
+	return nil
+}
+
+// Apply replaces the current selection with the profile named name. The
+// selection is saved, and the returned shell commands, in the syntax of the
+// given emitter, export or unset the variables whose state changed.
+func Apply(
+	variablesPaths []string,
+	configPath, name string,
+	sh shell.Emitter,
+) (string, error) {
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	profile, ok := store.Config.Profiles[name]
+	if !ok {
+		return "", &commands.ExitError{
+			Code: get.ExitNotFound,
+			Err:  fmt.Errorf("%w: %q", ErrNotFound, name),
+		}
+	}
+
+	var selected []int
+	for i, entry := range store.Entries {
+		store.Selected[i] = profile.Has(entry.ID)
+		if store.Selected[i] {
+			selected = append(selected, i)
+		}
+	}
+	if err := store.Reveal(selected...); err != nil {
+		return "", err
+	}
+
+	if err := store.SaveSelection(); err != nil {
+		return "", err
+	}
+
+	all := make([]apiki.Entry, len(store.Entries))
+	for i, entry := range store.Entries {
+		all[i] = apiki.Entry{Entry: entry, Selected: store.Selected[i]}
+	}
+
+	env := apiki.CaptureEnvironment(all)
+	return apiki.GenerateShellCommands(all, env, sh), nil
+}
+
+// Delete removes the profile named name.
+func Delete(configPath, name string) error {
+	lock, err := commands.Lock(configPath)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		return fmt.Errorf("could not load config file: %w", err)
+	}
+
+	if _, ok := cfg.Profiles[name]; !ok {
+		return &commands.ExitError{
+			Code: get.ExitNotFound,
+			Err:  fmt.Errorf("%w: %q", ErrNotFound, name),
+		}
+	}
+
+	delete(cfg.Profiles, name)
+	if err := config.Save(configPath, cfg); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Deleted profile %s.\n", name)
+	return nil
+}
@@ -0,0 +1,168 @@
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp writes a plaintext file with HOST and two variants of URL, a keychain
+// file whose key is missing from the keychain, so that it can't be unlocked,
+// and a config selecting the dev URL, with a "prod" profile selecting HOST
+// and the prod URL and a "team" profile selecting the secret TOKEN. Returns
+// the paths of the files and of the config.
+func setUp(t *testing.T) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "2", Name: "URL", Value: "prod", Label: "prod"},
+			{ID: "3", Name: "HOST", Value: "localhost"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "4", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	file.SetKeychainMode("encryption-key-missing")
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{
+		Selected: set.New("1"),
+		Profiles: map[string]set.Set[string]{
+			"prod": set.New("2", "3"),
+			"team": set.New("4"),
+		},
+	}
+	require.NoError(t, config.Save(configPath, cfg))
+
+	t.Setenv("URL", "dev")
+	t.Setenv("HOST", "")
+	t.Setenv("TOKEN", "")
+	return paths, configPath
+}
+
+// load returns the config at path.
+func load(t *testing.T, path string) *config.Config {
+	t.Helper()
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	return cfg
+}
+
+// requireNotFound fails the test unless err is a *commands.ExitError for a
+// missing profile.
+func requireNotFound(t *testing.T, err error) {
+	t.Helper()
+
+	require.ErrorIs(t, err, ErrNotFound)
+	var exitErr *commands.ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, get.ExitNotFound, exitErr.Code)
+}
+
+func TestSave(t *testing.T) {
+	t.Run("saves the selection, replacing profiles", func(t *testing.T) {
+		for _, name := range []string{"dev", "prod"} {
+			_, configPath := setUp(t)
+
+			require.NoError(t, Save(configPath, " "+name+" "))
+			cfg := load(t, configPath)
+			require.Equal(t, set.New("1"), cfg.Profiles[name])
+		}
+	})
+
+	t.Run("refuses an empty name", func(t *testing.T) {
+		_, configPath := setUp(t)
+
+		err := Save(configPath, " ")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "cannot be empty")
+	})
+}
+
+func TestList(t *testing.T) {
+	_, configPath := setUp(t)
+	require.NoError(t, Save(configPath, "dev"))
+
+	output, err := List(configPath)
+	require.NoError(t, err)
+	require.Equal(t, "dev\nprod\nteam", output)
+}
+
+func TestApply(t *testing.T) {
+	t.Run("replaces the selection", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		output, err := Apply(paths, configPath, "prod", shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Contains(t, output, "export URL='prod'")
+		require.Contains(t, output, "export HOST='localhost'")
+		require.NotContains(t, output, "TOKEN")
+		require.Equal(t, set.New("2", "3"), load(t, configPath).Selected)
+	})
+
+	t.Run("keeps the selection if unlocking fails", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		_, err := Apply(paths, configPath, "team", shell.PosixEmitter{})
+		require.Error(t, err)
+		require.Equal(t, set.New("1"), load(t, configPath).Selected)
+	})
+
+	t.Run("rejects unknown profiles", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		_, err := Apply(paths, configPath, "staging", shell.PosixEmitter{})
+		requireNotFound(t, err)
+		require.Equal(t, set.New("1"), load(t, configPath).Selected)
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("removes the profile", func(t *testing.T) {
+		_, configPath := setUp(t)
+
+		require.NoError(t, Delete(configPath, "prod"))
+		require.Equal(t, []string{"team"}, load(t, configPath).ProfileNames())
+	})
+
+	t.Run("rejects unknown profiles", func(t *testing.T) {
+		_, configPath := setUp(t)
+
+		requireNotFound(t, Delete(configPath, "staging"))
+	})
+}
@@ -0,0 +1,182 @@
+package recipients
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// ErrNotFound is returned when removing a public key that is not a recipient
+// of the file.
+var ErrNotFound = errors.New("recipient not found")
+
+// List returns the recipients of the variables file at path, one per line.
+// The recipient of the user's identity is marked.
+func List(path string) (string, error) {
+	file, err := load(path)
+	if err != nil {
+		return "", err
+	}
+
+	own, _ := commands.OwnRecipient()
+	lines := make([]string, 0, len(file.Encryption.Recipients))
+	for _, recipient := range file.RecipientKeys() {
+		if recipient == own {
+			recipient += " (you)"
+		}
+		lines = append(lines, recipient)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// Add wraps the data key of the variables file at path for more recipients,
+// so that they can unlock it with their identity.
+func Add(path string, recipients []string) error {
+	lock, err := commands.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	file, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	keys := file.RecipientKeys()
+	added := 0
+	for _, arg := range recipients {
+		recipient, err := crypto.ParseRecipient(arg)
+		if err != nil {
+			return err
+		}
+		if slices.Contains(keys, recipient) {
+			continue
+		}
+		keys = append(keys, recipient)
+		added++
+	}
+	if added == 0 {
+		fmt.Fprintf(os.Stderr, "✓ Already a recipient.\n")
+		return nil
+	}
+
+	key, err := commands.Unlock(file)
+	if err != nil {
+		return fmt.Errorf("failed to unlock file: %w", err)
+	}
+	if err := file.SetRecipientsMode(key, keys); err != nil {
+		return err
+	}
+
+	if err := entries.Save(path, file); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	fmt.Fprintf(os.Stderr, "✓ Added %d recipients.\n", added)
+	return nil
+}
+
+// Remove stops wrapping the data key of the variables file at path for some
+// recipients. The data key is rotated, so that the removed recipients can't
+// decrypt values changed afterwards.
+func Remove(path string, recipients []string) error {
+	lock, err := commands.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	file, err := load(path)
+	if err != nil {
+		return err
+	}
+
+	current := file.RecipientKeys()
+	keys := slices.Clone(current)
+	removed := 0
+	for _, arg := range recipients {
+		recipient := strings.TrimSpace(arg)
+		if !slices.Contains(current, recipient) {
+			return &commands.ExitError{
+				Code: get.ExitNotFound,
+				Err:  fmt.Errorf("%w: %q", ErrNotFound, recipient),
+			}
+		}
+		// A recipient listed twice is removed once
+		i := slices.Index(keys, recipient)
+		if i < 0 {
+			continue
+		}
+		keys = slices.Delete(keys, i, i+1)
+		removed++
+	}
+	if len(keys) == 0 {
+		return errors.New(
+			"cannot remove every recipient, " +
+				"use `apiki decrypt` to remove encryption",
+		)
+	}
+
+	oldKey, err := commands.Unlock(file)
+	if err != nil {
+		return fmt.Errorf("failed to unlock file: %w", err)
+	}
+	newKey, err := crypto.GenerateKey()
+	if err != nil {
+		return err
+	}
+
+	// Re-encrypt secret values with a new data key
+	if err := file.DecryptValues(oldKey); err != nil {
+		return fmt.Errorf("failed to decrypt variables: %w", err)
+	}
+	if err := file.EncryptValues(newKey); err != nil {
+		return fmt.Errorf("failed to encrypt variables: %w", err)
+	}
+	if err := file.SetRecipientsMode(newKey, keys); err != nil {
+		return err
+	}
+
+	if err := entries.Save(path, file); err != nil {
+		return fmt.Errorf("failed to save file: %w", err)
+	}
+
+	fmt.Fprintf(
+		os.Stderr,
+		"✓ Removed %d recipients and rotated the data key.\n",
+		removed,
+	)
+	return nil
+}
+
+// load loads the variables file at path, which must be encrypted for
+// recipients.
+func load(path string) (*entries.File, error) {
+	file, err := entries.Load(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load file: %w", err)
+	}
+
+	switch file.Encryption.Mode {
+	case "recipients":
+		return file, nil
+	case "":
+		return nil, errors.New(
+			"file is not encrypted, " +
+				"use `apiki encrypt` to encrypt it for recipients",
+		)
+	}
+	return nil, fmt.Errorf(
+		"file is encrypted with %s, "+
+			"use `apiki rotate` to encrypt it for recipients",
+		file.Encryption.Mode,
+	)
+}
@@ -0,0 +1,151 @@
+package recipients
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// setUp writes the identity of the user and a variables file with a secret,
+// encrypted for the user and for others. Returns the path of the file and the
+// recipient of the user.
+func setUp(t *testing.T, others ...string) (string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	identity, own, err := crypto.GenerateIdentity()
+	require.NoError(t, err)
+	commands.IdentityPath = filepath.Join(dir, "identity")
+	err = os.WriteFile(commands.IdentityPath, []byte(identity+"\n"), 0o600)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "variables.json")
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	require.NoError(
+		t,
+		file.SetRecipientsMode(key, append([]string{own}, others...)),
+	)
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(path, file))
+	return path, own
+}
+
+// newRecipient returns a new identity and its recipient.
+func newRecipient(t *testing.T) (string, string) {
+	t.Helper()
+
+	identity, recipient, err := crypto.GenerateIdentity()
+	require.NoError(t, err)
+	return identity, recipient
+}
+
+// reveal unlocks the variables file at path with identity and returns its
+// secret.
+func reveal(t *testing.T, path, identity string) (string, error) {
+	t.Helper()
+
+	file, err := entries.Load(path)
+	require.NoError(t, err)
+	key, err := file.UnwrapKey(identity)
+	if err != nil {
+		return "", err
+	}
+	require.NoError(t, file.DecryptValues(key))
+	return file.Entries[0].Value, nil
+}
+
+func TestList(t *testing.T) {
+	t.Run("marks the recipient of the user", func(t *testing.T) {
+		_, other := newRecipient(t)
+		path, own := setUp(t, other)
+
+		output, err := List(path)
+		require.NoError(t, err)
+		require.ElementsMatch(
+			t,
+			[]string{own + " (you)", other},
+			strings.Split(output, "\n"),
+		)
+	})
+
+	t.Run("rejects files not encrypted for recipients", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "variables.json")
+		require.NoError(
+			t,
+			entries.Save(path, &entries.File{ID: entries.NewID()}),
+		)
+
+		_, err := List(path)
+		require.ErrorContains(t, err, "file is not encrypted")
+	})
+}
+
+func TestAdd(t *testing.T) {
+	t.Run("lets new recipients unlock the file", func(t *testing.T) {
+		path, own := setUp(t)
+		identity, other := newRecipient(t)
+
+		require.NoError(t, Add(path, []string{other, own}))
+
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.ElementsMatch(t, []string{own, other}, file.RecipientKeys())
+		value, err := reveal(t, path, identity)
+		require.NoError(t, err)
+		require.Equal(t, "secret", value)
+	})
+
+	t.Run("rejects invalid recipients", func(t *testing.T) {
+		path, _ := setUp(t)
+
+		require.Error(t, Add(path, []string{"not-a-recipient"}))
+	})
+}
+
+func TestRemove(t *testing.T) {
+	t.Run("rotates the data key", func(t *testing.T) {
+		identity, other := newRecipient(t)
+		path, own := setUp(t, other)
+
+		require.NoError(t, Remove(path, []string{other, other}))
+
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		require.Equal(t, []string{own}, file.RecipientKeys())
+		_, err = reveal(t, path, identity)
+		require.Error(t, err)
+	})
+
+	t.Run("rejects unknown recipients", func(t *testing.T) {
+		path, _ := setUp(t)
+		_, other := newRecipient(t)
+
+		err := Remove(path, []string{other})
+		require.ErrorIs(t, err, ErrNotFound)
+		var exitErr *commands.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		require.Equal(t, get.ExitNotFound, exitErr.Code)
+	})
+
+	t.Run("keeps at least one recipient", func(t *testing.T) {
+		path, own := setUp(t)
+
+		err := Remove(path, []string{own})
+		require.ErrorContains(t, err, "cannot remove every recipient")
+	})
+}
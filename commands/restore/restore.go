@@ -2,59 +2,106 @@ package restore
 
 import (
 	"fmt"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/loderunner/apiki/commands"
-	"github.com/loderunner/apiki/internal/config"
 	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+	"github.com/loderunner/apiki/internal/shell"
 )
 
 // Run loads the config and variables files, then outputs export commands for
-// selected entries. Returns empty string if no entries are selected.
-func Run(variablesPath, configPath string) (string, error) {
-	// Load config
-	cfg, err := config.Load(configPath)
+// selected entries, in the syntax of the given emitter. Returns empty string if
+// no entries are selected.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	sh shell.Emitter,
+) (string, error) {
+	resolved, err := Resolve(variablesPaths, configPath)
 	if err != nil {
-		return "", fmt.Errorf("could not load config file: %w", err)
+		return "", err
+	}
+	if err := resolved.Reveal(resolved.Selected...); err != nil {
+		return "", err
 	}
 
-	// Load variables file
-	file, err := entries.Load(variablesPath)
-	if err != nil {
-		return "", fmt.Errorf("could not load variables file: %w", err)
+	// Generate export commands for selected entries
+	var commands []string
+	for _, i := range resolved.Selected {
+		entry := resolved.Entries[i]
+		commands = append(commands, sh.Export(entry.Name, entry.Value))
 	}
 
-	// If file is empty, return empty output
-	if len(file.Entries) == 0 {
-		return "", nil
+	return strings.Join(commands, "\n"), nil
+}
+
+// Resolved holds the entries of the variables files along with the selection
+// of the config.
+type Resolved struct {
+	// Entries are the entries of all variables files. The values of secret
+	// entries are encrypted until revealed.
+	Entries []entries.Entry
+
+	// Selected holds the indices of the entries selected in the config.
+	Selected []int
+
+	layers  commands.Layers
+	layerOf []int
+}
+
+// Reveal decrypts the values of the entries at indices, unlocking the
+// variables files holding them if needed.
+func (r *Resolved) Reveal(indices ...int) error {
+	return r.layers.Reveal(r.Entries, r.layerOf, indices...)
+}
+
+// Resolve loads the config and variables files, without unlocking them: the
+// values of secret entries are left encrypted until revealed, so that only the
+// files holding the values used are unlocked. Selected IDs that match no entry
+// of the file they were selected in are reported on stderr.
+func Resolve(variablesPaths []string, configPath string) (*Resolved, error) {
+	// Load variables files
+	layers, err := commands.LoadLayers(variablesPaths)
+	if err != nil {
+		return nil, err
 	}
 
-	// Unlock if encrypted
-	var encryptionKey []byte
-	if file.Encrypted() {
-		encryptionKey, err = commands.Unlock(file)
-		if err != nil {
-			return "", fmt.Errorf("failed to unlock file: %w", err)
-		}
+	// Load config
+	list, layerOf := layers.Entries()
+	cfg, err := commands.LoadConfig(configPath, layers)
+	if err != nil {
+		return nil, err
+	}
 
-		// Decrypt values in memory
-		if err := file.DecryptValues(encryptionKey); err != nil {
-			return "", fmt.Errorf("failed to decrypt variables: %w", err)
+	var selected []int
+	found := set.New[string]()
+	for i, entry := range list {
+		if cfg.Selected.Has(entry.ID) {
+			selected = append(selected, i)
+			found.Add(entry.ID)
 		}
 	}
 
-	// Generate export commands for selected entries
-	var commands []string
-	for i, entry := range file.Entries {
-		entryID := config.EntryID(file.Entries, i)
-		if cfg.Selected.Has(entryID) {
-			escaped := strings.ReplaceAll(entry.Value, "'", "'\\''")
-			commands = append(
-				commands,
-				fmt.Sprintf("export %s='%s'", entry.Name, escaped),
+	ids := cfg.Selected.Members()
+	slices.Sort(ids)
+	for _, id := range ids {
+		// IDs of the files that aren't loaded are kept for them
+		if !found.Has(id) && cfg.InFiles(id, layers.Paths()) {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: selected variable %s no longer exists\n",
+				id,
 			)
 		}
 	}
 
-	return strings.Join(commands, "\n"), nil
+	return &Resolved{
+		Entries:  list,
+		Selected: selected,
+		layers:   layers,
+		layerOf:  layerOf,
+	}, nil
 }
@@ -0,0 +1,119 @@
+package restore
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+// captureStderr returns what f writes to the standard error.
+func captureStderr(t *testing.T, f func()) string {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	stderr := os.Stderr
+	os.Stderr = w
+	defer func() { os.Stderr = stderr }()
+
+	f()
+	require.NoError(t, w.Close())
+	data, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(data)
+}
+
+// setUp writes a personal and a team file, each with a variable, and a config
+// selecting both variables and the IDs in deleted, recorded in the personal
+// file. Returns the paths of the files and of the config.
+func setUp(t *testing.T, deleted ...string) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	for i, entry := range []entries.Entry{
+		{ID: "1", Name: "HOST", Value: "localhost"},
+		{ID: "2", Name: "TOKEN", Value: "it's secret"},
+	} {
+		file := &entries.File{
+			ID:      entries.NewID(),
+			Entries: []entries.Entry{entry},
+		}
+		require.NoError(t, entries.Save(paths[i], file))
+	}
+
+	cfg := &config.Config{
+		Selected: set.New("1", "2"),
+		Files:    map[string]string{"1": paths[0], "2": paths[1]},
+	}
+	for _, id := range deleted {
+		cfg.Selected.Add(id)
+		cfg.Files[id] = paths[0]
+	}
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, config.Save(configPath, cfg))
+	return paths, configPath
+}
+
+func TestRun(t *testing.T) {
+	t.Run("exports the selected variables", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		output, err := Run(paths, configPath, shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			"export HOST='localhost'\nexport TOKEN='it'\\''s secret'",
+			output,
+		)
+	})
+
+	t.Run("exports nothing without selection", func(t *testing.T) {
+		paths, _ := setUp(t)
+		configPath := filepath.Join(t.TempDir(), "config.json")
+
+		output, err := Run(paths, configPath, shell.PosixEmitter{})
+		require.NoError(t, err)
+		require.Empty(t, output)
+	})
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("ignores the selection of files not loaded", func(t *testing.T) {
+		paths, configPath := setUp(t)
+
+		var resolved *Resolved
+		stderr := captureStderr(t, func() {
+			var err error
+			resolved, err = Resolve(paths[:1], configPath)
+			require.NoError(t, err)
+		})
+		require.Empty(t, stderr)
+		require.Equal(t, []int{0}, resolved.Selected)
+	})
+
+	t.Run("reports deleted variables", func(t *testing.T) {
+		paths, configPath := setUp(t, "deleted")
+
+		stderr := captureStderr(t, func() {
+			_, err := Resolve(paths[:1], configPath)
+			require.NoError(t, err)
+		})
+		require.Equal(
+			t,
+			"apiki: selected variable deleted no longer exists\n",
+			stderr,
+		)
+	})
+}
@@ -0,0 +1,70 @@
+package rm
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+)
+
+// Options holds the flags of the rm command.
+type Options struct {
+	// Label selects a variable within a radio group by its label.
+	Label string
+
+	// All removes every variable with the given name.
+	All bool
+}
+
+// Run removes the variable identified by name, or all variables with that
+// name when opts.All is set.
+func Run(
+	variablesPaths []string,
+	configPath, name string,
+	opts Options,
+) error {
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var indices []int
+	if opts.All {
+		for i, entry := range store.Entries {
+			if entry.Name == name {
+				indices = append(indices, i)
+			}
+		}
+		if len(indices) == 0 {
+			return &commands.ExitError{
+				Code: get.ExitNotFound,
+				Err:  fmt.Errorf("%w: %q", get.ErrNotFound, name),
+			}
+		}
+	} else {
+		index, err := get.Find(store.Entries, name, opts.Label)
+		if err != nil {
+			return err
+		}
+		indices = []int{index}
+	}
+
+	// Remove from the end so earlier indices stay valid
+	for i := len(indices) - 1; i >= 0; i-- {
+		store.Remove(indices[i])
+	}
+
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	variableWord := "variable"
+	if len(indices) > 1 {
+		variableWord = "variables"
+	}
+	fmt.Fprintf(os.Stderr, "✓ Removed %d %s.\n", len(indices), variableWord)
+
+	return nil
+}
@@ -0,0 +1,127 @@
+package rm
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+// setUp writes a personal file with two variants of URL and HOST, a team file
+// with a third variant of URL, and a config selecting every entry. Returns
+// the paths of the files and of the config.
+func setUp(t *testing.T) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "2", Name: "URL", Value: "prod", Label: "prod"},
+			{ID: "3", Name: "HOST", Value: "localhost"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "4", Name: "URL", Value: "team", Label: "team"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{Selected: set.New("1", "2", "3", "4")}
+	require.NoError(t, config.Save(configPath, cfg))
+	return paths, configPath
+}
+
+// ids returns the IDs of the entries of the files at paths.
+func ids(t *testing.T, paths []string) []string {
+	t.Helper()
+
+	var ids []string
+	for _, path := range paths {
+		file, err := entries.Load(path)
+		require.NoError(t, err)
+		for _, entry := range file.Entries {
+			ids = append(ids, entry.ID)
+		}
+	}
+	return ids
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		variable string
+		opts     Options
+		want     []string
+		code     int
+	}{
+		{name: "by name", variable: "HOST", want: []string{"1", "2", "4"}},
+		{name: "by entry ID", variable: "2", want: []string{"1", "3", "4"}},
+		{
+			name:     "by label",
+			variable: "URL",
+			opts:     Options{Label: "team"},
+			want:     []string{"1", "2", "3"},
+		},
+		{
+			name:     "all variants",
+			variable: "URL",
+			opts:     Options{All: true},
+			want:     []string{"3"},
+		},
+		{
+			name:     "ambiguous",
+			variable: "URL",
+			want:     []string{"1", "2", "3", "4"},
+			code:     get.ExitAmbiguous,
+		},
+		{
+			name:     "not found",
+			variable: "MISSING",
+			want:     []string{"1", "2", "3", "4"},
+			code:     get.ExitNotFound,
+		},
+		{
+			name:     "all not found",
+			variable: "MISSING",
+			opts:     Options{All: true},
+			want:     []string{"1", "2", "3", "4"},
+			code:     get.ExitNotFound,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, configPath := setUp(t)
+
+			err := Run(paths, configPath, tt.variable, tt.opts)
+			if tt.code == 0 {
+				require.NoError(t, err)
+			} else {
+				var exitErr *commands.ExitError
+				require.ErrorAs(t, err, &exitErr)
+				require.Equal(t, tt.code, exitErr.Code)
+			}
+			require.ElementsMatch(t, tt.want, ids(t, paths))
+
+			// Removed variables are deselected
+			cfg, err := config.Load(configPath)
+			require.NoError(t, err)
+			require.ElementsMatch(t, tt.want, cfg.Selected.Members())
+		})
+	}
+}
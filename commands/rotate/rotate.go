@@ -3,8 +3,10 @@ package rotate
 import (
 	"errors"
 	"fmt"
+	"math"
 	"os"
 
+	"github.com/loderunner/apiki/commands"
 	"github.com/loderunner/apiki/internal/crypto"
 	"github.com/loderunner/apiki/internal/entries"
 	"github.com/loderunner/apiki/internal/keychain"
@@ -13,8 +15,28 @@ import (
 
 var ErrNoEntries = errors.New("no variables to re-encrypt")
 
-// Run executes the rotate command.
-func Run(path string) error {
+// Options configures the rotate command.
+type Options struct {
+	// KDFMemory overrides the memory used by the key derivation of password
+	// mode, in MiB.
+	KDFMemory uint32
+
+	// KDFIterations overrides the iterations of the key derivation of password
+	// mode.
+	KDFIterations uint32
+}
+
+// Run executes the rotate command. A new password is derived with the
+// parameters of the file, or the defaults if it wasn't password-protected,
+// overridden by opts. Values encrypted in the legacy format are upgraded. The
+// old keychain item of the file, if any, is deleted.
+func Run(path string, opts Options) error {
+	lock, err := commands.Lock(path)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
 	// Load file
 	file, err := entries.Load(path)
 	if err != nil {
@@ -30,62 +52,83 @@ func Run(path string) error {
 	}
 
 	oldMode := file.Encryption.Mode
-	var oldKey []byte
-
-	// Get old key based on current encryption mode
-	switch oldMode {
-	case "keychain":
-		fmt.Fprintf(os.Stderr, "Unlocking variables with keychain...\n")
-		oldKey, err = keychain.Retrieve()
-		if err != nil {
-			return fmt.Errorf("failed to retrieve key from keychain: %w", err)
-		}
+	oldAccount := file.Encryption.KeychainAccount
+	params, err := kdfParams(file, opts)
+	if err != nil {
+		return err
+	}
 
-	case "password":
-		// Prompt for current password until correct
-		for {
-			password, err := prompt.ReadPassword("Enter current password: ")
+	// Get old key based on current encryption mode, unless the file was
+	// decrypted on load
+	oldKey := file.Key()
+	if oldKey == nil {
+		switch oldMode {
+		case "keychain":
+			fmt.Fprintf(os.Stderr, "Unlocking variables with keychain...\n")
+			oldKey, err = keychain.Retrieve(file.Encryption.KeychainAccount)
 			if err != nil {
-				return fmt.Errorf("failed to read password: %w", err)
+				return fmt.Errorf(
+					"failed to retrieve key from keychain: %w",
+					err,
+				)
+			}
+
+		case "password":
+			// Prompt for current password until correct
+			for {
+				password, err := prompt.ReadPassword("Enter current password: ")
+				if err != nil {
+					return fmt.Errorf("failed to read password: %w", err)
+				}
+
+				oldKey, err = file.VerifyPassword(password)
+				if err != nil {
+					fmt.Fprintf(os.Stderr, "Wrong password.\n")
+					continue
+				}
+				break
 			}
 
-			oldKey, err = file.VerifyPassword(password)
+		case "recipients":
+			oldKey, err = commands.UnlockWithoutPrompt(file)
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Wrong password.\n")
-				continue
+				return fmt.Errorf("failed to unlock file: %w", err)
 			}
-			break
-		}
 
-	default:
-		return fmt.Errorf("unknown encryption mode: %q", oldMode)
+		default:
+			return fmt.Errorf("unknown encryption mode: %q", oldMode)
+		}
 	}
 
-	// Decrypt all entries with old key
-	for i := range file.Entries {
-		decrypted, err := crypto.Decrypt(oldKey, file.Entries[i].Value)
-		if err != nil {
-			return fmt.Errorf(
-				"error decrypting variable %q: %w",
-				file.Entries[i].Name,
-				err,
-			)
-		}
-		file.Entries[i].Value = decrypted
+	// Decrypt secret values with old key, they are encrypted again in the
+	// current format
+	legacy := file.HasLegacyValues()
+	if err := file.DecryptValues(oldKey); err != nil {
+		return fmt.Errorf("failed to decrypt variables: %w", err)
 	}
 
 	// Ask for new encryption mode
 	newMode, err := prompt.ReadChoice(
-		"Lock variables with [p]assword or [k]eychain? ",
+		"Lock variables with [p]assword, [k]eychain or [r]ecipients? ",
 		map[rune]string{
 			'p': "password",
 			'k': "keychain",
+			'r': "recipients",
 		},
 	)
 	if err != nil {
 		return fmt.Errorf("failed to read choice: %w", err)
 	}
 
+	kdfChanged := opts.KDFMemory > 0 || opts.KDFIterations > 0
+	if kdfChanged && newMode != "password" {
+		fmt.Fprintf(
+			os.Stderr,
+			"apiki: warning: --kdf-memory and --kdf-iterations "+
+				"only apply to password mode\n",
+		)
+	}
+
 	var newKey []byte
 
 	switch newMode {
@@ -107,10 +150,13 @@ func Run(path string) error {
 		}
 
 		// Configure new password mode and get the derived key
-		newKey, err = file.SetPasswordMode(password)
+		newKey, err = file.SetPasswordMode(password, params)
 		if err != nil {
 			return fmt.Errorf("failed to configure password mode: %w", err)
 		}
+		if kdfChanged {
+			fmt.Fprintf(os.Stderr, "✓ Derived key with %s.\n", params)
+		}
 
 	case "keychain":
 		// Generate new key
@@ -119,31 +165,43 @@ func Run(path string) error {
 			return fmt.Errorf("failed to generate key: %w", err)
 		}
 
-		// Delete old keychain entry if it exists
-		_ = keychain.Delete()
-
-		// Store new key in keychain
-		if err := keychain.Store(newKey); err != nil {
+		// Store new key in a new keychain item, the old item is deleted once
+		// the file is saved
+		account, err := commands.StoreKeychainKey(path, newKey)
+		if err != nil {
 			return fmt.Errorf("failed to store key in keychain: %w", err)
 		}
 
-		file.SetKeychainMode()
+		file.SetKeychainMode(account)
+
+	case "recipients":
+		// Keep the recipients of the file, or encrypt it for the user
+		recipients := file.RecipientKeys()
+		if oldMode != "recipients" {
+			own, err := commands.OwnRecipient()
+			if err != nil {
+				return err
+			}
+			recipients = []string{own}
+		}
+
+		// Generate new data key
+		newKey, err = crypto.GenerateKey()
+		if err != nil {
+			return fmt.Errorf("failed to generate key: %w", err)
+		}
+
+		if err := file.SetRecipientsMode(newKey, recipients); err != nil {
+			return err
+		}
 
 	default:
 		return fmt.Errorf("invalid mode: %q", newMode)
 	}
 
-	// Encrypt all entries with new key
-	for i := range file.Entries {
-		encrypted, err := crypto.Encrypt(newKey, file.Entries[i].Value)
-		if err != nil {
-			return fmt.Errorf(
-				"error encrypting variable %q: %w",
-				file.Entries[i].Name,
-				err,
-			)
-		}
-		file.Entries[i].Value = encrypted
+	// Encrypt secret values with new key
+	if err := file.EncryptValues(newKey); err != nil {
+		return fmt.Errorf("failed to encrypt variables: %w", err)
 	}
 
 	// Save file
@@ -151,11 +209,62 @@ func Run(path string) error {
 		return fmt.Errorf("failed to save file: %w", err)
 	}
 
-	fmt.Fprintf(
-		os.Stderr,
-		"✓ Re-encrypted %d variables.\n",
-		len(file.Entries),
-	)
+	// Delete old keychain item, the file doesn't use it anymore. The legacy
+	// item may still be used by other files, only `apiki keychain prune`
+	// deletes it.
+	if oldAccount != "" && oldAccount != keychain.LegacyAccount {
+		if err := commands.DeleteKeychainKey(oldAccount); err != nil {
+			fmt.Fprintf(
+				os.Stderr,
+				"apiki: warning: %v, run `apiki keychain prune` "+
+					"to delete it\n",
+				err,
+			)
+		}
+	}
+
+	count := 0
+	for _, entry := range file.Entries {
+		if entry.Secret {
+			count++
+		}
+	}
+	fmt.Fprintf(os.Stderr, "✓ Re-encrypted %d variables.\n", count)
+	if legacy {
+		fmt.Fprintf(
+			os.Stderr,
+			"✓ Upgraded encrypted values to the enc:v2 format.\n",
+		)
+	}
 
 	return nil
 }
+
+// kdfParams returns the parameters deriving the new password of file: those
+// of the file if it is password-protected, or the defaults, overridden by
+// opts.
+func kdfParams(file *entries.File, opts Options) (crypto.KDFParams, error) {
+	params := crypto.DefaultKDFParams
+	if file.Encryption.Mode == "password" {
+		var err error
+		params, err = file.Encryption.KDF.Params()
+		if err != nil {
+			return crypto.KDFParams{}, err
+		}
+	}
+
+	if opts.KDFMemory > 0 {
+		if opts.KDFMemory > math.MaxUint32/1024 {
+			return crypto.KDFParams{}, errors.New("KDF memory is too large")
+		}
+		params.Memory = opts.KDFMemory * 1024
+	}
+	if opts.KDFIterations > 0 {
+		params.Iterations = opts.KDFIterations
+	}
+
+	if err := params.Validate(); err != nil {
+		return crypto.KDFParams{}, err
+	}
+	return params, nil
+}
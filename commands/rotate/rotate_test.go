@@ -0,0 +1,121 @@
+package rotate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/keychain"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setStdin replaces the standard input with input until the end of the test.
+func setStdin(t *testing.T, input string) {
+	t.Helper()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	_, err = w.WriteString(input)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	stdin := os.Stdin
+	os.Stdin = r
+	t.Cleanup(func() {
+		os.Stdin = stdin
+		_ = r.Close()
+	})
+}
+
+// save writes a variables file with a secret at path, encrypted with key in
+// the keychain item of account.
+func save(t *testing.T, path, account string, key []byte) {
+	t.Helper()
+
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	file.SetKeychainMode(account)
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(path, file))
+}
+
+// reveal unlocks the variables file at path and returns its secret.
+func reveal(t *testing.T, path string) string {
+	t.Helper()
+
+	file, err := entries.Load(path)
+	require.NoError(t, err)
+	key, err := commands.Unlock(file)
+	require.NoError(t, err)
+	require.NoError(t, file.DecryptValues(key))
+	return file.Entries[0].Value
+}
+
+func TestRun(t *testing.T) {
+	t.Run("keeps the legacy keychain item", func(t *testing.T) {
+		dir := t.TempDir()
+		commands.KeychainIndexPath = filepath.Join(dir, "keychain.json")
+
+		// Files of older versions share the legacy item
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		require.NoError(t, keychain.Store(keychain.LegacyAccount, key))
+		t.Cleanup(func() { _ = keychain.Delete(keychain.LegacyAccount) })
+		personal := filepath.Join(dir, "personal.json")
+		work := filepath.Join(dir, "work.json")
+		save(t, personal, keychain.LegacyAccount, key)
+		save(t, work, keychain.LegacyAccount, key)
+		setStdin(t, "k")
+
+		require.NoError(t, Run(personal, Options{}))
+
+		file, err := entries.Load(personal)
+		require.NoError(t, err)
+		require.NotEqual(
+			t,
+			keychain.LegacyAccount,
+			file.Encryption.KeychainAccount,
+		)
+		require.Equal(t, "secret", reveal(t, personal))
+		require.Equal(t, "secret", reveal(t, work))
+	})
+
+	t.Run("deletes the old keychain item", func(t *testing.T) {
+		dir := t.TempDir()
+		commands.KeychainIndexPath = filepath.Join(dir, "keychain.json")
+
+		path := filepath.Join(dir, "variables.json")
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		account, err := commands.StoreKeychainKey(path, key)
+		require.NoError(t, err)
+		save(t, path, account, key)
+		setStdin(t, "k")
+
+		require.NoError(t, Run(path, Options{}))
+
+		exists, err := keychain.Exists(account)
+		require.NoError(t, err)
+		require.False(t, exists)
+		index, err := keychain.LoadIndex(commands.KeychainIndexPath)
+		require.NoError(t, err)
+		require.NotContains(t, index.Items, account)
+		require.Len(t, index.Items, 1)
+		require.Equal(t, "secret", reveal(t, path))
+	})
+}
@@ -0,0 +1,89 @@
+package set
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// Options holds the flags of the set command.
+type Options struct {
+	// Label identifies the variable within variables of the same name.
+	Label string
+}
+
+// Run creates the variable identified by name and label, or updates its
+// value if it already exists.
+func Run(
+	variablesPaths []string,
+	configPath, name, value string,
+	opts Options,
+) error {
+	name = strings.TrimSpace(name)
+	if err := entries.ValidateName(name); err != nil {
+		return err
+	}
+	if value == "" {
+		return errors.New("value cannot be empty")
+	}
+	label := strings.TrimSpace(opts.Label)
+
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	index := -1
+	for i, entry := range store.Entries {
+		if entry.Name != name || entry.Label != label {
+			continue
+		}
+		if index >= 0 {
+			return fmt.Errorf(
+				"several variables named %q have label %q",
+				name,
+				label,
+			)
+		}
+		index = i
+	}
+
+	if index >= 0 {
+		store.Entries[index].Value = value
+	} else {
+		store.Add(entries.Entry{
+			Name:  name,
+			Value: value,
+			Label: label,
+		}, false)
+	}
+
+	if err := store.Save(); err != nil {
+		return err
+	}
+
+	if index >= 0 {
+		fmt.Fprintf(os.Stderr, "✓ Updated %s.\n", name)
+	} else {
+		fmt.Fprintf(os.Stderr, "✓ Created %s.\n", name)
+	}
+
+	return nil
+}
+
+// ReadValue reads a value from r, stripping a single trailing newline.
+func ReadValue(r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", fmt.Errorf("failed to read value: %w", err)
+	}
+	value := strings.TrimSuffix(string(data), "\n")
+	value = strings.TrimSuffix(value, "\r")
+	return value, nil
+}
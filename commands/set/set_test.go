@@ -0,0 +1,178 @@
+package set
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+)
+
+// setUp writes a personal file with two variants of URL and a team file with
+// HOST, and an empty config. Returns the paths of the files and of the config.
+func setUp(t *testing.T) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "2", Name: "URL", Value: "prod", Label: "prod"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	file = &entries.File{
+		ID:      entries.NewID(),
+		Entries: []entries.Entry{{ID: "3", Name: "HOST", Value: "localhost"}},
+	}
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	require.NoError(t, config.Save(configPath, &config.Config{}))
+	return paths, configPath
+}
+
+// values returns the variables of the file at path, as "NAME/label=value".
+func values(t *testing.T, path string) []string {
+	t.Helper()
+
+	file, err := entries.Load(path)
+	require.NoError(t, err)
+	var values []string
+	for _, entry := range file.Entries {
+		values = append(
+			values,
+			entry.Name+"/"+entry.Label+"="+entry.Value,
+		)
+	}
+	return values
+}
+
+func TestRun(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		variable string
+		value    string
+		opts     Options
+		personal []string
+		team     []string
+	}{
+		{
+			name:     "creates in the default file",
+			variable: "TOKEN",
+			value:    "secret",
+			personal: []string{"TOKEN/=secret", "URL/dev=dev", "URL/prod=prod"},
+			team:     []string{"HOST/=localhost"},
+		},
+		{
+			name:     "updates in the file of the variable",
+			variable: "HOST",
+			value:    "example.com",
+			personal: []string{"URL/dev=dev", "URL/prod=prod"},
+			team:     []string{"HOST/=example.com"},
+		},
+		{
+			name:     "updates the variant with the label",
+			variable: "URL",
+			value:    "https://example.com",
+			opts:     Options{Label: " prod "},
+			personal: []string{"URL/dev=dev", "URL/prod=https://example.com"},
+			team:     []string{"HOST/=localhost"},
+		},
+		{
+			name:     "creates a variant with another label",
+			variable: "URL",
+			value:    "staging",
+			opts:     Options{Label: "staging"},
+			personal: []string{
+				"URL/dev=dev",
+				"URL/prod=prod",
+				"URL/staging=staging",
+			},
+			team: []string{"HOST/=localhost"},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, configPath := setUp(t)
+
+			err := Run(paths, configPath, tt.variable, tt.value, tt.opts)
+			require.NoError(t, err)
+			require.ElementsMatch(t, tt.personal, values(t, paths[0]))
+			require.ElementsMatch(t, tt.team, values(t, paths[1]))
+		})
+	}
+
+	t.Run("refuses invalid input", func(t *testing.T) {
+		for _, tt := range []struct {
+			name     string
+			variable string
+			value    string
+			err      string
+		}{
+			{name: "empty value", variable: "HOST", err: "cannot be empty"},
+			{name: "invalid name", variable: "1HOST", value: "v"},
+		} {
+			t.Run(tt.name, func(t *testing.T) {
+				paths, configPath := setUp(t)
+
+				err := Run(paths, configPath, tt.variable, tt.value, Options{})
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.err)
+				require.Equal(
+					t,
+					[]string{"HOST/=localhost"},
+					values(t, paths[1]),
+				)
+			})
+		}
+	})
+
+	t.Run(
+		"refuses a name and label shared by several files",
+		func(t *testing.T) {
+			paths, configPath := setUp(t)
+			require.NoError(
+				t,
+				Run(paths[1:], configPath, "URL", "team", Options{
+					Label: "dev",
+				}),
+			)
+
+			err := Run(paths, configPath, "URL", "new", Options{Label: "dev"})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), `several variables named "URL"`)
+			for _, path := range paths {
+				require.NotContains(
+					t,
+					strings.Join(values(t, path), ","),
+					"new",
+				)
+			}
+		},
+	)
+}
+
+func TestReadValue(t *testing.T) {
+	for _, tt := range []struct {
+		input string
+		want  string
+	}{
+		{input: "value\n", want: "value"},
+		{input: "value\r\n", want: "value"},
+		{input: "value\n\n", want: "value\n"},
+		{input: "line1\nline2", want: "line1\nline2"},
+	} {
+		value, err := ReadValue(strings.NewReader(tt.input))
+		require.NoError(t, err)
+		require.Equal(t, tt.want, value)
+	}
+}
@@ -0,0 +1,108 @@
+package shellinit
+
+import (
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+//go:embed templates/*.tmpl
+var templates embed.FS
+
+// EvalCommands lists the subcommands whose output is evaluated by the shell
+// wrapper, as one or two words. Running apiki without a subcommand is always
+// evaluated.
+var EvalCommands = []string{"restore", "use", "profile apply"}
+
+// ErrCompletionUnsupported is returned when completion is requested for a
+// shell that has no completion script.
+var ErrCompletionUnsupported = errors.New("completion is not supported")
+
+// Options holds the flags of the shell-init command.
+type Options struct {
+	// ValueFlags lists the global flags that take a value, e.g. "-f" and
+	// "--variables-file". The wrapper skips them and their value to find the
+	// subcommand.
+	ValueFlags []string
+
+	// Completion writes the completion script for the given shell to w. If
+	// nil, completion is not registered.
+	Completion func(w io.Writer, shellName string) error
+}
+
+// data is passed to the init templates.
+type data struct {
+	Shell        string
+	Bin          string
+	EvalCommands []string
+	ValueFlags   []string
+}
+
+// Run returns the shell integration script for shellName. The script calls
+// the apiki binary at bin.
+func Run(shellName, bin string, opts Options) (string, error) {
+	name, tmplName, err := normalize(shellName)
+	if err != nil {
+		return "", err
+	}
+
+	emitter, err := shell.New(name)
+	if err != nil {
+		return "", err
+	}
+
+	tmpl, err := template.New(tmplName).
+		Funcs(template.FuncMap{
+			"quote": emitter.Quote,
+		}).
+		ParseFS(templates, "templates/"+tmplName)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var b strings.Builder
+	err = tmpl.Execute(&b, data{
+		Shell:        name,
+		Bin:          bin,
+		EvalCommands: EvalCommands,
+		ValueFlags:   opts.ValueFlags,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to render template: %w", err)
+	}
+
+	if opts.Completion != nil {
+		if name == shell.Nushell {
+			return "", fmt.Errorf("%w: %s", ErrCompletionUnsupported, name)
+		}
+		b.WriteString("\n")
+		if err := opts.Completion(&b, name); err != nil {
+			return "", fmt.Errorf("failed to generate completion: %w", err)
+		}
+	}
+
+	return strings.TrimSuffix(b.String(), "\n"), nil
+}
+
+// normalize maps a shell name or alias to its canonical name and template.
+// Bash and zsh share a template but have distinct completion scripts.
+func normalize(shellName string) (string, string, error) {
+	switch strings.ToLower(shellName) {
+	case "bash":
+		return "bash", "posix.tmpl", nil
+	case "zsh":
+		return "zsh", "posix.tmpl", nil
+	case shell.Fish:
+		return shell.Fish, "fish.tmpl", nil
+	case shell.Nushell, "nushell":
+		return shell.Nushell, "nu.tmpl", nil
+	case shell.Pwsh, "powershell":
+		return shell.Pwsh, "pwsh.tmpl", nil
+	}
+	return "", "", fmt.Errorf("unsupported shell: %q", shellName)
+}
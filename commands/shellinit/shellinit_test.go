@@ -0,0 +1,140 @@
+package shellinit
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+var valueFlags = []string{"--identity", "--shell", "--variables-file", "-f"}
+
+func TestRun(t *testing.T) {
+	t.Run("renders every shell", func(t *testing.T) {
+		for _, name := range []string{"bash", "zsh", "fish", "nu", "pwsh"} {
+			script, err := Run(
+				name,
+				"/usr/bin/apiki",
+				Options{ValueFlags: valueFlags},
+			)
+			require.NoError(t, err, name)
+			require.Contains(t, script, "--variables-file", name)
+		}
+	})
+
+	t.Run("returns error for unsupported shell", func(t *testing.T) {
+		_, err := Run("csh", "/usr/bin/apiki", Options{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported shell")
+	})
+}
+
+func TestWrapper(t *testing.T) {
+	bash, err := exec.LookPath("bash")
+	if err != nil {
+		t.Skip("bash is not installed")
+	}
+
+	// The fake binary prints a command creating a marker file, so that
+	// evaluated output can be detected
+	dir := t.TempDir()
+	marker := filepath.Join(dir, "evaluated")
+	bin := filepath.Join(dir, "apiki")
+	err = os.WriteFile(
+		bin,
+		[]byte("#!/bin/sh\necho \"touch '"+marker+"'\"\n"),
+		0o700,
+	)
+	require.NoError(t, err)
+
+	script, err := Run("bash", bin, Options{ValueFlags: valueFlags})
+	require.NoError(t, err)
+
+	// run calls the wrapper with args, and reports whether its output was
+	// evaluated
+	run := func(t *testing.T, args string) (string, bool) {
+		t.Helper()
+		_ = os.Remove(marker)
+
+		cmd := exec.Command(bash, "-c", script+"\napiki "+args)
+		output, err := cmd.Output()
+		require.NoError(t, err)
+
+		_, err = os.Stat(marker)
+		return string(output), err == nil
+	}
+
+	for _, args := range []string{
+		"get NAME",
+		"-f x get NAME",
+		"--variables-file x get NAME",
+		"--shell fish list --show-values",
+		"--strict -f x --identity y export",
+		"-f x profile list",
+	} {
+		t.Run("prints output of "+args, func(t *testing.T) {
+			output, evaluated := run(t, args)
+			require.False(t, evaluated)
+			require.True(t, strings.HasPrefix(output, "touch "))
+		})
+	}
+
+	for _, args := range []string{
+		"",
+		"-f x",
+		"--strict",
+		"-f x use NAME",
+		"--shell posix restore",
+		"-f x profile apply work",
+	} {
+		t.Run("evaluates output of "+args, func(t *testing.T) {
+			output, evaluated := run(t, args)
+			require.True(t, evaluated)
+			require.Empty(t, output)
+		})
+	}
+}
+
+func TestScripts(t *testing.T) {
+	t.Run("delegate to shell-init", func(t *testing.T) {
+		// The wrapper must only be generated by shell-init, so that the
+		// subcommands it evaluates are decided in a single place
+		for _, name := range []string{
+			"init.bash",
+			"init.zsh",
+			"init.fish",
+			"init.ps1",
+		} {
+			data, err := os.ReadFile(filepath.Join("..", "..", "scripts", name))
+			require.NoError(t, err)
+
+			script := string(data)
+			require.Contains(t, script, "shell-init", name)
+			require.NotContains(t, script, "apiki()", name)
+			require.NotContains(t, script, "function apiki", name)
+		}
+	})
+
+	t.Run("static nushell wrapper matches shell-init", func(t *testing.T) {
+		data, err := os.ReadFile(
+			filepath.Join("..", "..", "scripts", "init.nu"),
+		)
+		require.NoError(t, err)
+
+		generated, err := Run("nu", "apiki", Options{ValueFlags: []string{
+			"-f",
+			"--variables-file",
+			"--shell",
+			"--identity",
+		}})
+		require.NoError(t, err)
+		generated = strings.ReplaceAll(generated, `^"apiki"`, "^(__apiki_bin)")
+
+		i := strings.Index(generated, "def --env --wrapped apiki")
+		require.GreaterOrEqual(t, i, 0)
+		require.Contains(t, string(data), generated[i:])
+	})
+}
@@ -0,0 +1,171 @@
+package commands
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/filelock"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+// Store is a stack of variables files and their config, loaded for
+// non-interactive modification. Values are decrypted in memory and
+// re-encrypted on save. The files are locked against other apiki processes
+// until the store is closed.
+type Store struct {
+	// Entries holds the entries of all layers, decrypted in memory.
+	Entries []entries.Entry
+
+	// Layers holds the index of the layer of each entry, parallel to Entries.
+	Layers []int
+
+	// Selected holds the selection state of each entry, parallel to Entries.
+	Selected []bool
+
+	// Config holds the config file.
+	Config *config.Config
+
+	files      Layers
+	configPath string
+
+	// loadedIDs holds the IDs of the entries as loaded, whose selection is
+	// replaced on save
+	loadedIDs set.Set[string]
+	lock      *filelock.Lock
+}
+
+// LoadStore locks and loads the variables files and the config file. Secret
+// values are left encrypted until revealed. The caller must Close the store.
+func LoadStore(
+	variablesPaths []string,
+	configPath string,
+) (store *Store, err error) {
+	lock, err := Lock(append(slices.Clone(variablesPaths), configPath)...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		if err != nil {
+			lock.Release()
+		}
+	}()
+
+	files, err := loadLayers(variablesPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	list, layers := files.Entries()
+	cfg, err := loadConfig(configPath, files)
+	if err != nil {
+		return nil, err
+	}
+
+	selected := make([]bool, len(list))
+	loadedIDs := set.New[string]()
+	for i, entry := range list {
+		selected[i] = cfg.Selected.Has(entry.ID)
+		loadedIDs.Add(entry.ID)
+	}
+
+	return &Store{
+		Entries:    list,
+		Layers:     layers,
+		Selected:   selected,
+		Config:     cfg,
+		files:      files,
+		configPath: configPath,
+		loadedIDs:  loadedIDs,
+		lock:       lock,
+	}, nil
+}
+
+// Close releases the lock of the files.
+func (s *Store) Close() {
+	s.lock.Release()
+}
+
+// Add appends an entry to the default layer with the given selection state.
+// The entry is given an ID if it has none, and is secret if the default layer
+// is encrypted.
+func (s *Store) Add(entry entries.Entry, selected bool) {
+	if entry.ID == "" {
+		entry.ID = entries.NewID()
+	}
+	entry.Secret = s.files[0].File.Encrypted()
+	s.Entries = append(s.Entries, entry)
+	s.Layers = append(s.Layers, 0)
+	s.Selected = append(s.Selected, selected)
+}
+
+// Reveal decrypts the values of the entries at indices, unlocking the
+// variables files holding them if needed.
+func (s *Store) Reveal(indices ...int) error {
+	return s.files.Reveal(s.Entries, s.Layers, indices...)
+}
+
+// Remove deletes the entry at index.
+func (s *Store) Remove(index int) {
+	s.Entries = slices.Delete(s.Entries, index, index+1)
+	s.Layers = slices.Delete(s.Layers, index, index+1)
+	s.Selected = slices.Delete(s.Selected, index, index+1)
+}
+
+// Save sorts the entries, then writes each changed variables file,
+// re-encrypting values if encryption is enabled, and the config file.
+func (s *Store) Save() error {
+	s.sort()
+
+	// New or changed secret values need the key of their layer
+	for i, entry := range s.Entries {
+		if entry.Secret && !entry.Encrypted() {
+			if err := s.files.Unlock(s.Layers[i]); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := s.files.Save(s.Entries, s.Layers); err != nil {
+		return err
+	}
+
+	return s.SaveSelection()
+}
+
+// SaveSelection writes the selection state to the config file. The selection
+// of entries of variables files that weren't loaded is kept.
+func (s *Store) SaveSelection() error {
+	selected := make(map[string]string)
+	for i, entry := range s.Entries {
+		if s.Selected[i] {
+			selected[entry.ID] = s.files[s.Layers[i]].Path
+		}
+	}
+	s.Config.SelectFiles(s.files.Paths(), s.loadedIDs, selected)
+
+	if err := config.Save(s.configPath, s.Config); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return nil
+}
+
+// sort orders entries the same way as the interface, keeping the layers and
+// the selection state in step.
+func (s *Store) sort() {
+	order := sortOrder(s.Entries, s.Layers)
+
+	sorted := make([]entries.Entry, len(order))
+	layers := make([]int, len(order))
+	selected := make([]bool, len(order))
+	for i, j := range order {
+		sorted[i] = s.Entries[j]
+		layers[i] = s.Layers[j]
+		selected[i] = s.Selected[j]
+	}
+	s.Entries = sorted
+	s.Layers = layers
+	s.Selected = selected
+}
@@ -0,0 +1,42 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+)
+
+func TestSaveSelection(t *testing.T) {
+	t.Run("keeps the selection of other files", func(t *testing.T) {
+		dir := t.TempDir()
+		path := filepath.Join(dir, "variables.json")
+		file := &entries.File{
+			ID: entries.NewID(),
+			Entries: []entries.Entry{
+				{ID: "1", Name: "VAR1", Value: "v"},
+				{ID: "2", Name: "VAR2", Value: "v"},
+			},
+		}
+		require.NoError(t, entries.Save(path, file))
+		configPath := filepath.Join(dir, "config.json")
+		cfg := &config.Config{Selected: set.New("other", "1", "2")}
+		require.NoError(t, config.Save(configPath, cfg))
+
+		store, err := LoadStore([]string{path}, configPath)
+		require.NoError(t, err)
+		defer store.Close()
+		// Removed entries are deselected
+		store.Selected[0] = false
+		store.Remove(1)
+		require.NoError(t, store.Save())
+
+		cfg, err = config.Load(configPath)
+		require.NoError(t, err)
+		require.Equal(t, set.New("other"), cfg.Selected)
+	})
+}
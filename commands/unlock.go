@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -9,50 +10,92 @@ import (
 	"github.com/loderunner/apiki/internal/prompt"
 )
 
+// ErrPasswordRequired is returned by UnlockWithoutPrompt when the password of
+// the file must be typed by the user.
+var ErrPasswordRequired = errors.New("password required")
+
 // Unlock prompts for password or retrieves key from keychain to unlock
 // an encrypted file. Returns the encryption key.
 func Unlock(file *entries.File) ([]byte, error) {
-	if !file.Encrypted() {
-		return nil, fmt.Errorf("file is not encrypted")
+	if key := file.Key(); key != nil {
+		return key, nil
+	}
+	if file.Encryption.Mode == "keychain" {
+		fmt.Fprintf(os.Stderr, "Unlocking variables with keychain...\n")
+	}
+	key, err := UnlockWithoutPrompt(file)
+	if !errors.Is(err, ErrPasswordRequired) || NonInteractive {
+		return key, err
 	}
 
-	if file.Encryption.Mode == "password" {
-		// Check for APIKI_PASSWORD environment variable
-		if password := os.Getenv("APIKI_PASSWORD"); password != "" {
-			key, err := file.VerifyPassword(password)
-			if err != nil {
-				return nil, fmt.Errorf(
-					"invalid password from APIKI_PASSWORD: %w",
-					err,
-				)
-			}
-			return key, nil
+	// Prompt for password
+	firstAttempt := true
+	for {
+		password, err := prompt.ReadPassword("Enter password: ")
+		if err != nil {
+			return nil, fmt.Errorf("failed to read password: %w", err)
 		}
 
-		// Prompt for password
-		firstAttempt := true
-		for {
-			password, err := prompt.ReadPassword("Enter password: ")
-			if err != nil {
-				return nil, fmt.Errorf("failed to read password: %w", err)
+		key, err := VerifyPassword(file, password)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Wrong password.\n")
+			if firstAttempt {
+				firstAttempt = false
+				continue
 			}
 
-			key, err := file.VerifyPassword(password)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "Wrong password.\n")
-				if firstAttempt {
-					firstAttempt = false
-					continue
-				}
+			return nil, fmt.Errorf("too many wrong password attempts")
+		}
+		return key, nil
+	}
+}
 
-				return nil, fmt.Errorf("too many wrong password attempts")
-			}
+// UnlockWithoutPrompt retrieves the key of an encrypted file from the
+// keychain, unwraps it with the identity of the user, or gets it from the
+// agent or derives it from the APIKI_PASSWORD environment variable. The key of
+// a file that was decrypted on load is reused.
+// Returns ErrPasswordRequired if the password must be typed instead.
+func UnlockWithoutPrompt(file *entries.File) ([]byte, error) {
+	if !file.Encrypted() {
+		return nil, fmt.Errorf("file is not encrypted")
+	}
+	if key := file.Key(); key != nil {
+		return key, nil
+	}
+
+	switch file.Encryption.Mode {
+	case "password":
+		// Try the agent first, it holds the key if the file was unlocked
+		// recently
+		if key, err := agentKey(file); err == nil {
 			return key, nil
 		}
-	} else if file.Encryption.Mode == "keychain" {
+
+		// Check for APIKI_PASSWORD environment variable
+		password := os.Getenv("APIKI_PASSWORD")
+		if password == "" {
+			return nil, ErrPasswordRequired
+		}
+		key, err := VerifyPassword(file, password)
+		if err != nil {
+			return nil, fmt.Errorf(
+				"invalid password from APIKI_PASSWORD: %w",
+				err,
+			)
+		}
+		return key, nil
+
+	case "recipients":
+		// Unwrap the data key with the identity of the user
+		identity, err := ReadIdentity()
+		if err != nil {
+			return nil, err
+		}
+		return file.UnwrapKey(identity)
+
+	case "keychain":
 		// Retrieve from keychain (may trigger Touch ID on macOS)
-		fmt.Fprintf(os.Stderr, "Unlocking variables with keychain...\n")
-		key, err := keychain.Retrieve()
+		key, err := keychain.Retrieve(file.Encryption.KeychainAccount)
 		if err != nil {
 			return nil, fmt.Errorf(
 				"failed to retrieve key from keychain: %w",
@@ -64,3 +107,10 @@ func Unlock(file *entries.File) ([]byte, error) {
 
 	return nil, fmt.Errorf("unknown encryption mode: %q", file.Encryption.Mode)
 }
+
+// UnlockOnLoad unlocks a file encrypted with FullFile while it is loaded from
+// path, see entries.Unlocker.
+func UnlockOnLoad(path string, file *entries.File) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "Unlocking %s...\n", path)
+	return Unlock(file)
+}
@@ -0,0 +1,110 @@
+package use
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/apiki"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+// Options holds the flags of the use command.
+type Options struct {
+	// Off lists the names of variables to deselect.
+	Off []string
+}
+
+// Run selects the variables given as "NAME", "NAME=label" or "name[index]"
+// arguments and deselects the variables named in opts.Off, applying the same
+// radio-group rules as the interface. The selected values are unlocked, then
+// the selection is saved, and the returned shell commands, in the syntax of the
+// given emitter, export or unset
+// the affected variables.
+func Run(
+	variablesPaths []string,
+	configPath string,
+	args []string,
+	opts Options,
+	sh shell.Emitter,
+) (string, error) {
+	if len(args) == 0 && len(opts.Off) == 0 {
+		return "", errors.New("no variables to select or deselect")
+	}
+
+	store, err := commands.LoadStore(variablesPaths, configPath)
+	if err != nil {
+		return "", err
+	}
+	defer store.Close()
+
+	var touched []string
+
+	for _, name := range opts.Off {
+		found := false
+		for i, entry := range store.Entries {
+			if entry.Name == name {
+				store.Selected[i] = false
+				found = true
+			}
+		}
+		if !found {
+			return "", &commands.ExitError{
+				Code: get.ExitNotFound,
+				Err:  fmt.Errorf("%w: %q", get.ErrNotFound, name),
+			}
+		}
+		touched = append(touched, name)
+	}
+
+	for _, arg := range args {
+		name, label, _ := strings.Cut(arg, "=")
+		index, err := get.Find(store.Entries, name, label)
+		if err != nil {
+			return "", err
+		}
+
+		// Radio-button behavior: deselect others with the same name
+		selectedName := store.Entries[index].Name
+		for i, entry := range store.Entries {
+			if entry.Name == selectedName {
+				store.Selected[i] = i == index
+			}
+		}
+		touched = append(touched, selectedName)
+	}
+
+	// Only emit commands for the variables named on the command line, and
+	// only unlock the selected ones
+	var indices, selected []int
+	for i, entry := range store.Entries {
+		if slices.Contains(touched, entry.Name) {
+			indices = append(indices, i)
+			if store.Selected[i] {
+				selected = append(selected, i)
+			}
+		}
+	}
+
+	// Save the selection once its values are known, so that it matches the
+	// exported variables
+	if err := store.Reveal(selected...); err != nil {
+		return "", err
+	}
+	if err := store.SaveSelection(); err != nil {
+		return "", err
+	}
+	affected := make([]apiki.Entry, 0, len(indices))
+	for _, i := range indices {
+		affected = append(affected, apiki.Entry{
+			Entry:    store.Entries[i],
+			Selected: store.Selected[i],
+		})
+	}
+
+	env := apiki.CaptureEnvironment(affected)
+	return apiki.GenerateShellCommands(affected, env, sh), nil
+}
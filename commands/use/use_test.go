@@ -0,0 +1,164 @@
+package use
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/internal/config"
+	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/set"
+	"github.com/loderunner/apiki/internal/shell"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory keychain for testing
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+// setUp writes a plaintext file with two variants of URL, a keychain file
+// whose key is missing from the keychain, so that it can't be unlocked, and a
+// config selecting the entries listed in selected. Returns the paths of the
+// files and of the config.
+func setUp(t *testing.T, selected ...string) ([]string, string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	paths := []string{
+		filepath.Join(dir, "personal.json"),
+		filepath.Join(dir, "team.json"),
+	}
+	file := &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "1", Name: "URL", Value: "dev", Label: "dev"},
+			{ID: "2", Name: "URL", Value: "it's prod", Label: "prod"},
+		},
+	}
+	require.NoError(t, entries.Save(paths[0], file))
+
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	file = &entries.File{
+		ID: entries.NewID(),
+		Entries: []entries.Entry{
+			{ID: "3", Name: "TOKEN", Value: "secret", Secret: true},
+		},
+	}
+	file.SetKeychainMode("encryption-key-missing")
+	require.NoError(t, file.EncryptValues(key))
+	require.NoError(t, entries.Save(paths[1], file))
+
+	configPath := filepath.Join(dir, "config.json")
+	cfg := &config.Config{Selected: set.New(selected...)}
+	require.NoError(t, config.Save(configPath, cfg))
+
+	for _, name := range []string{"URL", "TOKEN"} {
+		t.Setenv(name, "")
+	}
+	return paths, configPath
+}
+
+// selection returns the IDs selected in the config at path.
+func selection(t *testing.T, path string) []string {
+	t.Helper()
+
+	cfg, err := config.Load(path)
+	require.NoError(t, err)
+	return cfg.Selected.Members()
+}
+
+func TestRun(t *testing.T) {
+	t.Run("exports the selected variant in each shell", func(t *testing.T) {
+		for _, tt := range []struct {
+			sh     shell.Emitter
+			output string
+		}{
+			{shell.PosixEmitter{}, `export URL='it'\''s prod'`},
+			{shell.FishEmitter{}, `set -gx URL 'it\'s prod'`},
+			{shell.NushellEmitter{}, `$env.URL = "it's prod"`},
+			{shell.PwshEmitter{}, `$env:URL = 'it''s prod'`},
+		} {
+			paths, configPath := setUp(t, "1")
+
+			output, err := Run(
+				paths,
+				configPath,
+				[]string{"URL=prod"},
+				Options{},
+				tt.sh,
+			)
+			require.NoError(t, err)
+			require.Equal(t, tt.output, output)
+			require.Equal(t, []string{"2"}, selection(t, configPath))
+		}
+	})
+
+	t.Run("unsets deselected variables", func(t *testing.T) {
+		paths, configPath := setUp(t, "1")
+		t.Setenv("URL", "dev")
+
+		output, err := Run(
+			paths,
+			configPath,
+			nil,
+			Options{Off: []string{"URL"}},
+			shell.PosixEmitter{},
+		)
+		require.NoError(t, err)
+		require.Equal(t, "unset URL", output)
+		require.Empty(t, selection(t, configPath))
+	})
+
+	t.Run("keeps the selection if unlocking fails", func(t *testing.T) {
+		paths, configPath := setUp(t, "1")
+
+		_, err := Run(
+			paths,
+			configPath,
+			[]string{"TOKEN"},
+			Options{},
+			shell.PosixEmitter{},
+		)
+		require.Error(t, err)
+		require.Equal(t, []string{"1"}, selection(t, configPath))
+	})
+
+	t.Run("rejects ambiguous and unknown names", func(t *testing.T) {
+		for _, tt := range []struct {
+			args []string
+			opts Options
+			code int
+		}{
+			{[]string{"URL"}, Options{}, get.ExitAmbiguous},
+			{[]string{"MISSING"}, Options{}, get.ExitNotFound},
+			{nil, Options{Off: []string{"MISSING"}}, get.ExitNotFound},
+		} {
+			paths, configPath := setUp(t, "1")
+
+			_, err := Run(
+				paths,
+				configPath,
+				tt.args,
+				tt.opts,
+				shell.PosixEmitter{},
+			)
+			var exitErr *commands.ExitError
+			require.ErrorAs(t, err, &exitErr)
+			require.Equal(t, tt.code, exitErr.Code)
+			require.Equal(t, []string{"1"}, selection(t, configPath))
+		}
+	})
+
+	t.Run("requires variables", func(t *testing.T) {
+		_, err := Run(nil, "", nil, Options{}, shell.PosixEmitter{})
+		require.Error(t, err)
+	})
+}
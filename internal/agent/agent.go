@@ -0,0 +1,261 @@
+package agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Operations of the agent protocol.
+const (
+	opPing = "ping"
+	opGet  = "get"
+	opPut  = "put"
+	opLock = "lock"
+)
+
+// ioTimeout bounds the time a client or the agent waits for the other side.
+const ioTimeout = 5 * time.Second
+
+// ErrNotRunning is returned by clients when no agent listens on the socket.
+var ErrNotRunning = errors.New("agent is not running")
+
+// ErrUnavailable is returned on platforms where the agent can't run, see
+// Listen.
+var ErrUnavailable = errors.New("agent is not available on this platform")
+
+// ErrNotFound is returned by Get when the agent holds no key for the ID.
+var ErrNotFound = errors.New("key not found")
+
+// ErrClosed is returned by Put when the agent is shutting down.
+var ErrClosed = errors.New("agent is shutting down")
+
+// request is sent by a client, one per connection.
+type request struct {
+	Op  string `json:"op"`
+	ID  string `json:"id,omitempty"`
+	Key []byte `json:"key,omitempty"`
+}
+
+// response answers a request.
+type response struct {
+	Key   []byte `json:"key,omitempty"`
+	Count int    `json:"count,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// Agent holds keys in memory, each forgotten after it wasn't used for the
+// idle timeout.
+type Agent struct {
+	timeout time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*entry
+
+	// closed is true once Serve returned: keys are no longer held nor served
+	closed bool
+}
+
+// entry is a key held by the agent.
+type entry struct {
+	key   []byte
+	timer *time.Timer
+}
+
+// New returns an agent forgetting keys after timeout without use.
+func New(timeout time.Duration) *Agent {
+	return &Agent{
+		timeout: timeout,
+		keys:    make(map[string]*entry),
+	}
+}
+
+// Serve answers the clients connecting to listener until it is closed. Keys
+// are forgotten when Serve returns, and requests still being answered are
+// refused.
+func (a *Agent) Serve(listener net.Listener) error {
+	defer a.close()
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		go a.handle(conn)
+	}
+}
+
+// handle answers the request of a single connection.
+func (a *Agent) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	var req request
+	if err := json.NewDecoder(conn).Decode(&req); err != nil {
+		return
+	}
+
+	var resp response
+	switch req.Op {
+	case opPing:
+	case opGet:
+		key, ok := a.Get(req.ID)
+		if ok {
+			resp.Key = key
+		} else {
+			resp.Error = ErrNotFound.Error()
+		}
+	case opPut:
+		if !a.Put(req.ID, req.Key) {
+			resp.Error = ErrClosed.Error()
+		}
+	case opLock:
+		resp.Count = a.Lock()
+	default:
+		resp.Error = fmt.Sprintf("unknown operation: %q", req.Op)
+	}
+
+	_ = json.NewEncoder(conn).Encode(&resp)
+}
+
+// Get returns the key held for id, and restarts its idle timeout. A key whose
+// timeout expired is not returned, even if it wasn't forgotten yet.
+func (a *Agent) Get(id string) ([]byte, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	e, ok := a.keys[id]
+	if !ok || a.closed {
+		return nil, false
+	}
+	if !e.timer.Reset(a.timeout) {
+		// The timeout fired, its function waits for the mutex
+		a.forget(id, e)
+		return nil, false
+	}
+	return slices.Clone(e.key), true
+}
+
+// Put holds key for id, replacing the key held for it if any. Returns false,
+// after erasing key, if the agent is closed.
+func (a *Agent) Put(id string, key []byte) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.closed {
+		clear(key)
+		return false
+	}
+	if e, ok := a.keys[id]; ok {
+		a.forget(id, e)
+	}
+	e := &entry{key: key}
+	e.timer = time.AfterFunc(a.timeout, func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if a.keys[id] == e {
+			a.forget(id, e)
+		}
+	})
+	a.keys[id] = e
+	return true
+}
+
+// Lock forgets every key. Returns the number of keys forgotten.
+func (a *Agent) Lock() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	count := len(a.keys)
+	for id, e := range a.keys {
+		a.forget(id, e)
+	}
+	return count
+}
+
+// close forgets every key, and refuses the keys put afterwards.
+func (a *Agent) close() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	for id, e := range a.keys {
+		a.forget(id, e)
+	}
+}
+
+// forget erases the key of e from memory and removes it. The caller holds
+// the mutex.
+func (a *Agent) forget(id string, e *entry) {
+	e.timer.Stop()
+	clear(e.key)
+	delete(a.keys, id)
+}
+
+// Ping returns nil if an agent answers on the socket at path.
+func Ping(path string) error {
+	_, err := call(path, request{Op: opPing})
+	return err
+}
+
+// Get returns the key held for id by the agent listening on the socket at
+// path. Returns ErrNotFound if it holds none.
+func Get(path string, id string) ([]byte, error) {
+	resp, err := call(path, request{Op: opGet, ID: id})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Key, nil
+}
+
+// Put gives key for id to the agent listening on the socket at path.
+func Put(path string, id string, key []byte) error {
+	_, err := call(path, request{Op: opPut, ID: id, Key: key})
+	return err
+}
+
+// Lock makes the agent listening on the socket at path forget every key.
+// Returns the number of keys forgotten.
+func Lock(path string) (int, error) {
+	resp, err := call(path, request{Op: opLock})
+	if err != nil {
+		return 0, err
+	}
+	return resp.Count, nil
+}
+
+// call sends req to the agent listening on the socket at path, and returns its
+// response.
+func call(path string, req request) (*response, error) {
+	conn, err := dial(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrNotRunning, err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(ioTimeout))
+
+	if err := json.NewEncoder(conn).Encode(&req); err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+
+	var resp response
+	if err := json.NewDecoder(conn).Decode(&resp); err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	switch resp.Error {
+	case "":
+		return &resp, nil
+	case ErrNotFound.Error():
+		return nil, ErrNotFound
+	case ErrClosed.Error():
+		return nil, ErrClosed
+	}
+	return nil, errors.New(resp.Error)
+}
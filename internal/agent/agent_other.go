@@ -0,0 +1,16 @@
+//go:build !unix
+
+package agent
+
+import "net"
+
+// Listen returns ErrUnavailable: the socket of the agent can't be restricted
+// to the current user on this platform.
+func Listen(path string) (net.Listener, error) {
+	return nil, ErrUnavailable
+}
+
+// dial returns ErrUnavailable, no agent runs on this platform.
+func dial(path string) (net.Conn, error) {
+	return nil, ErrUnavailable
+}
@@ -0,0 +1,153 @@
+package agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// start runs an agent with timeout on a socket in a temporary directory, and
+// returns the path of the socket.
+func start(t *testing.T, timeout time.Duration) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := Listen(path)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() { done <- New(timeout).Serve(listener) }()
+	t.Cleanup(func() {
+		_ = listener.Close()
+		require.NoError(t, <-done)
+	})
+	return path
+}
+
+func TestListen(t *testing.T) {
+	t.Run("restricts socket to its owner", func(t *testing.T) {
+		path := start(t, time.Minute)
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("refuses a running agent", func(t *testing.T) {
+		path := start(t, time.Minute)
+
+		_, err := Listen(path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "already running")
+	})
+
+	t.Run("replaces a stale socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.sock")
+		err := os.WriteFile(path, nil, 0o600)
+		require.NoError(t, err)
+
+		listener, err := Listen(path)
+		require.NoError(t, err)
+		require.NoError(t, listener.Close())
+	})
+}
+
+func TestClient(t *testing.T) {
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	t.Run("returns key put", func(t *testing.T) {
+		path := start(t, time.Minute)
+
+		err := Put(path, "id", key)
+		require.NoError(t, err)
+
+		got, err := Get(path, "id")
+		require.NoError(t, err)
+		require.Equal(t, key, got)
+	})
+
+	t.Run("returns ErrNotFound for unknown ID", func(t *testing.T) {
+		path := start(t, time.Minute)
+
+		_, err := Get(path, "unknown")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("forgets keys after idle timeout", func(t *testing.T) {
+		path := start(t, 50*time.Millisecond)
+
+		err := Put(path, "id", key)
+		require.NoError(t, err)
+
+		// Getting the key would restart its timeout
+		time.Sleep(200 * time.Millisecond)
+		_, err = Get(path, "id")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("forgets keys on lock", func(t *testing.T) {
+		path := start(t, time.Minute)
+
+		require.NoError(t, Put(path, "id1", key))
+		require.NoError(t, Put(path, "id2", key))
+
+		count, err := Lock(path)
+		require.NoError(t, err)
+		require.Equal(t, 2, count)
+
+		_, err = Get(path, "id1")
+		require.ErrorIs(t, err, ErrNotFound)
+	})
+
+	t.Run("returns ErrNotRunning without agent", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.sock")
+
+		_, err := Get(path, "id")
+		require.ErrorIs(t, err, ErrNotRunning)
+		require.ErrorIs(t, Ping(path), ErrNotRunning)
+	})
+}
+
+func TestAgent(t *testing.T) {
+	t.Run("restarts idle timeout on use", func(t *testing.T) {
+		a := New(300 * time.Millisecond)
+		require.True(t, a.Put("id", []byte("key")))
+
+		for range 4 {
+			time.Sleep(100 * time.Millisecond)
+			_, ok := a.Get("id")
+			require.True(t, ok)
+		}
+	})
+
+	t.Run("erases forgotten keys", func(t *testing.T) {
+		a := New(time.Minute)
+		key := []byte("key")
+		require.True(t, a.Put("id", key))
+
+		require.Equal(t, 1, a.Lock())
+		require.Equal(t, []byte{0, 0, 0}, key)
+	})
+
+	t.Run("refuses keys once closed", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "agent.sock")
+		listener, err := Listen(path)
+		require.NoError(t, err)
+
+		a := New(time.Minute)
+		require.True(t, a.Put("id1", []byte("key")))
+		require.NoError(t, listener.Close())
+		require.NoError(t, a.Serve(listener))
+
+		_, ok := a.Get("id1")
+		require.False(t, ok)
+		key := []byte("key")
+		require.False(t, a.Put("id2", key))
+		require.Equal(t, []byte{0, 0, 0}, key)
+		_, ok = a.Get("id2")
+		require.False(t, ok)
+	})
+}
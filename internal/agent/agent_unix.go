@@ -0,0 +1,47 @@
+//go:build unix
+
+package agent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// Listen listens on a Unix socket at path that only the current user can
+// access. A stale socket left by an agent that exited is replaced. The umask
+// of the process is changed while the socket is created.
+func Listen(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	if err := Ping(path); err == nil {
+		return nil, fmt.Errorf("an agent is already running on %s", path)
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	// Create the socket restricted to its owner, so that no other user can
+	// connect before it is restricted below
+	umask := syscall.Umask(0o077)
+	listener, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen: %w", err)
+	}
+	if err := os.Chmod(path, 0o600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("failed to restrict socket: %w", err)
+	}
+	return listener, nil
+}
+
+// dial connects to the agent listening on the socket at path.
+func dial(path string) (net.Conn, error) {
+	return net.DialTimeout("unix", path, ioTimeout)
+}
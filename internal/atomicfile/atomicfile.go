@@ -0,0 +1,104 @@
+package atomicfile
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+)
+
+// maxLinks bounds how many symbolic links are followed to find the file to
+// replace.
+const maxLinks = 40
+
+// WriteFile writes data to path atomically: data is written to a temporary
+// file in the same directory, synced to disk, then renamed over path. A crash
+// leaves either the previous content or the new one, never a truncated file.
+//
+// An existing file keeps its permissions, a new file is created with perm. If
+// path is a symbolic link, the file it points to is replaced, not the link.
+func WriteFile(
+	fs afero.Fs,
+	path string,
+	data []byte,
+	perm os.FileMode,
+) error {
+	path = resolveLinks(fs, path)
+
+	info, err := fs.Stat(path)
+	switch {
+	case err == nil:
+		perm = info.Mode().Perm()
+	case !errors.Is(err, os.ErrNotExist):
+		return err
+	}
+
+	dir := filepath.Dir(path)
+	tmp, err := afero.TempFile(fs, dir, "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+
+	// The temporary file is removed unless it was renamed
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = tmp.Close()
+			_ = fs.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := fs.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	if err := fs.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	renamed = true
+
+	syncDir(fs, dir)
+	return nil
+}
+
+// resolveLinks returns the path of the file path points to, following
+// symbolic links. Returns path unchanged if fs doesn't support links.
+func resolveLinks(fs afero.Fs, path string) string {
+	reader, ok := fs.(afero.LinkReader)
+	if !ok {
+		return path
+	}
+
+	for range maxLinks {
+		target, err := reader.ReadlinkIfPossible(path)
+		if err != nil {
+			return path
+		}
+		if !filepath.IsAbs(target) {
+			target = filepath.Join(filepath.Dir(path), target)
+		}
+		path = target
+	}
+	return path
+}
+
+// syncDir flushes the directory entry of the renamed file to disk. Syncing a
+// directory is not supported on every platform, so errors are ignored.
+func syncDir(fs afero.Fs, dir string) {
+	d, err := fs.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
@@ -0,0 +1,79 @@
+package atomicfile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFile(t *testing.T) {
+	t.Run("creates file with permissions", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, fs.MkdirAll("/test", 0o755))
+
+		err := WriteFile(fs, "/test/file.json", []byte("data"), 0o600)
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(fs, "/test/file.json")
+		require.NoError(t, err)
+		assert.Equal(t, "data", string(data))
+
+		info, err := fs.Stat("/test/file.json")
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("replaces file keeping its permissions", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		path := "/test/file.json"
+		require.NoError(t, afero.WriteFile(fs, path, []byte("old"), 0o640))
+
+		err := WriteFile(fs, path, []byte("new"), 0o600)
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(data))
+
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+	})
+
+	t.Run("leaves no temporary file", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		require.NoError(t, fs.MkdirAll("/test", 0o755))
+
+		err := WriteFile(fs, "/test/file.json", []byte("data"), 0o600)
+		require.NoError(t, err)
+
+		names, err := afero.ReadDir(fs, "/test")
+		require.NoError(t, err)
+		require.Len(t, names, 1)
+		assert.Equal(t, "file.json", names[0].Name())
+	})
+
+	t.Run("replaces the target of symbolic links", func(t *testing.T) {
+		fs := afero.NewOsFs()
+		dir := t.TempDir()
+		target := filepath.Join(dir, "target.json")
+		link := filepath.Join(dir, "link.json")
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0o600))
+		require.NoError(t, os.Symlink("target.json", link))
+
+		err := WriteFile(fs, link, []byte("new"), 0o600)
+		require.NoError(t, err)
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink)
+
+		data, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(data))
+	})
+}
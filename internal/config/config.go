@@ -9,22 +9,88 @@ import (
 
 	"github.com/spf13/afero"
 
+	"github.com/loderunner/apiki/internal/atomicfile"
 	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/migrate"
 	"github.com/loderunner/apiki/internal/set"
 )
 
 var fs = afero.NewOsFs()
 
+// Version is the version of the config file format written by Save.
+const Version = 2
+
+// entryIDsVersion is the version from which selections hold the IDs of
+// entries instead of their positional IDs.
+const entryIDsVersion = 2
+
+// migrations returns the migrations upgrading config files written by older
+// versions, in order: migrations[i] upgrades version i to i+1. Positional IDs
+// are replaced with the IDs of the entries of list.
+func migrations(list []entries.Entry) []migrate.Migration {
+	return []migrate.Migration{
+		// 1: config files have a version, the format is unchanged
+		func(map[string]any) error { return nil },
+
+		// 2: selections hold entry IDs instead of positional IDs, which
+		// change when entries are added or removed
+		func(doc map[string]any) error {
+			migrateIDs(doc, list)
+			return nil
+		},
+	}
+}
+
 // Config represents the apiki configuration file.
 type Config struct {
+	// Version is the version of the file format. Older files are migrated
+	// on load.
+	Version int `json:"version"`
+
+	// Selected holds the IDs of the selected entries.
 	Selected set.Set[string] `json:"selected,omitempty"`
+
+	// Files maps the selected IDs to the absolute path of the variables file
+	// holding their entry, so that the entries of files that aren't loaded
+	// are told apart from deleted entries. IDs selected by older versions
+	// have no path.
+	Files map[string]string `json:"files,omitempty"`
+
+	// Profiles maps profile names to saved selections of entry IDs.
+	Profiles map[string]set.Set[string] `json:"profiles,omitempty"`
+
+	// positionalIDs is true if the selections may hold positional IDs saved
+	// by older versions, see LoadWithEntries
+	positionalIDs bool
 }
 
 // Load reads the config file from disk and parses it into memory.
-// Returns an empty config if the file doesn't exist.
+// Returns an empty config if the file doesn't exist. Files written by older
+// versions are migrated and saved, after writing a backup. Files written by
+// newer versions are refused.
+//
+// Positional IDs saved by older versions can't be replaced without the
+// entries: they are kept, and saved as such, until the file is loaded with
+// LoadWithEntries.
 func Load(path string) (*Config, error) {
+	return load(path, nil, false)
+}
+
+// LoadWithEntries is like Load, but replaces the positional IDs saved by
+// older versions with the IDs of the entries of list, once.
+func LoadWithEntries(path string, list []entries.Entry) (*Config, error) {
+	return load(path, list, true)
+}
+
+// load reads the config file at path, replacing the positional IDs saved by
+// older versions with the IDs of the entries of list if withEntries is true.
+func load(
+	path string,
+	list []entries.Entry,
+	withEntries bool,
+) (*Config, error) {
 	dir := filepath.Dir(path)
-	if err := fs.MkdirAll(dir, 0o755); err != nil {
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
@@ -32,7 +98,9 @@ func Load(path string) (*Config, error) {
 	if err != nil {
 		if errors.Is(err, afero.ErrFileNotFound) {
 			return &Config{
+				Version:  Version,
 				Selected: set.New[string](),
+				Profiles: make(map[string]set.Set[string]),
 			}, nil
 		}
 		return nil, fmt.Errorf("failed to read file: %w", err)
@@ -40,47 +108,188 @@ func Load(path string) (*Config, error) {
 
 	if len(data) == 0 {
 		return &Config{
+			Version:  Version,
 			Selected: set.New[string](),
+			Profiles: make(map[string]set.Set[string]),
 		}, nil
 	}
 
+	// Stop before replacing positional IDs without the entries
+	migrations := migrations(list)
+	positionalIDs := false
+	if !withEntries {
+		var doc map[string]any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse JSON: %w", err)
+		}
+		version, err := migrate.Version(doc)
+		if err != nil {
+			return nil, err
+		}
+		if version < entryIDsVersion {
+			migrations = migrations[:entryIDsVersion-1]
+			positionalIDs = true
+		}
+	}
+
+	data, migrated, err := migrate.Upgrade(fs, path, data, migrations)
+	if err != nil {
+		return nil, err
+	}
+
 	var cfg Config
 	if err := json.Unmarshal(data, &cfg); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
+	cfg.positionalIDs = positionalIDs
 
 	// Initialize Selected if nil (for backward compatibility)
 	if cfg.Selected == nil {
 		cfg.Selected = set.New[string]()
 	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = make(map[string]set.Set[string])
+	}
+
+	if migrated {
+		if err := Save(path, &cfg); err != nil {
+			return nil, err
+		}
+	}
 
 	return &cfg, nil
 }
 
-// Save serializes the config and writes it to disk.
+// Save serializes the config and writes it to disk atomically.
 func Save(path string, c *Config) error {
 	dir := filepath.Dir(path)
-	if err := fs.MkdirAll(dir, 0o755); err != nil {
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(c, "", "  ")
+	// Always write the current version, unless positional IDs remain
+	toSave := *c
+	toSave.Version = Version
+	if c.positionalIDs {
+		toSave.Version = entryIDsVersion - 1
+	}
+
+	data, err := json.MarshalIndent(&toSave, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	if err := afero.WriteFile(fs, path, data, 0o644); err != nil {
+	if err := atomicfile.WriteFile(fs, path, data, 0o600); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
 	return nil
 }
 
-// EntryID computes the unique identifier for an entry at the given index.
-// For entries with unique names, returns just the name.
-// For entries in radio groups (same name), returns "name[index]" where index
-// is the position within the radio group after sorting.
-func EntryID(entries []entries.Entry, index int) string {
+// SelectFiles replaces the selection of the entries of the variables files at
+// paths: the IDs of loaded and the IDs recorded for those files are
+// deselected, then the IDs of selected are selected, mapped to the path of
+// their file. The selection of the entries of other files is kept.
+func (c *Config) SelectFiles(
+	paths []string,
+	loaded set.Set[string],
+	selected map[string]string,
+) {
+	for _, id := range loaded.Members() {
+		c.Selected.Remove(id)
+		delete(c.Files, id)
+	}
+	for id := range c.Files {
+		if c.InFiles(id, paths) {
+			c.Selected.Remove(id)
+			delete(c.Files, id)
+		}
+	}
+
+	if c.Files == nil {
+		c.Files = make(map[string]string, len(selected))
+	}
+	for id, path := range selected {
+		c.Selected.Add(id)
+		c.Files[id] = abs(path)
+	}
+}
+
+// InFiles returns true if the selected id was recorded in one of the
+// variables files at paths, see Files.
+func (c *Config) InFiles(id string, paths []string) bool {
+	path, ok := c.Files[id]
+	if !ok {
+		return false
+	}
+	return slices.ContainsFunc(paths, func(p string) bool {
+		return abs(p) == path
+	})
+}
+
+// abs returns the absolute form of path, or path itself if it can't be
+// computed.
+func abs(path string) string {
+	if a, err := filepath.Abs(path); err == nil {
+		return a
+	}
+	return path
+}
+
+// HasPositionalIDs returns true if the selections may hold positional IDs
+// saved by older versions, see LoadWithEntries.
+func (c *Config) HasPositionalIDs() bool {
+	return c.positionalIDs
+}
+
+// ProfileNames returns the names of all profiles, sorted.
+func (c *Config) ProfileNames() []string {
+	names := make([]string, 0, len(c.Profiles))
+	for name := range c.Profiles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// migrateIDs replaces in the selections of doc the positional IDs saved by
+// older versions, as computed by PositionalID, with the IDs of the entries of
+// list. IDs of entries are kept, a config file may hold both.
+func migrateIDs(doc map[string]any, list []entries.Entry) {
+	ids := make(map[string]struct{}, len(list))
+	legacy := make(map[string]string, len(list))
+	for i, entry := range list {
+		ids[entry.ID] = struct{}{}
+		legacy[PositionalID(list, i)] = entry.ID
+	}
+
+	replace := func(selection any) {
+		keys, _ := selection.([]any)
+		for i, key := range keys {
+			key, _ := key.(string)
+			if _, ok := ids[key]; ok {
+				continue
+			}
+			if id, ok := legacy[key]; ok {
+				keys[i] = id
+			}
+		}
+	}
+
+	replace(doc["selected"])
+	profiles, _ := doc["profiles"].(map[string]any)
+	for _, profile := range profiles {
+		replace(profile)
+	}
+}
+
+// PositionalID computes an identifier for an entry from its position in
+// list. For entries with unique names, returns just the name. For entries in
+// radio groups (same name), returns "name[index]" where index is the position
+// within the radio group after sorting. Positional IDs change when entries
+// are added or removed: they were saved by older versions, and are only
+// accepted on the command line.
+func PositionalID(entries []entries.Entry, index int) string {
 	if index < 0 || index >= len(entries) {
 		return ""
 	}
@@ -9,6 +9,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/migrate"
 	"github.com/loderunner/apiki/internal/set"
 )
 
@@ -48,6 +49,77 @@ func TestLoadMissing(t *testing.T) {
 	assert.Empty(t, cfg.Selected, "expected empty Selected set")
 }
 
+func TestLoadProfiles(t *testing.T) {
+	path := "/test/profiles-config.json"
+
+	cfg := &Config{
+		Selected: set.New("VAR1"),
+		Profiles: map[string]set.Set[string]{
+			"staging": set.New("VAR1", "VAR2[1]"),
+			"local":   set.New[string](),
+		},
+	}
+	err := Save(path, cfg)
+	require.NoError(t, err, "Save failed")
+
+	loaded, err := Load(path)
+	require.NoError(t, err, "Load failed")
+
+	assert.Equal(t, []string{"local", "staging"}, loaded.ProfileNames())
+	assert.Equal(t, set.New("VAR1", "VAR2[1]"), loaded.Profiles["staging"])
+	assert.Empty(t, loaded.Profiles["local"])
+}
+
+func TestLoadWithoutProfiles(t *testing.T) {
+	path := "/test/no-profiles-config.json"
+	err := afero.WriteFile(fs, path, []byte(`{"selected":["VAR1"]}`), 0o644)
+	require.NoError(t, err)
+
+	loaded, err := Load(path)
+	require.NoError(t, err, "Load failed")
+
+	assert.NotNil(t, loaded.Profiles, "expected non-nil Profiles map")
+	assert.Empty(t, loaded.ProfileNames())
+}
+
+func TestLoadOlderVersion(t *testing.T) {
+	path := "/test/legacy-config.json"
+	data := []byte(`{"selected":["VAR1"]}`)
+	err := afero.WriteFile(fs, path, data, 0o644)
+	require.NoError(t, err)
+
+	loaded, err := Load(path)
+	require.NoError(t, err, "Load failed")
+	assert.Equal(t, 1, loaded.Version)
+	assert.Equal(t, set.New("VAR1"), loaded.Selected)
+
+	backup, err := afero.ReadFile(fs, path+".v0.bak")
+	require.NoError(t, err)
+	assert.Equal(t, data, backup)
+
+	// Positional IDs are kept until loaded with the entries
+	saved, err := afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), `"version": 1`)
+	require.NoError(t, Save(path, loaded))
+	saved, err = afero.ReadFile(fs, path)
+	require.NoError(t, err)
+	assert.Contains(t, string(saved), `"version": 1`)
+}
+
+func TestLoadNewerVersion(t *testing.T) {
+	path := "/test/newer-config.json"
+	err := afero.WriteFile(fs, path, []byte(`{"version":99}`), 0o644)
+	require.NoError(t, err)
+
+	_, err = Load(path)
+	require.ErrorIs(t, err, migrate.ErrTooNew)
+}
+
+func TestMigrations(t *testing.T) {
+	require.Len(t, migrations(nil), Version)
+}
+
 func TestSave(t *testing.T) {
 	path := "/test/save-config.json"
 
@@ -64,19 +136,19 @@ func TestSave(t *testing.T) {
 	assert.True(t, exists, "config file not created")
 }
 
-func TestEntryID_UniqueName(t *testing.T) {
+func TestPositionalID_UniqueName(t *testing.T) {
 	entries := []entries.Entry{
 		{Name: "VAR1", Value: "value1"},
 		{Name: "VAR2", Value: "value2"},
 		{Name: "VAR3", Value: "value3"},
 	}
 
-	assert.Equal(t, "VAR1", EntryID(entries, 0))
-	assert.Equal(t, "VAR2", EntryID(entries, 1))
-	assert.Equal(t, "VAR3", EntryID(entries, 2))
+	assert.Equal(t, "VAR1", PositionalID(entries, 0))
+	assert.Equal(t, "VAR2", PositionalID(entries, 1))
+	assert.Equal(t, "VAR3", PositionalID(entries, 2))
 }
 
-func TestEntryID_RadioGroup(t *testing.T) {
+func TestPositionalID_RadioGroup(t *testing.T) {
 	entries := []entries.Entry{
 		{Name: "VAR", Value: "value1"},
 		{Name: "VAR", Value: "value2"},
@@ -85,11 +157,75 @@ func TestEntryID_RadioGroup(t *testing.T) {
 		{Name: "VAR", Value: "value4"},
 	}
 
-	assert.Equal(t, "VAR[0]", EntryID(entries, 0))
-	assert.Equal(t, "VAR[1]", EntryID(entries, 1))
-	assert.Equal(t, "VAR[2]", EntryID(entries, 2))
-	assert.Equal(t, "OTHER", EntryID(entries, 3))
-	assert.Equal(t, "VAR[3]", EntryID(entries, 4))
+	assert.Equal(t, "VAR[0]", PositionalID(entries, 0))
+	assert.Equal(t, "VAR[1]", PositionalID(entries, 1))
+	assert.Equal(t, "VAR[2]", PositionalID(entries, 2))
+	assert.Equal(t, "OTHER", PositionalID(entries, 3))
+	assert.Equal(t, "VAR[3]", PositionalID(entries, 4))
+}
+
+func TestLoadWithEntries(t *testing.T) {
+	list := []entries.Entry{
+		{ID: "a1", Name: "VAR", Label: "dev"},
+		{ID: "b2", Name: "VAR", Label: "prod"},
+		{ID: "c3", Name: "OTHER"},
+	}
+
+	t.Run("replaces positional IDs", func(t *testing.T) {
+		path := "/test/positional-config.json"
+		data := []byte(`{
+			"version": 1,
+			"selected": ["VAR[1]", "c3", "GONE"],
+			"profiles": {"dev": ["VAR[0]", "OTHER"]}
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		loaded, err := LoadWithEntries(path, list)
+		require.NoError(t, err)
+		assert.ElementsMatch(
+			t,
+			[]string{"b2", "c3", "GONE"},
+			loaded.Selected.Members(),
+		)
+		assert.ElementsMatch(
+			t,
+			[]string{"a1", "c3"},
+			loaded.Profiles["dev"].Members(),
+		)
+
+		backup, err := afero.ReadFile(fs, path+".v1.bak")
+		require.NoError(t, err)
+		assert.Equal(t, data, backup)
+	})
+
+	t.Run("replaces positional IDs once", func(t *testing.T) {
+		path := "/test/migrated-config.json"
+		data := []byte(`{"version": 2, "selected": ["OTHER"]}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		// A variable named like an old positional ID is not an ID
+		loaded, err := LoadWithEntries(path, list)
+		require.NoError(t, err)
+		assert.Equal(t, set.New("OTHER"), loaded.Selected)
+	})
+
+	t.Run("replaces positional IDs kept by Load", func(t *testing.T) {
+		path := "/test/deferred-config.json"
+		data := []byte(`{"selected": ["VAR[0]"]}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		loaded, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, set.New("VAR[0]"), loaded.Selected)
+
+		loaded, err = LoadWithEntries(path, list)
+		require.NoError(t, err)
+		assert.Equal(t, set.New("a1"), loaded.Selected)
+		assert.Equal(t, Version, loaded.Version)
+	})
 }
 
 func TestConfigRoundTrip(t *testing.T) {
@@ -123,3 +259,35 @@ func TestConfigRoundTrip(t *testing.T) {
 		)
 	}
 }
+
+func TestSelectFiles(t *testing.T) {
+	t.Run("keeps the selection of other files", func(t *testing.T) {
+		cfg := &Config{
+			Selected: set.New("legacy", "a1", "b2", "c3", "gone"),
+			Files: map[string]string{
+				"a1":   "/work/personal.json",
+				"b2":   "/work/team.json",
+				"c3":   "/work/personal.json",
+				"gone": "/work/personal.json",
+			},
+		}
+
+		cfg.SelectFiles(
+			[]string{"/work/personal.json"},
+			set.New("a1", "c3", "legacy"),
+			map[string]string{"c3": "/work/personal.json"},
+		)
+
+		assert.Equal(t, set.New("b2", "c3"), cfg.Selected)
+		assert.Equal(
+			t,
+			map[string]string{
+				"b2": "/work/team.json",
+				"c3": "/work/personal.json",
+			},
+			cfg.Files,
+		)
+		assert.True(t, cfg.InFiles("c3", []string{"/work/personal.json"}))
+		assert.False(t, cfg.InFiles("b2", []string{"/work/personal.json"}))
+	})
+}
@@ -9,6 +9,9 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"math"
+	"strings"
+	"time"
 
 	"golang.org/x/crypto/argon2"
 )
@@ -26,16 +29,76 @@ const (
 	// TagSize is the size of the authentication tag for AES-GCM (16 bytes)
 	TagSize = 16
 
-	// Argon2id parameters
-	argon2Memory      = 64 * 1024 // 64 MiB
-	argon2Iterations  = 3
-	argon2Parallelism = 4
+	// Prefix for encrypted values, authenticating associated data
+	prefixV2 = "enc:v2:"
 
-	// Prefix for encrypted values
-	prefix    = "enc:v1:"
-	prefixLen = len(prefix)
+	// Prefix for legacy encrypted values, without associated data
+	prefixV1 = "enc:v1:"
 )
 
+// KDFParams holds the parameters of the Argon2id key derivation.
+type KDFParams struct {
+	// Memory is the memory used, in KiB.
+	Memory uint32
+
+	// Iterations is the number of passes over the memory.
+	Iterations uint32
+
+	// Parallelism is the number of threads used.
+	Parallelism uint8
+}
+
+// DefaultKDFParams are the parameters used when none are given, and by files
+// written before parameters were recorded.
+var DefaultKDFParams = KDFParams{
+	Memory:      64 * 1024, // 64 MiB
+	Iterations:  3,
+	Parallelism: 4,
+}
+
+// Validate returns an error if the parameters are too weak to be used.
+func (p KDFParams) Validate() error {
+	switch {
+	case p.Memory < 8*1024:
+		return errors.New("KDF memory must be at least 8 MiB")
+	case p.Iterations < 1:
+		return errors.New("KDF iterations must be at least 1")
+	case p.Parallelism < 1:
+		return errors.New("KDF parallelism must be at least 1")
+	}
+	return nil
+}
+
+// String describes the parameters, e.g. "64 MiB, 3 iterations, parallelism 4".
+func (p KDFParams) String() string {
+	return fmt.Sprintf(
+		"%d MiB, %d iterations, parallelism %d",
+		p.Memory/1024,
+		p.Iterations,
+		p.Parallelism,
+	)
+}
+
+// Calibrate returns the parameters whose key derivation takes about target on
+// the current machine, increasing the iterations of base. The parameters are
+// never weaker than base.
+func Calibrate(base KDFParams, target time.Duration) KDFParams {
+	// Time a derivation with several iterations, to spread the cost of
+	// allocating memory
+	salt := make([]byte, SaltSize)
+	start := time.Now()
+	DeriveKey("calibration", salt, base)
+	perIteration := time.Since(start) / time.Duration(max(base.Iterations, 1))
+
+	iterations := min(
+		target/max(perIteration, time.Millisecond),
+		math.MaxUint32,
+	)
+	params := base
+	params.Iterations = max(uint32(iterations), base.Iterations)
+	return params
+}
+
 // GenerateSalt generates a random salt for Argon2id key derivation.
 func GenerateSalt() ([]byte, error) {
 	salt := make([]byte, SaltSize)
@@ -53,14 +116,15 @@ func GenerateSalt() ([]byte, error) {
 	return salt, nil
 }
 
-// DeriveKey derives a 32-byte encryption key from a password using Argon2id.
-func DeriveKey(password string, salt []byte) []byte {
+// DeriveKey derives a 32-byte encryption key from a password using Argon2id
+// with the given parameters.
+func DeriveKey(password string, salt []byte, params KDFParams) []byte {
 	return argon2.IDKey(
 		[]byte(password),
 		salt,
-		argon2Iterations,
-		argon2Memory,
-		argon2Parallelism,
+		params.Iterations,
+		params.Memory,
+		params.Parallelism,
 		KeySize,
 	)
 }
@@ -74,13 +138,22 @@ func ComputeVerifier(key []byte, salt []byte) []byte {
 	return mac.Sum(nil)
 }
 
-// VerifyPassword verifies a password against a verifier.
-func VerifyPassword(password string, salt []byte, verifier []byte) bool {
-	key := DeriveKey(password, salt)
+// VerifyKey verifies a key derived from a password against a verifier.
+func VerifyKey(key []byte, salt []byte, verifier []byte) bool {
 	computed := ComputeVerifier(key, salt)
 	return hmac.Equal(computed, verifier)
 }
 
+// VerifyPassword verifies a password against a verifier.
+func VerifyPassword(
+	password string,
+	salt []byte,
+	verifier []byte,
+	params KDFParams,
+) bool {
+	return VerifyKey(DeriveKey(password, salt, params), salt, verifier)
+}
+
 // GenerateKey generates a random 32-byte encryption key.
 func GenerateKey() ([]byte, error) {
 	key := make([]byte, KeySize)
@@ -96,22 +169,19 @@ func GenerateKey() ([]byte, error) {
 	return key, nil
 }
 
-// Encrypt encrypts a plaintext value using AES-256-GCM.
+// Encrypt encrypts a plaintext value using AES-256-GCM, authenticating
+// associatedData along with it. The value only decrypts with the same
+// associated data.
 // Returns a base64-encoded string with format:
-// "enc:v1:base64(nonce||ciphertext||tag)"
-func Encrypt(key []byte, plaintext string) (string, error) {
-	if len(key) != KeySize {
-		return "", errors.New("invalid key size")
-	}
-
-	block, err := aes.NewCipher(key)
-	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
-	}
-
-	aead, err := cipher.NewGCM(block)
+// "enc:v2:base64(nonce||ciphertext||tag)"
+func Encrypt(
+	key []byte,
+	plaintext string,
+	associatedData []byte,
+) (string, error) {
+	aead, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+		return "", err
 	}
 
 	nonce := make([]byte, NonceSize)
@@ -125,53 +195,84 @@ func Encrypt(key []byte, plaintext string) (string, error) {
 		)
 	}
 
-	ciphertext := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	ciphertext := aead.Seal(nonce, nonce, []byte(plaintext), associatedData)
 
 	// Format: nonce (12 bytes) || ciphertext || tag (16 bytes)
 	encoded := base64.StdEncoding.EncodeToString(ciphertext)
-	return fmt.Sprintf("%s%s", prefix, encoded), nil
+	return fmt.Sprintf("%s%s", prefixV2, encoded), nil
 }
 
-// IsEncrypted returns true if the value has the encryption prefix.
+// IsEncrypted returns true if the value has an encryption prefix.
 func IsEncrypted(value string) bool {
-	return len(value) >= prefixLen && value[:prefixLen] == prefix
+	return strings.HasPrefix(value, prefixV2) || IsLegacy(value)
 }
 
-// Decrypt decrypts an encrypted value.
-// Expects format: "enc:v1:base64(nonce||ciphertext||tag)"
-func Decrypt(key []byte, encrypted string) (string, error) {
-	if len(key) != KeySize {
-		return "", errors.New("invalid key size")
-	}
+// IsLegacy returns true if the value was encrypted in the "enc:v1:" format,
+// without associated data.
+func IsLegacy(value string) bool {
+	return strings.HasPrefix(value, prefixV1)
+}
 
+// Decrypt decrypts an encrypted value. Values in the "enc:v2:" format must
+// have been encrypted with the same associatedData, which is ignored for
+// values in the legacy "enc:v1:" format.
+// Expects format: "enc:v2:base64(nonce||ciphertext||tag)"
+func Decrypt(
+	key []byte,
+	encrypted string,
+	associatedData []byte,
+) (string, error) {
 	// Check prefix
-	if !IsEncrypted(encrypted) {
+	var encoded string
+	switch {
+	case strings.HasPrefix(encrypted, prefixV2):
+		encoded = encrypted[len(prefixV2):]
+	case IsLegacy(encrypted):
+		encoded = encrypted[len(prefixV1):]
+		associatedData = nil
+	default:
 		return "", errors.New("invalid encryption format")
 	}
 
-	// Decode base64
-	data, err := base64.StdEncoding.DecodeString(encrypted[prefixLen:])
+	aead, err := newGCM(key)
 	if err != nil {
-		return "", fmt.Errorf("failed to decode base64: %w", err)
+		return "", err
 	}
 
-	block, err := aes.NewCipher(key)
+	// Decode base64
+	data, err := base64.StdEncoding.DecodeString(encoded)
 	if err != nil {
-		return "", fmt.Errorf("failed to create cipher: %w", err)
+		return "", fmt.Errorf("failed to decode base64: %w", err)
 	}
-
-	aead, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", fmt.Errorf("failed to create GCM: %w", err)
+	if len(data) < NonceSize+TagSize {
+		return "", errors.New("invalid encrypted value")
 	}
 
 	nonce := data[:NonceSize]
 	ciphertext := data[NonceSize:]
 
-	plaintext, err := aead.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := aead.Open(nil, nonce, ciphertext, associatedData)
 	if err != nil {
 		return "", fmt.Errorf("failed to decrypt: %w", err)
 	}
 
 	return string(plaintext), nil
 }
+
+// newGCM returns the AES-256-GCM cipher of key.
+func newGCM(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, errors.New("invalid key size")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
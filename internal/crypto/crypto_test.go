@@ -1,7 +1,10 @@
 package crypto
 
 import (
+	"crypto/rand"
+	"encoding/base64"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
@@ -30,8 +33,8 @@ func TestDeriveKey(t *testing.T) {
 		func(t *testing.T) {
 			salt := []byte("test-salt-16-b")
 
-			key1 := DeriveKey("password1", salt)
-			key2 := DeriveKey("password2", salt)
+			key1 := DeriveKey("password1", salt, DefaultKDFParams)
+			key2 := DeriveKey("password2", salt, DefaultKDFParams)
 
 			require.NotEqual(
 				t,
@@ -45,8 +48,8 @@ func TestDeriveKey(t *testing.T) {
 	t.Run("derives different keys from different salts", func(t *testing.T) {
 		password := "test-password"
 
-		key1 := DeriveKey(password, []byte("salt1-16-bytes"))
-		key2 := DeriveKey(password, []byte("salt2-16-bytes"))
+		key1 := DeriveKey(password, []byte("salt1-16-bytes"), DefaultKDFParams)
+		key2 := DeriveKey(password, []byte("salt2-16-bytes"), DefaultKDFParams)
 
 		require.NotEqual(
 			t,
@@ -57,9 +60,50 @@ func TestDeriveKey(t *testing.T) {
 	})
 
 	t.Run("produces 32-byte key", func(t *testing.T) {
-		key := DeriveKey("password", []byte("test-salt-16-b"))
+		key := DeriveKey("password", []byte("test-salt-16-b"), DefaultKDFParams)
 		require.Len(t, key, KeySize)
 	})
+
+	t.Run("derives different keys from different params", func(t *testing.T) {
+		salt := []byte("test-salt-16-b")
+		params := DefaultKDFParams
+		params.Iterations++
+
+		key1 := DeriveKey("password", salt, DefaultKDFParams)
+		key2 := DeriveKey("password", salt, params)
+
+		require.NotEqual(t, key1, key2)
+	})
+}
+
+func TestKDFParamsValidate(t *testing.T) {
+	require.NoError(t, DefaultKDFParams.Validate())
+
+	for name, params := range map[string]KDFParams{
+		"too little memory": {Memory: 1024, Iterations: 3, Parallelism: 4},
+		"no iterations":     {Memory: 65536, Iterations: 0, Parallelism: 4},
+		"no parallelism":    {Memory: 65536, Iterations: 3, Parallelism: 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			require.Error(t, params.Validate())
+		})
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	base := KDFParams{Memory: 8 * 1024, Iterations: 2, Parallelism: 1}
+
+	t.Run("keeps base params for short targets", func(t *testing.T) {
+		params := Calibrate(base, time.Nanosecond)
+		require.Equal(t, base, params)
+	})
+
+	t.Run("increases iterations for long targets", func(t *testing.T) {
+		params := Calibrate(base, time.Hour)
+		require.Greater(t, params.Iterations, base.Iterations)
+		require.Equal(t, base.Memory, params.Memory)
+		require.Equal(t, base.Parallelism, params.Parallelism)
+	})
 }
 
 func TestComputeVerifier(t *testing.T) {
@@ -99,16 +143,26 @@ func TestVerifyPassword(t *testing.T) {
 	salt, err := GenerateSalt()
 	require.NoError(t, err)
 
-	key := DeriveKey(correctPassword, salt)
+	key := DeriveKey(correctPassword, salt, DefaultKDFParams)
 	verifier := ComputeVerifier(key, salt)
 
 	t.Run("verifies correct password", func(t *testing.T) {
-		verified := VerifyPassword("correct-password", salt, verifier)
+		verified := VerifyPassword(
+			"correct-password",
+			salt,
+			verifier,
+			DefaultKDFParams,
+		)
 		require.True(t, verified, "correct password should verify")
 	})
 
 	t.Run("rejects incorrect password", func(t *testing.T) {
-		verified := VerifyPassword("wrong-password", salt, verifier)
+		verified := VerifyPassword(
+			"wrong-password",
+			salt,
+			verifier,
+			DefaultKDFParams,
+		)
 		require.False(t, verified, "incorrect password should not verify")
 	})
 
@@ -117,9 +171,17 @@ func TestVerifyPassword(t *testing.T) {
 			correctPassword,
 			[]byte("wrong-salt-16-b"),
 			verifier,
+			DefaultKDFParams,
 		)
 		require.False(t, verified, "password with wrong salt should not verify")
 	})
+
+	t.Run("rejects password with other params", func(t *testing.T) {
+		params := DefaultKDFParams
+		params.Memory *= 2
+		verified := VerifyPassword(correctPassword, salt, verifier, params)
+		require.False(t, verified, "params should be part of the key")
+	})
 }
 
 func TestGenerateKey(t *testing.T) {
@@ -145,7 +207,7 @@ func TestIsEncrypted(t *testing.T) {
 		key, err := GenerateKey()
 		require.NoError(t, err)
 
-		encrypted, err := Encrypt(key, "secret")
+		encrypted, err := Encrypt(key, "secret", associatedData)
 		require.NoError(t, err)
 
 		require.True(t, IsEncrypted(encrypted))
@@ -158,7 +220,7 @@ func TestIsEncrypted(t *testing.T) {
 			"enc:",
 			"enc:v",
 			"enc:v1",
-			"enc:v2:something",
+			"enc:v3:something",
 			"some-random-value",
 		}
 
@@ -170,29 +232,42 @@ func TestIsEncrypted(t *testing.T) {
 	t.Run("returns true for prefix only", func(t *testing.T) {
 		// Edge case: just the prefix with no payload
 		require.True(t, IsEncrypted("enc:v1:"))
+		require.True(t, IsEncrypted("enc:v2:"))
 	})
 }
 
+func TestIsLegacy(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+
+	encrypted, err := Encrypt(key, "secret", associatedData)
+	require.NoError(t, err)
+	require.False(t, IsLegacy(encrypted))
+
+	require.True(t, IsLegacy(encryptV1(t, key, "secret")))
+	require.False(t, IsLegacy("plaintext"))
+}
+
 func TestEncrypt(t *testing.T) {
 	t.Run("encrypts plaintext successfully", func(t *testing.T) {
 		key, err := GenerateKey()
 		require.NoError(t, err)
 
 		plaintext := "secret-value-123"
-		encrypted, err := Encrypt(key, plaintext)
+		encrypted, err := Encrypt(key, plaintext, associatedData)
 		require.NoError(t, err)
 		require.NotEmpty(t, encrypted)
 		require.Contains(
 			t,
 			encrypted,
-			prefix,
+			prefixV2,
 			"encrypted value should have prefix",
 		)
 	})
 
 	t.Run("rejects invalid key size", func(t *testing.T) {
 		invalidKey := []byte("too-short")
-		_, err := Encrypt(invalidKey, "plaintext")
+		_, err := Encrypt(invalidKey, "plaintext", associatedData)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid key size")
 	})
@@ -215,7 +290,7 @@ func TestDecrypt(t *testing.T) {
 		}
 
 		for _, plaintext := range testCases {
-			encrypted, err := Encrypt(key, plaintext)
+			encrypted, err := Encrypt(key, plaintext, associatedData)
 			require.NoError(
 				t,
 				err,
@@ -223,7 +298,7 @@ func TestDecrypt(t *testing.T) {
 				plaintext,
 			)
 
-			decrypted, err := Decrypt(key, encrypted)
+			decrypted, err := Decrypt(key, encrypted, associatedData)
 			require.NoError(
 				t,
 				err,
@@ -248,19 +323,53 @@ func TestDecrypt(t *testing.T) {
 		require.NoError(t, err2)
 
 		plaintext := "secret"
-		encrypted, err := Encrypt(key1, plaintext)
+		encrypted, err := Encrypt(key1, plaintext, associatedData)
 		require.NoError(t, err)
 
-		_, err = Decrypt(key2, encrypted)
+		_, err = Decrypt(key2, encrypted, associatedData)
 		require.Error(t, err, "decryption with wrong key should fail")
 		require.Contains(t, err.Error(), "failed to decrypt")
 	})
 
+	t.Run("rejects other associated data", func(t *testing.T) {
+		key, err := GenerateKey()
+		require.NoError(t, err)
+
+		encrypted, err := Encrypt(key, "secret", []byte("file\x00PROD"))
+		require.NoError(t, err)
+
+		_, err = Decrypt(key, encrypted, []byte("file\x00DEV"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt")
+
+		_, err = Decrypt(key, encrypted, nil)
+		require.Error(t, err)
+	})
+
+	t.Run("decrypts legacy values", func(t *testing.T) {
+		key, err := GenerateKey()
+		require.NoError(t, err)
+
+		encrypted := encryptV1(t, key, "secret")
+		decrypted, err := Decrypt(key, encrypted, associatedData)
+		require.NoError(t, err)
+		require.Equal(t, "secret", decrypted)
+	})
+
+	t.Run("rejects truncated value", func(t *testing.T) {
+		key, err := GenerateKey()
+		require.NoError(t, err)
+
+		_, err = Decrypt(key, prefixV2+"dGVzdA==", associatedData)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid encrypted value")
+	})
+
 	t.Run("rejects invalid prefix", func(t *testing.T) {
 		key, err := GenerateKey()
 		require.NoError(t, err)
 
-		_, err = Decrypt(key, "invalid-prefix:data")
+		_, err = Decrypt(key, "invalid-prefix:data", associatedData)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid encryption format")
 	})
@@ -269,16 +378,16 @@ func TestDecrypt(t *testing.T) {
 		key, err := GenerateKey()
 		require.NoError(t, err)
 
-		invalidBase64 := prefix + "not-valid-base64!!!"
-		_, err = Decrypt(key, invalidBase64)
+		invalidBase64 := prefixV2 + "not-valid-base64!!!"
+		_, err = Decrypt(key, invalidBase64, associatedData)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to decode base64")
 	})
 
 	t.Run("rejects invalid key size", func(t *testing.T) {
 		invalidKey := []byte("too-short")
-		encrypted := prefix + "dGVzdC1kYXRhLWhlcmU="
-		_, err := Decrypt(invalidKey, encrypted)
+		encrypted := prefixV2 + "dGVzdC1kYXRhLWhlcmU="
+		_, err := Decrypt(invalidKey, encrypted, associatedData)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "invalid key size")
 	})
@@ -292,7 +401,7 @@ func TestEncryptDecryptIntegration(t *testing.T) {
 		prevEncrypted := ""
 		plaintext := "test-value"
 		for range 10 {
-			encrypted, err := Encrypt(key, plaintext)
+			encrypted, err := Encrypt(key, plaintext, associatedData)
 			require.NoError(t, err)
 			require.NotEqual(
 				t,
@@ -301,7 +410,7 @@ func TestEncryptDecryptIntegration(t *testing.T) {
 				"encrypted value should be different on each cycle",
 			)
 
-			decrypted, err := Decrypt(key, encrypted)
+			decrypted, err := Decrypt(key, encrypted, associatedData)
 			require.NoError(t, err)
 			require.Equal(t, plaintext, decrypted)
 
@@ -309,3 +418,21 @@ func TestEncryptDecryptIntegration(t *testing.T) {
 		}
 	})
 }
+
+// associatedData is authenticated with the values encrypted by tests.
+var associatedData = []byte("file\x00NAME")
+
+// encryptV1 encrypts plaintext in the legacy format, without associated data.
+func encryptV1(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+
+	aead, err := newGCM(key)
+	require.NoError(t, err)
+
+	nonce := make([]byte, NonceSize)
+	_, err = rand.Read(nonce)
+	require.NoError(t, err)
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefixV1 + base64.StdEncoding.EncodeToString(sealed)
+}
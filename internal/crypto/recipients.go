@@ -0,0 +1,206 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// IdentityPrefix starts the encoding of an identity, the X25519 private
+	// key that unwraps data keys.
+	IdentityPrefix = "apiki-identity:"
+
+	// RecipientPrefix starts the encoding of a recipient, the X25519 public
+	// key that data keys are wrapped for.
+	RecipientPrefix = "apiki-recipient:"
+
+	// wrapInfo binds keys derived to wrap data keys to their use
+	wrapInfo = "apiki key wrap v1"
+)
+
+// ErrNotRecipient is returned by UnwrapKey when a key wasn't wrapped for the
+// identity.
+var ErrNotRecipient = errors.New("key was not wrapped for this identity")
+
+// GenerateIdentity generates a random X25519 key pair. Returns the encoded
+// identity, to keep private, and the matching recipient, to share.
+func GenerateIdentity() (identity string, recipient string, err error) {
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate identity: %w", err)
+	}
+	return encodeKey(IdentityPrefix, private.Bytes()),
+		encodeKey(RecipientPrefix, private.PublicKey().Bytes()),
+		nil
+}
+
+// RecipientOf returns the recipient matching an encoded identity.
+func RecipientOf(identity string) (string, error) {
+	private, err := parseIdentity(identity)
+	if err != nil {
+		return "", err
+	}
+	return encodeKey(RecipientPrefix, private.PublicKey().Bytes()), nil
+}
+
+// ParseRecipient checks an encoded recipient, and returns it without
+// surrounding spaces.
+func ParseRecipient(recipient string) (string, error) {
+	recipient = strings.TrimSpace(recipient)
+	if _, err := parseRecipient(recipient); err != nil {
+		return "", err
+	}
+	return recipient, nil
+}
+
+// WrapKey encrypts a data key for a recipient. The key is sealed with
+// AES-256-GCM under a key derived with HKDF-SHA256 from an X25519 exchange
+// between a new ephemeral key and the recipient. Returns
+// base64(ephemeral public key||nonce||wrapped key||tag).
+func WrapKey(key []byte, recipient string) (string, error) {
+	if len(key) != KeySize {
+		return "", errors.New("invalid key size")
+	}
+	public, err := parseRecipient(recipient)
+	if err != nil {
+		return "", err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate ephemeral key: %w", err)
+	}
+	shared, err := ephemeral.ECDH(public)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange keys: %w", err)
+	}
+
+	ephemeralPublic := ephemeral.PublicKey().Bytes()
+	aead, err := wrapCipher(shared, ephemeralPublic, public.Bytes())
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, NonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	data := append(ephemeralPublic, nonce...)
+	data = aead.Seal(data, nonce, key, nil)
+	return base64.StdEncoding.EncodeToString(data), nil
+}
+
+// UnwrapKey decrypts a data key wrapped by WrapKey with the matching identity.
+// Returns ErrNotRecipient if the key was wrapped for another recipient.
+func UnwrapKey(wrapped string, identity string) ([]byte, error) {
+	private, err := parseIdentity(identity)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode base64: %w", err)
+	}
+	if len(data) != 32+NonceSize+KeySize+TagSize {
+		return nil, errors.New("invalid wrapped key")
+	}
+
+	ephemeralPublic := data[:32]
+	nonce := data[32 : 32+NonceSize]
+	sealed := data[32+NonceSize:]
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(ephemeralPublic)
+	if err != nil {
+		return nil, fmt.Errorf("invalid wrapped key: %w", err)
+	}
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to exchange keys: %w", err)
+	}
+
+	aead, err := wrapCipher(
+		shared,
+		ephemeralPublic,
+		private.PublicKey().Bytes(),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := aead.Open(nil, nonce, sealed, nil)
+	if err != nil {
+		return nil, ErrNotRecipient
+	}
+	return key, nil
+}
+
+// wrapCipher returns the AES-256-GCM cipher wrapping a data key, keyed from
+// the X25519 shared secret and both public keys.
+func wrapCipher(shared, ephemeral, recipient []byte) (cipher.AEAD, error) {
+	salt := bytes.Join([][]byte{ephemeral, recipient}, nil)
+	wrapKey, err := hkdf.Key(sha256.New, shared, salt, wrapInfo, KeySize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive key: %w", err)
+	}
+
+	block, err := aes.NewCipher(wrapKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// encodeKey encodes a raw key with a prefix.
+func encodeKey(prefix string, key []byte) string {
+	return prefix + base64.RawURLEncoding.EncodeToString(key)
+}
+
+// decodeKey decodes a raw key encoded with a prefix by encodeKey.
+func decodeKey(prefix string, encoded string) ([]byte, error) {
+	rest, ok := strings.CutPrefix(encoded, prefix)
+	if !ok {
+		return nil, fmt.Errorf("missing %q prefix", prefix)
+	}
+	return base64.RawURLEncoding.DecodeString(rest)
+}
+
+// parseIdentity decodes an identity into an X25519 private key.
+func parseIdentity(identity string) (*ecdh.PrivateKey, error) {
+	data, err := decodeKey(IdentityPrefix, strings.TrimSpace(identity))
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	private, err := ecdh.X25519().NewPrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	return private, nil
+}
+
+// parseRecipient decodes a recipient into an X25519 public key.
+func parseRecipient(recipient string) (*ecdh.PublicKey, error) {
+	data, err := decodeKey(RecipientPrefix, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	public, err := ecdh.X25519().NewPublicKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid recipient: %w", err)
+	}
+	return public, nil
+}
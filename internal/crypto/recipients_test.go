@@ -0,0 +1,111 @@
+package crypto
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerateIdentity(t *testing.T) {
+	t.Run("generates matching keys", func(t *testing.T) {
+		identity, recipient, err := GenerateIdentity()
+		require.NoError(t, err)
+		require.True(t, strings.HasPrefix(identity, IdentityPrefix))
+		require.True(t, strings.HasPrefix(recipient, RecipientPrefix))
+
+		derived, err := RecipientOf(identity)
+		require.NoError(t, err)
+		require.Equal(t, recipient, derived)
+	})
+
+	t.Run("generates unique identities", func(t *testing.T) {
+		identity1, _, err := GenerateIdentity()
+		require.NoError(t, err)
+		identity2, _, err := GenerateIdentity()
+		require.NoError(t, err)
+		require.NotEqual(t, identity1, identity2)
+	})
+}
+
+func TestParseRecipient(t *testing.T) {
+	_, recipient, err := GenerateIdentity()
+	require.NoError(t, err)
+
+	t.Run("trims spaces", func(t *testing.T) {
+		parsed, err := ParseRecipient(" " + recipient + "\n")
+		require.NoError(t, err)
+		require.Equal(t, recipient, parsed)
+	})
+
+	t.Run("rejects missing prefix", func(t *testing.T) {
+		_, err := ParseRecipient(strings.TrimPrefix(recipient, RecipientPrefix))
+		require.Error(t, err)
+	})
+
+	t.Run("rejects invalid key", func(t *testing.T) {
+		_, err := ParseRecipient(RecipientPrefix + "AAAA")
+		require.Error(t, err)
+	})
+
+	t.Run("rejects identity", func(t *testing.T) {
+		identity, _, err := GenerateIdentity()
+		require.NoError(t, err)
+		_, err = ParseRecipient(identity)
+		require.Error(t, err)
+	})
+}
+
+func TestWrapKey(t *testing.T) {
+	key, err := GenerateKey()
+	require.NoError(t, err)
+	identity, recipient, err := GenerateIdentity()
+	require.NoError(t, err)
+
+	t.Run("unwraps with identity", func(t *testing.T) {
+		wrapped, err := WrapKey(key, recipient)
+		require.NoError(t, err)
+
+		unwrapped, err := UnwrapKey(wrapped, identity)
+		require.NoError(t, err)
+		require.Equal(t, key, unwrapped)
+	})
+
+	t.Run("wraps differently each time", func(t *testing.T) {
+		wrapped1, err := WrapKey(key, recipient)
+		require.NoError(t, err)
+		wrapped2, err := WrapKey(key, recipient)
+		require.NoError(t, err)
+		require.NotEqual(t, wrapped1, wrapped2)
+	})
+
+	t.Run("fails with other identity", func(t *testing.T) {
+		wrapped, err := WrapKey(key, recipient)
+		require.NoError(t, err)
+
+		other, _, err := GenerateIdentity()
+		require.NoError(t, err)
+		_, err = UnwrapKey(wrapped, other)
+		require.ErrorIs(t, err, ErrNotRecipient)
+	})
+
+	t.Run("fails with tampered key", func(t *testing.T) {
+		wrapped, err := WrapKey(key, recipient)
+		require.NoError(t, err)
+
+		tampered := []byte(wrapped)
+		tampered[50] ^= 1
+		_, err = UnwrapKey(string(tampered), identity)
+		require.Error(t, err)
+	})
+
+	t.Run("rejects invalid key size", func(t *testing.T) {
+		_, err := WrapKey([]byte("short"), recipient)
+		require.Error(t, err)
+	})
+
+	t.Run("rejects invalid recipient", func(t *testing.T) {
+		_, err := WrapKey(key, "not a recipient")
+		require.Error(t, err)
+	})
+}
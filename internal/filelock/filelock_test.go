@@ -0,0 +1,67 @@
+package filelock
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTryAcquire(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.json")
+	b := filepath.Join(dir, "b.json")
+
+	lock, err := TryAcquire(a, b)
+	require.NoError(t, err)
+
+	t.Run("fails while locked", func(t *testing.T) {
+		_, err := TryAcquire(b)
+		require.ErrorIs(t, err, ErrLocked)
+	})
+
+	t.Run("succeeds once released", func(t *testing.T) {
+		lock.Release()
+		other, err := TryAcquire(b, a)
+		require.NoError(t, err)
+		other.Release()
+	})
+
+	t.Run("creates missing directories", func(t *testing.T) {
+		path := filepath.Join(dir, "new", "c.json")
+		lock, err := TryAcquire(path)
+		require.NoError(t, err)
+		lock.Release()
+		assert.FileExists(t, path+".lock")
+	})
+}
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.json")
+
+	lock, err := Acquire(path)
+	require.NoError(t, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		other, err := Acquire(path)
+		assert.NoError(t, err)
+		close(acquired)
+		other.Release()
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("acquired a held lock")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	lock.Release()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock was not acquired after release")
+	}
+}
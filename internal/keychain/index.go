@@ -0,0 +1,69 @@
+package keychain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+
+	"github.com/loderunner/apiki/internal/atomicfile"
+)
+
+var fs = afero.NewOsFs()
+
+// Index records the keychain items created by apiki, since the OS keychain
+// can't list them. Each item is recorded with the absolute path of the
+// variables file it was created for, so that items of files that were
+// deleted or don't use them anymore can be found.
+type Index struct {
+	Items map[string]string `json:"items,omitempty"`
+}
+
+// LoadIndex reads the index from disk. Returns an empty index if the file
+// doesn't exist.
+func LoadIndex(path string) (*Index, error) {
+	index := &Index{Items: make(map[string]string)}
+
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, afero.ErrFileNotFound) {
+			return index, nil
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return index, nil
+	}
+
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	if index.Items == nil {
+		index.Items = make(map[string]string)
+	}
+
+	return index, nil
+}
+
+// SaveIndex serializes the index and writes it to disk atomically.
+func SaveIndex(path string, index *Index) error {
+	dir := filepath.Dir(path)
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(fs, path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
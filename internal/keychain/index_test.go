@@ -0,0 +1,46 @@
+package keychain
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadIndex(t *testing.T) {
+	t.Run("returns empty index when file does not exist", func(t *testing.T) {
+		index, err := LoadIndex("/nonexistent/keychain.json")
+		require.NoError(t, err)
+		require.Empty(t, index.Items)
+	})
+
+	t.Run("round-trips through SaveIndex", func(t *testing.T) {
+		path := "/test/keychain.json"
+		index := &Index{
+			Items: map[string]string{
+				"encryption-key-1": "/home/user/.apiki/variables.json",
+				"encryption-key-2": "/home/user/work.json",
+			},
+		}
+		require.NoError(t, SaveIndex(path, index))
+
+		loaded, err := LoadIndex(path)
+		require.NoError(t, err)
+		require.Equal(t, index, loaded)
+
+		info, err := fs.Stat(path)
+		require.NoError(t, err)
+		require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+	})
+
+	t.Run("returns error for invalid JSON", func(t *testing.T) {
+		path := "/test/invalid.json"
+		err := afero.WriteFile(fs, path, []byte("{invalid json}"), 0o600)
+		require.NoError(t, err)
+
+		_, err = LoadIndex(path)
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "failed to parse JSON")
+	})
+}
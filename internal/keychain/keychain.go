@@ -1,21 +1,34 @@
 package keychain
 
 import (
+	"crypto/rand"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 
 	"github.com/zalando/go-keyring"
 )
 
-const (
-	serviceName = "apiki"
-	accountName = "encryption-key"
-)
+const serviceName = "apiki"
+
+// LegacyAccount is the account of the keychain item shared by every file
+// encrypted in keychain mode by older versions.
+const LegacyAccount = "encryption-key"
 
-// Store stores a 32-byte encryption key in the OS keychain.
+// NewAccount returns a new random account name, identifying the keychain item
+// of a single file.
+func NewAccount() string {
+	b := make([]byte, 8)
+	_, _ = rand.Read(b) // never fails
+	return LegacyAccount + "-" + hex.EncodeToString(b)
+}
+
+// Store stores a 32-byte encryption key in the OS keychain, in the item of
+// account.
 // On macOS, this uses the macOS Keychain API.
 // On Linux, this uses D-Bus Secret Service (GNOME Keyring/KWallet).
-func Store(key []byte) error {
+func Store(account string, key []byte) error {
 	if len(key) != 32 {
 		return fmt.Errorf(
 			"invalid key size: expected 32 bytes, got %d",
@@ -24,18 +37,19 @@ func Store(key []byte) error {
 	}
 
 	encoded := base64.StdEncoding.EncodeToString(key)
-	if err := keyring.Set(serviceName, accountName, encoded); err != nil {
+	if err := keyring.Set(serviceName, account, encoded); err != nil {
 		return fmt.Errorf("failed to store key in keychain: %w", err)
 	}
 
 	return nil
 }
 
-// Retrieve retrieves the encryption key from the OS keychain.
+// Retrieve retrieves the encryption key from the item of account in the OS
+// keychain.
 // On macOS, this uses the macOS Keychain API.
 // On Linux, this uses D-Bus Secret Service.
-func Retrieve() ([]byte, error) {
-	encoded, err := keyring.Get(serviceName, accountName)
+func Retrieve(account string) ([]byte, error) {
+	encoded, err := keyring.Get(serviceName, account)
 	if err != nil {
 		return nil, fmt.Errorf("failed to retrieve key from keychain: %w", err)
 	}
@@ -55,9 +69,22 @@ func Retrieve() ([]byte, error) {
 	return key, nil
 }
 
-// Delete removes the encryption key from the OS keychain.
-func Delete() error {
-	err := keyring.Delete(serviceName, accountName)
+// Exists reports whether the OS keychain holds the item of account.
+func Exists(account string) (bool, error) {
+	_, err := keyring.Get(serviceName, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to read keychain item: %w", err)
+	}
+	return true, nil
+}
+
+// Delete removes the item of account from the OS keychain. A missing item is
+// not an error.
+func Delete(account string) error {
+	err := keyring.Delete(serviceName, account)
 	if err != nil && err != keyring.ErrNotFound {
 		return fmt.Errorf("failed to delete keychain item: %w", err)
 	}
@@ -0,0 +1,83 @@
+package keychain
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando/go-keyring"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory filesystem and keychain for testing
+	fs = afero.NewMemMapFs()
+	keyring.MockInit()
+	os.Exit(m.Run())
+}
+
+func TestNewAccount(t *testing.T) {
+	account := NewAccount()
+	require.True(t, strings.HasPrefix(account, LegacyAccount+"-"))
+	require.NotEqual(t, LegacyAccount, account)
+	require.NotEqual(t, account, NewAccount())
+}
+
+func TestStore(t *testing.T) {
+	t.Run("keeps a separate item per account", func(t *testing.T) {
+		key1 := []byte("0123456789abcdef0123456789abcdef")
+		key2 := []byte("fedcba9876543210fedcba9876543210")
+		account1 := NewAccount()
+		account2 := NewAccount()
+
+		require.NoError(t, Store(account1, key1))
+		require.NoError(t, Store(account2, key2))
+
+		got, err := Retrieve(account1)
+		require.NoError(t, err)
+		require.Equal(t, key1, got)
+		got, err = Retrieve(account2)
+		require.NoError(t, err)
+		require.Equal(t, key2, got)
+	})
+
+	t.Run("rejects invalid key size", func(t *testing.T) {
+		err := Store(NewAccount(), []byte("short"))
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "invalid key size")
+	})
+}
+
+func TestDelete(t *testing.T) {
+	t.Run("deletes only the item of account", func(t *testing.T) {
+		key := []byte("0123456789abcdef0123456789abcdef")
+		account1 := NewAccount()
+		account2 := NewAccount()
+		require.NoError(t, Store(account1, key))
+		require.NoError(t, Store(account2, key))
+
+		require.NoError(t, Delete(account1))
+
+		_, err := Retrieve(account1)
+		require.Error(t, err)
+		_, err = Retrieve(account2)
+		require.NoError(t, err)
+	})
+
+	t.Run("ignores missing item", func(t *testing.T) {
+		require.NoError(t, Delete(NewAccount()))
+	})
+}
+
+func TestExists(t *testing.T) {
+	account := NewAccount()
+	exists, err := Exists(account)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	require.NoError(t, Store(account, make([]byte, 32)))
+	exists, err = Exists(account)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
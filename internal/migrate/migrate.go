@@ -0,0 +1,152 @@
+package migrate
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/afero"
+
+	"github.com/loderunner/apiki/internal/atomicfile"
+)
+
+// ErrTooNew is returned for documents written by a newer version of apiki.
+var ErrTooNew = errors.New("file was written by a newer version of apiki")
+
+// Migration upgrades a document by one version. It works on the raw JSON
+// object, so that it doesn't depend on the current types.
+type Migration func(doc map[string]any) error
+
+// Apply upgrades doc to the latest version, running in order the migrations
+// that follow its version. migrations[i] upgrades version i to i+1, so the
+// latest version is len(migrations). Documents without a version field are
+// version 0. Returns the version doc had before migration.
+func Apply(doc map[string]any, migrations []Migration) (int, error) {
+	version, err := Version(doc)
+	if err != nil {
+		return 0, err
+	}
+
+	latest := len(migrations)
+	if version > latest {
+		return version, fmt.Errorf(
+			"%w: version %d, this version of apiki supports up to %d, "+
+				"upgrade apiki to use it",
+			ErrTooNew,
+			version,
+			latest,
+		)
+	}
+
+	for v := version; v < latest; v++ {
+		if err := migrations[v](doc); err != nil {
+			return version, fmt.Errorf(
+				"failed to migrate from version %d to %d: %w",
+				v,
+				v+1,
+				err,
+			)
+		}
+		doc["version"] = v + 1
+	}
+
+	return version, nil
+}
+
+// Upgrade migrates the JSON document data, read from path, to the latest
+// version. Before migrating, a backup of data is written atomically next to
+// path, named after its version, e.g. "variables.json.v0.bak". Existing
+// backups are never overwritten. Returns the migrated document and true if it
+// was migrated, or data unchanged and false if it was already at the latest
+// version.
+func Upgrade(
+	fs afero.Fs,
+	path string,
+	data []byte,
+	migrations []Migration,
+) ([]byte, bool, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, false, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+
+	version, err := Version(doc)
+	if err != nil {
+		return nil, false, err
+	}
+	if version == len(migrations) {
+		return data, false, nil
+	}
+
+	// Check the version before writing a backup
+	if version < len(migrations) {
+		backup, err := backupPath(fs, path, version, data)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to write backup: %w", err)
+		}
+		if backup != "" {
+			err := atomicfile.WriteFile(fs, backup, data, 0o600)
+			if err != nil {
+				return nil, false, fmt.Errorf("failed to write backup: %w", err)
+			}
+		}
+	}
+
+	if _, err := Apply(doc, migrations); err != nil {
+		return nil, false, err
+	}
+
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+	return migrated, true, nil
+}
+
+// backupPath returns the path of a new backup of data, read from path at
+// version: "variables.json.v0.bak", or "variables.json.v0.1.bak" and so on if
+// an earlier backup of the same version is kept. Returns an empty path if a
+// backup already holds data.
+func backupPath(
+	fs afero.Fs,
+	path string,
+	version int,
+	data []byte,
+) (string, error) {
+	for i := 0; ; i++ {
+		backup := fmt.Sprintf("%s.v%d.bak", path, version)
+		if i > 0 {
+			backup = fmt.Sprintf("%s.v%d.%d.bak", path, version, i)
+		}
+
+		existing, err := afero.ReadFile(fs, backup)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			return backup, nil
+		case err != nil:
+			return "", err
+		case bytes.Equal(existing, data):
+			return "", nil
+		}
+	}
+}
+
+// Version returns the version of doc, 0 if it has no version field.
+func Version(doc map[string]any) (int, error) {
+	value, ok := doc["version"]
+	if !ok {
+		return 0, nil
+	}
+
+	// Numbers are decoded as float64
+	number, ok := value.(float64)
+	if !ok || number < 0 || number != float64(int(number)) {
+		return 0, fmt.Errorf("invalid version: %v", value)
+	}
+	return int(number), nil
+}
@@ -0,0 +1,184 @@
+package migrate
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/require"
+)
+
+func decode(t *testing.T, s string) map[string]any {
+	t.Helper()
+	var doc map[string]any
+	require.NoError(t, json.Unmarshal([]byte(s), &doc))
+	return doc
+}
+
+func TestApply(t *testing.T) {
+	var ran []int
+	migrations := []Migration{
+		func(doc map[string]any) error {
+			ran = append(ran, 0)
+			doc["first"] = true
+			return nil
+		},
+		func(doc map[string]any) error {
+			ran = append(ran, 1)
+			return nil
+		},
+	}
+
+	t.Run("migrates documents without version", func(t *testing.T) {
+		ran = nil
+		doc := decode(t, `{}`)
+		version, err := Apply(doc, migrations)
+		require.NoError(t, err)
+		require.Equal(t, 0, version)
+		require.Equal(t, []int{0, 1}, ran)
+		require.Equal(t, 2, doc["version"])
+		require.Equal(t, true, doc["first"])
+	})
+
+	t.Run("runs the following migrations only", func(t *testing.T) {
+		ran = nil
+		doc := decode(t, `{"version": 1}`)
+		version, err := Apply(doc, migrations)
+		require.NoError(t, err)
+		require.Equal(t, 1, version)
+		require.Equal(t, []int{1}, ran)
+	})
+
+	t.Run("keeps existing backups", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		earlier := []byte(`{"entries": [{"name": "EARLIER"}]}`)
+		err := afero.WriteFile(fs, "/a.json.v0.bak", earlier, 0o600)
+		require.NoError(t, err)
+
+		data := []byte(`{"entries": []}`)
+		_, _, err = Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+
+		backup, err := afero.ReadFile(fs, "/a.json.v0.bak")
+		require.NoError(t, err)
+		require.Equal(t, earlier, backup)
+		backup, err = afero.ReadFile(fs, "/a.json.v0.1.bak")
+		require.NoError(t, err)
+		require.Equal(t, data, backup)
+
+		// The same document is not backed up twice
+		_, _, err = Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+		exists, err := afero.Exists(fs, "/a.json.v0.2.bak")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("leaves latest documents unchanged", func(t *testing.T) {
+		ran = nil
+		doc := decode(t, `{"version": 2}`)
+		version, err := Apply(doc, migrations)
+		require.NoError(t, err)
+		require.Equal(t, 2, version)
+		require.Empty(t, ran)
+	})
+
+	t.Run("refuses newer documents", func(t *testing.T) {
+		doc := decode(t, `{"version": 3}`)
+		_, err := Apply(doc, migrations)
+		require.ErrorIs(t, err, ErrTooNew)
+	})
+
+	t.Run("reports failed migrations", func(t *testing.T) {
+		failing := []Migration{func(map[string]any) error {
+			return errors.New("boom")
+		}}
+		_, err := Apply(decode(t, `{}`), failing)
+		require.ErrorContains(t, err, "boom")
+	})
+
+	t.Run("rejects invalid versions", func(t *testing.T) {
+		for _, s := range []string{`{"version": "1"}`, `{"version": 1.5}`} {
+			_, err := Apply(decode(t, s), migrations)
+			require.Error(t, err)
+		}
+	})
+}
+
+func TestUpgrade(t *testing.T) {
+	migrations := []Migration{func(doc map[string]any) error {
+		doc["migrated"] = true
+		return nil
+	}}
+
+	t.Run("writes a backup before migrating", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		data := []byte(`{"entries": []}`)
+		migrated, changed, err := Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+		require.True(t, changed)
+		require.JSONEq(
+			t,
+			`{"entries": [], "migrated": true, "version": 1}`,
+			string(migrated),
+		)
+
+		backup, err := afero.ReadFile(fs, "/a.json.v0.bak")
+		require.NoError(t, err)
+		require.Equal(t, data, backup)
+	})
+
+	t.Run("keeps existing backups", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		earlier := []byte(`{"entries": [{"name": "EARLIER"}]}`)
+		err := afero.WriteFile(fs, "/a.json.v0.bak", earlier, 0o600)
+		require.NoError(t, err)
+
+		data := []byte(`{"entries": []}`)
+		_, _, err = Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+
+		backup, err := afero.ReadFile(fs, "/a.json.v0.bak")
+		require.NoError(t, err)
+		require.Equal(t, earlier, backup)
+		backup, err = afero.ReadFile(fs, "/a.json.v0.1.bak")
+		require.NoError(t, err)
+		require.Equal(t, data, backup)
+
+		// The same document is not backed up twice
+		_, _, err = Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+		exists, err := afero.Exists(fs, "/a.json.v0.2.bak")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("leaves latest documents unchanged", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		data := []byte(`{"version": 1}`)
+		migrated, changed, err := Upgrade(fs, "/a.json", data, migrations)
+		require.NoError(t, err)
+		require.False(t, changed)
+		require.Equal(t, data, migrated)
+
+		exists, err := afero.Exists(fs, "/a.json.v1.bak")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+
+	t.Run("refuses newer documents without backup", func(t *testing.T) {
+		fs := afero.NewMemMapFs()
+		_, _, err := Upgrade(
+			fs,
+			"/a.json",
+			[]byte(`{"version": 2}`),
+			migrations,
+		)
+		require.ErrorIs(t, err, ErrTooNew)
+
+		exists, err := afero.Exists(fs, "/a.json.v2.bak")
+		require.NoError(t, err)
+		require.False(t, exists)
+	})
+}
@@ -0,0 +1,166 @@
+package shell
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Shell names accepted by New. Aliases are listed in New.
+const (
+	Posix   = "posix"
+	Fish    = "fish"
+	Nushell = "nu"
+	Pwsh    = "pwsh"
+)
+
+// Emitter produces shell commands that set and unset environment variables
+// in the syntax of a given shell.
+type Emitter interface {
+	// Export returns a command that sets the variable name to value.
+	Export(name, value string) string
+
+	// Unset returns a command that removes the variable name from the
+	// environment.
+	Unset(name string) string
+
+	// Quote returns value as a string literal that the shell reads back
+	// unchanged.
+	Quote(value string) string
+}
+
+// New returns the emitter for the named shell.
+func New(name string) (Emitter, error) {
+	switch strings.ToLower(name) {
+	case Posix, "sh", "bash", "zsh":
+		return PosixEmitter{}, nil
+	case Fish:
+		return FishEmitter{}, nil
+	case Nushell, "nushell":
+		return NushellEmitter{}, nil
+	case Pwsh, "powershell":
+		return PwshEmitter{}, nil
+	}
+	return nil, fmt.Errorf("unsupported shell: %q", name)
+}
+
+// Resolve returns the emitter for the named shell. If name is empty, the
+// APIKI_SHELL environment variable is used, then POSIX syntax.
+func Resolve(name string) (Emitter, error) {
+	if name == "" {
+		name = os.Getenv("APIKI_SHELL")
+	}
+	if name == "" {
+		name = Posix
+	}
+	return New(name)
+}
+
+// PosixEmitter emits commands for POSIX shells (sh, bash, zsh).
+type PosixEmitter struct{}
+
+// Export implements Emitter.
+func (e PosixEmitter) Export(name, value string) string {
+	return fmt.Sprintf("export %s=%s", name, e.Quote(value))
+}
+
+// Unset implements Emitter.
+func (PosixEmitter) Unset(name string) string {
+	return "unset " + name
+}
+
+// Quote implements Emitter.
+func (PosixEmitter) Quote(value string) string {
+	return "'" + strings.ReplaceAll(value, "'", `'\''`) + "'"
+}
+
+// FishEmitter emits commands for fish.
+type FishEmitter struct{}
+
+// Export implements Emitter.
+func (e FishEmitter) Export(name, value string) string {
+	return fmt.Sprintf("set -gx %s %s", name, e.Quote(value))
+}
+
+// Unset implements Emitter.
+func (FishEmitter) Unset(name string) string {
+	return "set -e " + name
+}
+
+// Quote implements Emitter.
+func (FishEmitter) Quote(value string) string {
+	// Only backslash and single quote are special in single quotes
+	escaped := strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + escaped + "'"
+}
+
+// NushellEmitter emits commands for nushell.
+type NushellEmitter struct{}
+
+// Export implements Emitter.
+func (e NushellEmitter) Export(name, value string) string {
+	return fmt.Sprintf("$env.%s = %s", name, e.Quote(value))
+}
+
+// Unset implements Emitter.
+func (NushellEmitter) Unset(name string) string {
+	return "hide-env -i " + name
+}
+
+// Quote implements Emitter.
+func (NushellEmitter) Quote(value string) string {
+	// Single-quoted strings can't contain single quotes, use double quotes
+	// with escapes instead
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '\\':
+			b.WriteString(`\\`)
+		case '"':
+			b.WriteString(`\"`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u{%x}`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return `"` + b.String() + `"`
+}
+
+// PwshEmitter emits commands for PowerShell.
+type PwshEmitter struct{}
+
+// Export implements Emitter.
+func (e PwshEmitter) Export(name, value string) string {
+	return fmt.Sprintf("$env:%s = %s", name, e.Quote(value))
+}
+
+// Unset implements Emitter.
+func (PwshEmitter) Unset(name string) string {
+	return fmt.Sprintf(
+		"Remove-Item Env:%s -ErrorAction SilentlyContinue",
+		name,
+	)
+}
+
+// Quote implements Emitter.
+func (PwshEmitter) Quote(value string) string {
+	// PowerShell treats typographic single quotes as quote characters too,
+	// all of them are escaped by doubling
+	escaped := strings.NewReplacer(
+		"'", "''",
+		"‘", "‘‘",
+		"’", "’’",
+		"‚", "‚‚",
+		"‛", "‛‛",
+	).Replace(value)
+	return "'" + escaped + "'"
+}
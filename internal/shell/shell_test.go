@@ -0,0 +1,184 @@
+package shell
+
+import (
+	"os/exec"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("returns emitter for known shells and aliases", func(t *testing.T) {
+		cases := map[string]Emitter{
+			"posix":      PosixEmitter{},
+			"sh":         PosixEmitter{},
+			"bash":       PosixEmitter{},
+			"zsh":        PosixEmitter{},
+			"fish":       FishEmitter{},
+			"nu":         NushellEmitter{},
+			"nushell":    NushellEmitter{},
+			"pwsh":       PwshEmitter{},
+			"PowerShell": PwshEmitter{},
+		}
+		for name, expected := range cases {
+			emitter, err := New(name)
+			require.NoError(t, err, name)
+			assert.IsType(t, expected, emitter, name)
+		}
+	})
+
+	t.Run("returns error for unknown shell", func(t *testing.T) {
+		_, err := New("tcsh")
+		require.ErrorContains(t, err, "unsupported shell")
+	})
+}
+
+func TestResolve(t *testing.T) {
+	t.Run("prefers name over environment", func(t *testing.T) {
+		t.Setenv("APIKI_SHELL", "fish")
+		emitter, err := Resolve("pwsh")
+		require.NoError(t, err)
+		require.IsType(t, PwshEmitter{}, emitter)
+	})
+
+	t.Run("falls back to environment", func(t *testing.T) {
+		t.Setenv("APIKI_SHELL", "fish")
+		emitter, err := Resolve("")
+		require.NoError(t, err)
+		require.IsType(t, FishEmitter{}, emitter)
+	})
+
+	t.Run("defaults to posix", func(t *testing.T) {
+		t.Setenv("APIKI_SHELL", "")
+		emitter, err := Resolve("")
+		require.NoError(t, err)
+		require.IsType(t, PosixEmitter{}, emitter)
+	})
+}
+
+func TestPosixEmitter(t *testing.T) {
+	t.Run("quotes values", func(t *testing.T) {
+		assert.Equal(
+			t,
+			`export VAR='it'\''s $HOME'`,
+			PosixEmitter{}.Export("VAR", "it's $HOME"),
+		)
+		assert.Equal(t, "unset VAR", PosixEmitter{}.Unset("VAR"))
+		assert.Equal(
+			t,
+			`'/opt/my apps/apiki'`,
+			PosixEmitter{}.Quote("/opt/my apps/apiki"),
+		)
+	})
+
+	t.Run("round-trips through sh", func(t *testing.T) {
+		sh, err := exec.LookPath("sh")
+		if err != nil {
+			t.Skip("sh not available")
+		}
+
+		values := []string{
+			"simple",
+			"it's",
+			`"double" \back\slash`,
+			"$HOME `id` $(id)",
+			"multi\nline\r\n",
+			"\x1b[31mcontrol\x07",
+			"‘typographic’",
+		}
+		for _, value := range values {
+			script := PosixEmitter{}.Export("VAR", value) +
+				"\nprintf '%s' \"$VAR\""
+			output, err := exec.Command(sh, "-c", script).Output()
+			require.NoError(t, err, value)
+			assert.Equal(t, value, string(output))
+		}
+	})
+}
+
+func TestFishEmitter(t *testing.T) {
+	assert.Equal(
+		t,
+		`set -gx VAR 'it\'s \\ $HOME'`,
+		FishEmitter{}.Export("VAR", `it's \ $HOME`),
+	)
+	assert.Equal(t, "set -e VAR", FishEmitter{}.Unset("VAR"))
+	assert.Equal(t, `'a b'`, FishEmitter{}.Quote("a b"))
+}
+
+func TestNushellEmitter(t *testing.T) {
+	assert.Equal(
+		t,
+		`$env.VAR = "it's \"x\" \\ $HOME\n\t\u{1b}"`,
+		NushellEmitter{}.Export("VAR", "it's \"x\" \\ $HOME\n\t\x1b"),
+	)
+	assert.Equal(t, "hide-env -i VAR", NushellEmitter{}.Unset("VAR"))
+	assert.Equal(t, `"a b"`, NushellEmitter{}.Quote("a b"))
+}
+
+func TestPwshEmitter(t *testing.T) {
+	assert.Equal(
+		t,
+		`$env:VAR = 'it''s ‘‘x’’ $HOME'`,
+		PwshEmitter{}.Export("VAR", "it's ‘x’ $HOME"),
+	)
+	assert.Equal(
+		t,
+		"Remove-Item Env:VAR -ErrorAction SilentlyContinue",
+		PwshEmitter{}.Unset("VAR"),
+	)
+	assert.Equal(t, `'a b'`, PwshEmitter{}.Quote("a b"))
+}
+
+func TestQuote(t *testing.T) {
+	cases := []struct {
+		value    string
+		posix    string
+		fish     string
+		nushell  string
+		pwsh     string
+		testName string
+	}{
+		{
+			testName: "command substitution",
+			value:    "$(id) `id`",
+			posix:    "'$(id) `id`'",
+			fish:     "'$(id) `id`'",
+			nushell:  "\"$(id) `id`\"",
+			pwsh:     "'$(id) `id`'",
+		},
+		{
+			testName: "quote breakout",
+			value:    `'; id; '`,
+			posix:    `''\''; id; '\'''`,
+			fish:     `'\'; id; \''`,
+			nushell:  `"'; id; '"`,
+			pwsh:     `'''; id; '''`,
+		},
+		{
+			testName: "newlines",
+			value:    "a\nid\r\n",
+			posix:    "'a\nid\r\n'",
+			fish:     "'a\nid\r\n'",
+			nushell:  `"a\nid\r\n"`,
+			pwsh:     "'a\nid\r\n'",
+		},
+		{
+			testName: "control characters",
+			value:    "\x1b[2J\x00\x7f",
+			posix:    "'\x1b[2J\x00\x7f'",
+			fish:     "'\x1b[2J\x00\x7f'",
+			nushell:  `"\u{1b}[2J\u{0}\u{7f}"`,
+			pwsh:     "'\x1b[2J\x00\x7f'",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.testName, func(t *testing.T) {
+			assert.Equal(t, c.posix, PosixEmitter{}.Quote(c.value))
+			assert.Equal(t, c.fish, FishEmitter{}.Quote(c.value))
+			assert.Equal(t, c.nushell, NushellEmitter{}.Quote(c.value))
+			assert.Equal(t, c.pwsh, PwshEmitter{}.Quote(c.value))
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package trust
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/afero"
+
+	"github.com/loderunner/apiki/internal/atomicfile"
+)
+
+var fs = afero.NewOsFs()
+
+// Status is the trust status of a file.
+type Status int
+
+const (
+	// StatusUnknown means the file was neither allowed nor denied, or has
+	// changed since.
+	StatusUnknown Status = iota
+
+	// StatusAllowed means the file may be activated.
+	StatusAllowed
+
+	// StatusDenied means the file must never be activated.
+	StatusDenied
+)
+
+// DB records which files may be activated, keyed by absolute path. Each file
+// is recorded with the hash of its content, so that a file that changes after
+// being allowed or denied is unknown again.
+type DB struct {
+	Allowed map[string]string `json:"allowed,omitempty"`
+	Denied  map[string]string `json:"denied,omitempty"`
+}
+
+// Load reads the trust database from disk. Returns an empty database if the
+// file doesn't exist.
+func Load(path string) (*DB, error) {
+	db := &DB{
+		Allowed: make(map[string]string),
+		Denied:  make(map[string]string),
+	}
+
+	data, err := afero.ReadFile(fs, path)
+	if err != nil {
+		if errors.Is(err, afero.ErrFileNotFound) {
+			return db, nil
+		}
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	if len(data) == 0 {
+		return db, nil
+	}
+
+	if err := json.Unmarshal(data, db); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON: %w", err)
+	}
+
+	if db.Allowed == nil {
+		db.Allowed = make(map[string]string)
+	}
+	if db.Denied == nil {
+		db.Denied = make(map[string]string)
+	}
+
+	return db, nil
+}
+
+// Save serializes the trust database and writes it to disk atomically.
+func Save(path string, db *DB) error {
+	dir := filepath.Dir(path)
+	if err := fs.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("failed to create directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(db, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal JSON: %w", err)
+	}
+
+	if err := atomicfile.WriteFile(fs, path, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return nil
+}
+
+// Hash returns the hex-encoded SHA-256 hash of data.
+func Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Allow records the file at path with the given content hash as allowed.
+func (db *DB) Allow(path, hash string) {
+	delete(db.Denied, path)
+	db.Allowed[path] = hash
+}
+
+// Deny records the file at path with the given content hash as denied.
+func (db *DB) Deny(path, hash string) {
+	delete(db.Allowed, path)
+	db.Denied[path] = hash
+}
+
+// Status returns the trust status of the file at path with the given content
+// hash.
+func (db *DB) Status(path, hash string) Status {
+	if h, ok := db.Denied[path]; ok && h == hash {
+		return StatusDenied
+	}
+	if h, ok := db.Allowed[path]; ok && h == hash {
+		return StatusAllowed
+	}
+	return StatusUnknown
+}
@@ -0,0 +1,71 @@
+package trust
+
+import (
+	"os"
+	"testing"
+
+	"github.com/spf13/afero"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	// Use an in-memory filesystem for testing
+	fs = afero.NewMemMapFs()
+	os.Exit(m.Run())
+}
+
+func TestLoad(t *testing.T) {
+	t.Run(
+		"returns empty database when file does not exist",
+		func(t *testing.T) {
+			db, err := Load("/nonexistent/trust.json")
+			require.NoError(t, err)
+			assert.Empty(t, db.Allowed)
+			assert.Empty(t, db.Denied)
+		},
+	)
+
+	t.Run("round-trips through Save", func(t *testing.T) {
+		path := "/test/trust.json"
+		db := &DB{
+			Allowed: map[string]string{"/a/.apiki.json": "h1"},
+			Denied:  map[string]string{"/b/.apiki.json": "h2"},
+		}
+		require.NoError(t, Save(path, db))
+
+		loaded, err := Load(path)
+		require.NoError(t, err)
+		assert.Equal(t, db, loaded)
+	})
+
+	t.Run("returns error for invalid JSON", func(t *testing.T) {
+		path := "/test/invalid.json"
+		err := afero.WriteFile(fs, path, []byte("{invalid"), 0o644)
+		require.NoError(t, err)
+
+		_, err = Load(path)
+		require.ErrorContains(t, err, "failed to parse JSON")
+	})
+}
+
+func TestStatus(t *testing.T) {
+	db, err := Load("/nonexistent/trust.json")
+	require.NoError(t, err)
+
+	path := "/project/.apiki.json"
+	hash := Hash([]byte(`{"use":["A"]}`))
+	assert.Equal(t, StatusUnknown, db.Status(path, hash))
+
+	db.Allow(path, hash)
+	assert.Equal(t, StatusAllowed, db.Status(path, hash))
+
+	t.Run("changed content is unknown", func(t *testing.T) {
+		changed := Hash([]byte(`{"use":["B"]}`))
+		assert.Equal(t, StatusUnknown, db.Status(path, changed))
+	})
+
+	db.Deny(path, hash)
+	assert.Equal(t, StatusDenied, db.Status(path, hash))
+	assert.NotContains(t, db.Allowed, path)
+}
@@ -3,38 +3,74 @@ package main
 import (
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 
+	"github.com/loderunner/apiki/commands"
+	"github.com/loderunner/apiki/commands/agent"
 	"github.com/loderunner/apiki/commands/apiki"
 	"github.com/loderunner/apiki/commands/decrypt"
 	"github.com/loderunner/apiki/commands/encrypt"
+	"github.com/loderunner/apiki/commands/exec"
+	"github.com/loderunner/apiki/commands/export"
+	"github.com/loderunner/apiki/commands/get"
+	"github.com/loderunner/apiki/commands/hook"
+	"github.com/loderunner/apiki/commands/importer"
+	"github.com/loderunner/apiki/commands/keychain"
+	"github.com/loderunner/apiki/commands/keygen"
+	"github.com/loderunner/apiki/commands/list"
+	"github.com/loderunner/apiki/commands/permissions"
+	"github.com/loderunner/apiki/commands/profile"
+	"github.com/loderunner/apiki/commands/recipients"
 	"github.com/loderunner/apiki/commands/restore"
+	"github.com/loderunner/apiki/commands/rm"
 	"github.com/loderunner/apiki/commands/rotate"
+	"github.com/loderunner/apiki/commands/set"
+	"github.com/loderunner/apiki/commands/shellinit"
+	"github.com/loderunner/apiki/commands/use"
+	"github.com/loderunner/apiki/internal/entries"
+	"github.com/loderunner/apiki/internal/shell"
 )
 
 var version = "dev"
 
-// variablesFile holds the value of the --variables-file flag.
-var variablesFile string
+// variablesFiles holds the values of the --variables-file flag.
+var variablesFiles []string
+
+// shellName holds the value of the --shell flag.
+var shellName string
+
+// strict holds the value of the --strict flag.
+var strict bool
+
+// identityFile holds the value of the --identity flag.
+var identityFile string
 
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "apiki",
 		Short: "Environment variable manager",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			variablesPath, err := resolveVariablesFile(cmd)
+			variablesPaths, err := resolveVariablesFiles(cmd)
 			if err != nil {
 				return fmt.Errorf("could not resolve variables file: %w", err)
 			}
-			configPath, err := resolveConfigFile(variablesPath)
+			configPath, err := resolveConfigFile(variablesPaths)
 			if err != nil {
 				return fmt.Errorf("could not resolve config file: %w", err)
 			}
-			output, err := apiki.Run(variablesPath, configPath)
+			sh, err := shell.Resolve(shellName)
+			if err != nil {
+				return err
+			}
+			output, err := apiki.Run(variablesPaths, configPath, sh)
 			if err != nil {
 				return err
 			}
@@ -47,12 +83,40 @@ func main() {
 	}
 
 	// Persistent flag available to root and all subcommands
-	rootCmd.PersistentFlags().StringVarP(
-		&variablesFile,
+	rootCmd.PersistentFlags().StringArrayVarP(
+		&variablesFiles,
 		"variables-file", "f",
+		nil,
+		"path to variables file, repeatable to load several (env: APIKI_FILE)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&shellName,
+		"shell",
+		"",
+		"syntax of shell commands: posix, fish, nu or pwsh (env: APIKI_SHELL)",
+	)
+	rootCmd.PersistentFlags().BoolVar(
+		&strict,
+		"strict",
+		false,
+		"refuse variables files that other users can access (env: APIKI_STRICT)",
+	)
+	rootCmd.PersistentFlags().StringVar(
+		&identityFile,
+		"identity",
 		"",
-		"path to variables file (env: APIKI_FILE)",
+		"path to identity file, unlocking files encrypted for recipients "+
+			"(env: APIKI_IDENTITY)",
 	)
+	cobra.OnInitialize(func() {
+		commands.StrictPermissions = resolveStrict()
+		commands.IdentityPath = resolveIdentityFile()
+		commands.AgentSocket = resolveAgentSocket()
+		commands.KeychainIndexPath = resolveKeychainIndex()
+		commands.DefaultVariablesPaths, _ = resolveDefaultVariablesFiles()
+		entries.Unlocker = commands.UnlockOnLoad
+		entries.CopyKeychainKey = commands.CopyKeychainKey
+	})
 
 	// Redirect all Cobra output to stderr to avoid breaking eval
 	rootCmd.SetOut(os.Stderr)
@@ -66,15 +130,17 @@ func main() {
 		},
 	}
 
+	var encryptOpts encrypt.Options
 	encryptCmd := &cobra.Command{
-		Use:   "encrypt",
+		Use:   "encrypt [NAME...]",
 		Short: "Encrypt variable values",
+		Long:  "Encrypt variable values, marking them secret. Without arguments, every variable\nis encrypted. Otherwise, only the variables matching a name, an ID or\nNAME=label are.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			variablesPath, err := resolveVariablesFile(cmd)
+			variablesPath, err := resolveSingleVariablesFile(cmd)
 			if err != nil {
 				return fmt.Errorf("could not resolve variables file: %w", err)
 			}
-			err = encrypt.Run(variablesPath)
+			err = encrypt.Run(variablesPath, args, encryptOpts)
 			if errors.Is(err, encrypt.ErrNoEntries) {
 				cmd.PrintErrln(err.Error())
 				return nil
@@ -83,15 +149,32 @@ func main() {
 		},
 	}
 
+	encryptCmd.Flags().DurationVar(
+		&encryptOpts.Calibrate,
+		"calibrate",
+		0,
+		"tune the password key derivation to take this long to unlock "+
+			"on this machine",
+	)
+	encryptCmd.Flags().Lookup("calibrate").NoOptDefVal = "1s"
+	encryptCmd.Flags().BoolVar(
+		&encryptOpts.FullFile,
+		"full-file",
+		false,
+		"encrypt the whole file, hiding the names and labels of variables",
+	)
+
+	var decryptOpts decrypt.Options
 	decryptCmd := &cobra.Command{
-		Use:   "decrypt",
+		Use:   "decrypt [NAME...]",
 		Short: "Decrypt variable values",
+		Long:  "Decrypt variable values. Without arguments, every variable is decrypted and\nencryption is removed from the file. Otherwise, only the variables matching\na name, an ID or NAME=label stop being secret.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			variablesPath, err := resolveVariablesFile(cmd)
+			variablesPath, err := resolveSingleVariablesFile(cmd)
 			if err != nil {
 				return fmt.Errorf("could not resolve variables file: %w", err)
 			}
-			err = decrypt.Run(variablesPath)
+			err = decrypt.Run(variablesPath, args, decryptOpts)
 			if errors.Is(err, decrypt.ErrNoEntries) {
 				cmd.PrintErrln(err.Error())
 				return nil
@@ -100,15 +183,24 @@ func main() {
 		},
 	}
 
+	decryptCmd.Flags().BoolVar(
+		&decryptOpts.FullFile,
+		"full-file",
+		false,
+		"only decrypt names and labels, secret values stay encrypted",
+	)
+
+	var rotateOpts rotate.Options
 	rotateCmd := &cobra.Command{
 		Use:   "rotate",
 		Short: "Rotate encryption key",
+		Long:  "Rotate the encryption key, choosing a new encryption mode. A new password is\nderived with the key derivation parameters of the file, which --kdf-memory and\n--kdf-iterations change.",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			variablesPath, err := resolveVariablesFile(cmd)
+			variablesPath, err := resolveSingleVariablesFile(cmd)
 			if err != nil {
 				return fmt.Errorf("could not resolve variables file: %w", err)
 			}
-			err = rotate.Run(variablesPath)
+			err = rotate.Run(variablesPath, rotateOpts)
 			if errors.Is(err, rotate.ErrNoEntries) {
 				cmd.PrintErrln(err.Error())
 				return nil
@@ -117,19 +209,445 @@ func main() {
 		},
 	}
 
+	rotateCmd.Flags().Uint32Var(
+		&rotateOpts.KDFMemory,
+		"kdf-memory",
+		0,
+		"memory used by the password key derivation, in MiB",
+	)
+	rotateCmd.Flags().Uint32Var(
+		&rotateOpts.KDFIterations,
+		"kdf-iterations",
+		0,
+		"iterations of the password key derivation",
+	)
+
 	restoreCmd := &cobra.Command{
 		Use:   "restore",
 		Short: "Restore selected variables from previous session",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			variablesPath, err := resolveVariablesFile(cmd)
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			sh, err := shell.Resolve(shellName)
+			if err != nil {
+				return err
+			}
+			output, err := restore.Run(variablesPaths, configPath, sh)
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+
+	var listOpts list.Options
+	listCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List variables without launching the interface",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			output, err := list.Run(variablesPaths, configPath, listOpts)
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+	listCmd.Flags().StringVar(
+		&listOpts.Format,
+		"format",
+		list.FormatTable,
+		"output format: table, json or names",
+	)
+	listCmd.Flags().BoolVar(
+		&listOpts.ShowValues,
+		"show-values",
+		false,
+		"include values in the output (unlocks encrypted files)",
+	)
+	listCmd.Flags().StringArrayVar(
+		&listOpts.Tags,
+		"tag",
+		nil,
+		"only list variables with this tag (repeatable)",
+	)
+
+	var getOpts get.Options
+	getCmd := &cobra.Command{
+		Use:          "get NAME",
+		Short:        "Print the value of a single variable",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			output, err := get.Run(variablesPaths, args[0], getOpts)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprint(os.Stdout, output)
+			return err
+		},
+	}
+	getCmd.Flags().StringVar(
+		&getOpts.Label,
+		"label",
+		"",
+		"label of the variable, to choose within variables of the same name",
+	)
+
+	var (
+		setOpts    set.Options
+		valueStdin bool
+	)
+	setCmd := &cobra.Command{
+		Use:          "set NAME [VALUE]",
+		Short:        "Create or update a variable",
+		Args:         cobra.RangeArgs(1, 2),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+
+			var value string
+			switch {
+			case valueStdin && len(args) == 2:
+				return errors.New("cannot use VALUE with --value-stdin")
+			case valueStdin:
+				value, err = set.ReadValue(os.Stdin)
+				if err != nil {
+					return err
+				}
+			case len(args) == 2:
+				value = args[1]
+			default:
+				return errors.New("missing VALUE or --value-stdin")
+			}
+
+			return set.Run(variablesPaths, configPath, args[0], value, setOpts)
+		},
+	}
+	setCmd.Flags().StringVar(
+		&setOpts.Label,
+		"label",
+		"",
+		"label of the variable, to choose within variables of the same name",
+	)
+	setCmd.Flags().BoolVar(
+		&valueStdin,
+		"value-stdin",
+		false,
+		"read the value from stdin",
+	)
+
+	var rmOpts rm.Options
+	rmCmd := &cobra.Command{
+		Use:          "rm NAME",
+		Short:        "Remove a variable",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			return rm.Run(variablesPaths, configPath, args[0], rmOpts)
+		},
+	}
+	rmCmd.Flags().StringVar(
+		&rmOpts.Label,
+		"label",
+		"",
+		"label of the variable, to choose within variables of the same name",
+	)
+	rmCmd.Flags().BoolVar(
+		&rmOpts.All,
+		"all",
+		false,
+		"remove all variables with this name",
+	)
+	rmCmd.MarkFlagsMutuallyExclusive("label", "all")
+
+	var useOpts use.Options
+	useCmd := &cobra.Command{
+		Use:          "use [NAME[=LABEL]...]",
+		Short:        "Select variables and print shell commands to apply them",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			sh, err := shell.Resolve(shellName)
+			if err != nil {
+				return err
+			}
+			output, err := use.Run(
+				variablesPaths,
+				configPath,
+				args,
+				useOpts,
+				sh,
+			)
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+	useCmd.Flags().StringArrayVar(
+		&useOpts.Off,
+		"off",
+		nil,
+		"deselect all variables with this name (repeatable)",
+	)
+
+	var execOpts exec.Options
+	execCmd := &cobra.Command{
+		Use:          "exec [--with NAME[=LABEL]]... -- COMMAND [ARG...]",
+		Short:        "Run a command with the selected variables",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			err = exec.Run(variablesPaths, configPath, args, execOpts)
+			if errors.Is(err, exec.ErrCommandFailed) {
+				// The command already reported its own failure
+				cmd.SilenceErrors = true
+			}
+			return err
+		},
+	}
+	execCmd.Flags().StringArrayVar(
+		&execOpts.With,
+		"with",
+		nil,
+		"use this variable instead of the selected one (repeatable)",
+	)
+	// Stop parsing flags at the command name
+	execCmd.Flags().SetInterspersed(false)
+
+	var (
+		exportOpts   export.Options
+		exportOutput string
+	)
+	exportCmd := &cobra.Command{
+		Use:          "export [PATTERN...]",
+		Short:        "Write variables in a format for other tools",
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			output, err := export.Run(
+				variablesPaths,
+				configPath,
+				args,
+				exportOpts,
+			)
+			if err != nil {
+				return err
+			}
+			if exportOutput != "" {
+				return export.WriteFile(exportOutput, output)
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+	exportCmd.Flags().StringVar(
+		&exportOpts.Format,
+		"format",
+		export.FormatDotEnv,
+		"output format: dotenv, json, yaml, shell or docker",
+	)
+	exportCmd.Flags().BoolVar(
+		&exportOpts.All,
+		"all",
+		false,
+		"export all variables instead of the selected ones",
+	)
+	exportCmd.Flags().StringArrayVar(
+		&exportOpts.Tags,
+		"tag",
+		nil,
+		"only export variables with this tag (repeatable)",
+	)
+	exportCmd.Flags().StringVarP(
+		&exportOutput,
+		"output", "o",
+		"",
+		"write to this file instead of stdout",
+	)
+
+	var importOpts importer.Options
+	importCmd := &cobra.Command{
+		Use:          "import FILE",
+		Short:        "Import variables from a dotenv, JSON or YAML file",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			return importer.Run(variablesPaths, configPath, args[0], importOpts)
+		},
+	}
+	importCmd.Flags().StringVar(
+		&importOpts.Format,
+		"format",
+		"",
+		"input format: dotenv, json or yaml (default: from file extension)",
+	)
+	importCmd.Flags().StringVar(
+		&importOpts.Label,
+		"label",
+		"",
+		`label of imported variables (default "imported from <file>")`,
+	)
+	importCmd.Flags().StringVar(
+		&importOpts.OnConflict,
+		"on-conflict",
+		importer.ConflictSkip,
+		"when a variable already exists: skip, overwrite or add-variant",
+	)
+
+	profileCmd := &cobra.Command{
+		Use:   "profile",
+		Short: "Manage named selection profiles",
+	}
+
+	profileListCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List profiles",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			output, err := profile.List(configPath)
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+
+	profileSaveCmd := &cobra.Command{
+		Use:          "save NAME",
+		Short:        "Save the current selection as a profile",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			return profile.Save(configPath, args[0])
+		},
+	}
+
+	profileApplyCmd := &cobra.Command{
+		Use:          "apply NAME",
+		Short:        "Select a profile and print shell commands to apply it",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
 			if err != nil {
 				return fmt.Errorf("could not resolve variables file: %w", err)
 			}
-			configPath, err := resolveConfigFile(variablesPath)
+			configPath, err := resolveConfigFile(variablesPaths)
 			if err != nil {
 				return fmt.Errorf("could not resolve config file: %w", err)
 			}
-			output, err := restore.Run(variablesPath, configPath)
+			sh, err := shell.Resolve(shellName)
+			if err != nil {
+				return err
+			}
+			output, err := profile.Apply(
+				variablesPaths,
+				configPath,
+				args[0],
+				sh,
+			)
 			if err != nil {
 				return err
 			}
@@ -141,45 +659,479 @@ func main() {
 		},
 	}
 
+	profileDeleteCmd := &cobra.Command{
+		Use:          "delete NAME",
+		Short:        "Delete a profile",
+		Args:         cobra.ExactArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			return profile.Delete(configPath, args[0])
+		},
+	}
+
+	profileCmd.AddCommand(profileListCmd)
+	profileCmd.AddCommand(profileSaveCmd)
+	profileCmd.AddCommand(profileApplyCmd)
+	profileCmd.AddCommand(profileDeleteCmd)
+
+	hookCmd := &cobra.Command{
+		Use:          "hook",
+		Short:        "Print shell commands for the project file of the working directory",
+		Long:         "Print shell commands that activate the variables of the nearest " + hook.ProjectFileName + " file,\nor restore them when leaving its directory. Called by the shell integration\nbefore each prompt.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			sh, err := shell.Resolve(shellName)
+			if err != nil {
+				return err
+			}
+			// The hook runs before each prompt, it must not wait or prompt
+			commands.NonInteractive = true
+			output, err := hook.Run(
+				variablesPaths,
+				configPath,
+				resolveTrustFile(variablesPaths),
+				sh,
+			)
+			if err != nil {
+				return err
+			}
+			if output != "" {
+				_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+				return err
+			}
+			return nil
+		},
+	}
+
+	allowCmd := &cobra.Command{
+		Use:          "allow [PATH]",
+		Short:        "Allow a " + hook.ProjectFileName + " file to activate its variables",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			var path string
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return hook.Allow(resolveTrustFile(variablesPaths), path)
+		},
+	}
+
+	denyCmd := &cobra.Command{
+		Use:          "deny [PATH]",
+		Short:        "Prevent a " + hook.ProjectFileName + " file from activating its variables",
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			var path string
+			if len(args) > 0 {
+				path = args[0]
+			}
+			return hook.Deny(resolveTrustFile(variablesPaths), path)
+		},
+	}
+
+	keygenCmd := &cobra.Command{
+		Use:          "keygen",
+		Short:        "Create an identity for files encrypted for recipients",
+		Long:         "Create an identity, the private key unlocking variables files encrypted for\nrecipients, and print the matching public key to share with teammates.\nAn existing identity is kept.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			recipient, err := keygen.Run()
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", recipient)
+			return err
+		},
+	}
+
+	agentOpts := agent.Options{Timeout: agent.DefaultTimeout}
+	agentCmd := &cobra.Command{
+		Use:          "agent",
+		Short:        "Hold the keys of password-protected files in memory",
+		Long:         "Start an agent holding the keys of password-protected files once unlocked, so\nthat the password isn't asked for again. A key is forgotten after it wasn't\nused for the timeout. The agent listens on APIKI_AGENT_SOCK, or\n~/.apiki/agent.sock by default.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return agent.Run(commands.AgentSocket, agentOpts)
+		},
+	}
+	agentCmd.Flags().DurationVar(
+		&agentOpts.Timeout,
+		"timeout",
+		agent.DefaultTimeout,
+		"forget keys that weren't used for this long",
+	)
+	agentCmd.Flags().BoolVar(
+		&agentOpts.Foreground,
+		"foreground",
+		false,
+		"run the agent in the foreground instead of detaching it",
+	)
+
+	lockCmd := &cobra.Command{
+		Use:          "lock",
+		Short:        "Make the agent forget every key",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return agent.Lock(commands.AgentSocket)
+		},
+	}
+
+	keychainCmd := &cobra.Command{
+		Use:   "keychain",
+		Short: "Manage the keychain items holding the keys of files",
+	}
+
+	keychainListCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the keychain items and the files using them",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			output, err := keychain.List()
+			if err != nil || output == "" {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+			return err
+		},
+	}
+
+	keychainPruneCmd := &cobra.Command{
+		Use:          "prune",
+		Short:        "Delete the keychain items that no file uses",
+		Long:         "Delete the keychain items of variables files that were deleted, or that were\ndecrypted or rotated to another key. A file that was moved since it was\nencrypted can't be unlocked once its item is deleted.",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return keychain.Prune()
+		},
+	}
+
+	keychainCmd.AddCommand(keychainListCmd)
+	keychainCmd.AddCommand(keychainPruneCmd)
+
+	recipientsCmd := &cobra.Command{
+		Use:   "recipients",
+		Short: "Manage who can unlock a file encrypted for recipients",
+	}
+
+	recipientsListCmd := &cobra.Command{
+		Use:          "list",
+		Short:        "List the public keys that can unlock the file",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPath, err := resolveSingleVariablesFile(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			output, err := recipients.List(variablesPath)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+			return err
+		},
+	}
+
+	recipientsAddCmd := &cobra.Command{
+		Use:          "add PUBLIC_KEY...",
+		Short:        "Allow public keys to unlock the file",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPath, err := resolveSingleVariablesFile(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			return recipients.Add(variablesPath, args)
+		},
+	}
+
+	recipientsRemoveCmd := &cobra.Command{
+		Use:          "remove PUBLIC_KEY...",
+		Short:        "Stop public keys from unlocking the file",
+		Long:         "Stop public keys from unlocking the file. The data key is rotated, so that\nremoved recipients can't decrypt values changed afterwards.",
+		Args:         cobra.MinimumNArgs(1),
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPath, err := resolveSingleVariablesFile(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			return recipients.Remove(variablesPath, args)
+		},
+	}
+
+	recipientsCmd.AddCommand(recipientsListCmd)
+	recipientsCmd.AddCommand(recipientsAddCmd)
+	recipientsCmd.AddCommand(recipientsRemoveCmd)
+
+	fixPermissionsCmd := &cobra.Command{
+		Use:          "fix-permissions",
+		Short:        "Restrict apiki's files to their owner",
+		Args:         cobra.NoArgs,
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			variablesPaths, err := resolveVariablesFiles(cmd)
+			if err != nil {
+				return fmt.Errorf("could not resolve variables file: %w", err)
+			}
+			configPath, err := resolveConfigFile(variablesPaths)
+			if err != nil {
+				return fmt.Errorf("could not resolve config file: %w", err)
+			}
+			return permissions.Fix(
+				variablesPaths,
+				configPath,
+				resolveTrustFile(variablesPaths),
+				commands.IdentityPath,
+			)
+		},
+	}
+
+	var shellInitCompletion bool
+	shellInitCmd := &cobra.Command{
+		Use:          "shell-init SHELL",
+		Short:        "Print the shell integration script",
+		Long:         "Print the shell integration script for bash, zsh, fish, nu or pwsh.\nAdd `eval \"$(apiki shell-init zsh)\"` to your shell config to load it.",
+		Args:         cobra.ExactArgs(1),
+		ValidArgs:    []string{"bash", "zsh", "fish", "nu", "pwsh"},
+		SilenceUsage: true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bin, err := os.Executable()
+			if err != nil {
+				return fmt.Errorf("could not locate apiki binary: %w", err)
+			}
+			var opts shellinit.Options
+			rootCmd.PersistentFlags().VisitAll(func(flag *pflag.Flag) {
+				if flag.Value.Type() == "bool" {
+					return
+				}
+				opts.ValueFlags = append(opts.ValueFlags, "--"+flag.Name)
+				if flag.Shorthand != "" {
+					opts.ValueFlags = append(
+						opts.ValueFlags,
+						"-"+flag.Shorthand,
+					)
+				}
+			})
+			if shellInitCompletion {
+				opts.Completion = func(w io.Writer, shellName string) error {
+					return genCompletion(rootCmd, w, shellName)
+				}
+			}
+			output, err := shellinit.Run(args[0], bin, opts)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(os.Stdout, "%s\n", output)
+			return err
+		},
+	}
+	shellInitCmd.Flags().BoolVar(
+		&shellInitCompletion,
+		"completion",
+		false,
+		"also register shell completion",
+	)
+
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(encryptCmd)
 	rootCmd.AddCommand(decryptCmd)
 	rootCmd.AddCommand(rotateCmd)
 	rootCmd.AddCommand(restoreCmd)
+	rootCmd.AddCommand(listCmd)
+	rootCmd.AddCommand(getCmd)
+	rootCmd.AddCommand(setCmd)
+	rootCmd.AddCommand(rmCmd)
+	rootCmd.AddCommand(useCmd)
+	rootCmd.AddCommand(execCmd)
+	rootCmd.AddCommand(exportCmd)
+	rootCmd.AddCommand(importCmd)
+	rootCmd.AddCommand(shellInitCmd)
+	rootCmd.AddCommand(profileCmd)
+	rootCmd.AddCommand(hookCmd)
+	rootCmd.AddCommand(allowCmd)
+	rootCmd.AddCommand(denyCmd)
+	rootCmd.AddCommand(fixPermissionsCmd)
+	rootCmd.AddCommand(keygenCmd)
+	rootCmd.AddCommand(agentCmd)
+	rootCmd.AddCommand(lockCmd)
+	rootCmd.AddCommand(recipientsCmd)
+	rootCmd.AddCommand(keychainCmd)
+
+	// Completion candidates are read from stdout by the shell, unlike the rest
+	// of Cobra's output
+	if len(os.Args) > 1 && os.Args[1] == cobra.ShellCompRequestCmd {
+		rootCmd.SetOut(os.Stdout)
+	}
 
 	if err := rootCmd.Execute(); err != nil {
+		var exitErr *commands.ExitError
+		if errors.As(err, &exitErr) {
+			os.Exit(exitErr.Code)
+		}
 		os.Exit(1)
 	}
 }
 
-// resolveVariablesFile determines the variables file path using the following
-// priority:
-//  1. --variables-file flag (if explicitly set)
-//  2. APIKI_FILE environment variable
+// genCompletion writes the Cobra completion script for shellName to w.
+func genCompletion(
+	rootCmd *cobra.Command,
+	w io.Writer,
+	shellName string,
+) error {
+	switch shellName {
+	case "bash":
+		return rootCmd.GenBashCompletionV2(w, true)
+	case "zsh":
+		return rootCmd.GenZshCompletion(w)
+	case "fish":
+		return rootCmd.GenFishCompletion(w, true)
+	case "pwsh":
+		return rootCmd.GenPowerShellCompletionWithDesc(w)
+	}
+	return fmt.Errorf("%w: %s", shellinit.ErrCompletionUnsupported, shellName)
+}
+
+// resolveVariablesFiles determines the variables file paths using the
+// following priority:
+//  1. --variables-file flags (if explicitly set)
+//  2. APIKI_FILE environment variable, a list of paths separated like PATH
 //  3. Default path (~/.apiki/variables.json)
-func resolveVariablesFile(cmd *cobra.Command) (string, error) {
+//
+// The first path is the default file, where new variables are added.
+func resolveVariablesFiles(cmd *cobra.Command) ([]string, error) {
 	// 1. Check if flag was explicitly set
 	if cmd.Flags().Changed("variables-file") {
-		return variablesFile, nil
+		return variablesFiles, nil
 	}
+	return resolveDefaultVariablesFiles()
+}
 
+// resolveDefaultVariablesFiles determines the variables file paths used
+// without --variables-file flags: the APIKI_FILE environment variable, or the
+// default path.
+func resolveDefaultVariablesFiles() ([]string, error) {
 	// 2. Check environment variable
-	if envPath := os.Getenv("APIKI_FILE"); envPath != "" {
-		return envPath, nil
+	envPaths := slices.DeleteFunc(
+		filepath.SplitList(os.Getenv("APIKI_FILE")),
+		func(path string) bool { return path == "" },
+	)
+	if len(envPaths) > 0 {
+		return envPaths, nil
 	}
 
 	// 3. Fall back to default
 	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	return []string{filepath.Join(home, ".apiki", "variables.json")}, nil
+}
+
+// resolveSingleVariablesFile determines the variables file path for commands
+// that work on a single file. Fails if several files are given.
+func resolveSingleVariablesFile(cmd *cobra.Command) (string, error) {
+	paths, err := resolveVariablesFiles(cmd)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(home, ".apiki", "variables.json"), nil
+	if len(paths) > 1 {
+		return "", errors.New(
+			"several variables files given, choose one with --variables-file",
+		)
+	}
+	return paths[0], nil
 }
 
-// resolveConfigFile determines the config file path based on the variables file
-// path.
-// Config file is in the same directory as variables file, named "config.json".
-func resolveConfigFile(variablesPath string) (string, error) {
-	dir := filepath.Dir(variablesPath)
+// resolveConfigFile determines the config file path based on the variables
+// file paths. Config file is in the same directory as the default variables
+// file, named "config.json".
+func resolveConfigFile(variablesPaths []string) (string, error) {
+	dir := filepath.Dir(variablesPaths[0])
 	return filepath.Join(dir, "config.json"), nil
 }
+
+// resolveStrict reports whether variables files that other users can access
+// are refused: if the --strict flag is set, or APIKI_STRICT is true.
+func resolveStrict() bool {
+	if strict {
+		return true
+	}
+	env, _ := strconv.ParseBool(os.Getenv("APIKI_STRICT"))
+	return env
+}
+
+// resolveIdentityFile determines the identity file path using the following
+// priority:
+//  1. --identity flag
+//  2. APIKI_IDENTITY environment variable
+//  3. Default path (~/.apiki/identity)
+func resolveIdentityFile() string {
+	if identityFile != "" {
+		return identityFile
+	}
+	if env := os.Getenv("APIKI_IDENTITY"); env != "" {
+		return env
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".apiki", "identity")
+}
+
+// resolveAgentSocket determines the agent socket path using the following
+// priority:
+//  1. APIKI_AGENT_SOCK environment variable
+//  2. Default path (~/.apiki/agent.sock)
+func resolveAgentSocket() string {
+	if env := os.Getenv("APIKI_AGENT_SOCK"); env != "" {
+		return env
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".apiki", "agent.sock")
+}
+
+// resolveKeychainIndex determines the path of the index of keychain items. Like
+// the keychain, it is per user, at ~/.apiki/keychain.json.
+func resolveKeychainIndex() string {
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".apiki", "keychain.json")
+}
+
+// resolveTrustFile determines the trust database path based on the variables
+// file paths. The trust database is in the same directory as the default
+// variables file, named "trust.json".
+func resolveTrustFile(variablesPaths []string) string {
+	return filepath.Join(filepath.Dir(variablesPaths[0]), "trust.json")
+}
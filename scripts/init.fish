@@ -1,12 +1,7 @@
 set -q APIKI_DIR; or set APIKI_DIR "$HOME/.local/share/apiki"
 
-# Auto-restore apiki state on shell startup (opt-in via APIKI_AUTO_RESTORE)
-# Only runs in the first shell, not subshells (APIKI_RESTORED marker)
-if set -q APIKI_AUTO_RESTORE; and not set -q APIKI_RESTORED
-  eval ("$APIKI_DIR/apiki" restore 2>/dev/null)
-  set -gx APIKI_RESTORED 1
-end
-
-function apiki
-  eval ("$APIKI_DIR/apiki" $argv)
-end
+# Load the shell integration generated by the installed apiki binary, so the
+# wrapper always matches its version (see `apiki shell-init --help`). Only the
+# output of subcommands printing shell commands is evaluated, the subcommand
+# being found after the global flags and their values.
+"$APIKI_DIR/apiki" shell-init fish | source
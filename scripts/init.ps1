@@ -0,0 +1,6 @@
+$apikiDir = $env:APIKI_DIR
+if (-not $apikiDir) { $apikiDir = Join-Path $HOME '.local/share/apiki' }
+
+# Load the shell integration generated by the installed apiki binary, so the
+# wrapper always matches its version (see `apiki shell-init --help`)
+& (Join-Path $apikiDir 'apiki') shell-init pwsh | Out-String | Invoke-Expression
@@ -20,6 +20,14 @@ cat <<'EOF'
     set -gx APIKI_DIR "/usr/share/apiki"
     source "$APIKI_DIR/init.fish"
 
+  For nushell (config.nu):
+    $env.APIKI_DIR = "/usr/share/apiki"
+    source "/usr/share/apiki/init.nu"
+
+  For PowerShell ($PROFILE):
+    $env:APIKI_DIR = "/usr/share/apiki"
+    . "$env:APIKI_DIR/init.ps1"
+
   Then restart your shell or source your config file.
 ================================================================================
 